@@ -0,0 +1,148 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the authenticated
+// principal. It's called by Authenticate, and can be used by other
+// authentication middlewares.
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal authenticated for a request, if
+// any. FileSystems and backends can use it to scope access per user.
+func PrincipalFromContext(ctx context.Context) (principal string, ok bool) {
+	principal, ok = ctx.Value(principalContextKey{}).(string)
+	return principal, ok && principal != ""
+}
+
+// AuthOptions configures the authentication schemes accepted by
+// Authenticate.
+//
+// Credential checks return the principal of the authenticated user, e.g. its
+// user name or principal URL. An empty principal rejects the credentials with
+// 401 Unauthorized. Errors are reported to the client with their HTTP status
+// code, if any, or 500 Internal Server Error.
+type AuthOptions struct {
+	// Realm is the protection space sent in WWW-Authenticate headers.
+	Realm string
+	// Basic, if set, checks the credentials of the Basic scheme, defined in
+	// RFC 7617.
+	Basic func(ctx context.Context, username, password string) (principal string, err error)
+	// Bearer, if set, checks the tokens of the Bearer scheme, defined in
+	// RFC 6750.
+	Bearer func(ctx context.Context, token string) (principal string, err error)
+}
+
+// Authenticate returns a handler authenticating requests before invoking h.
+// The principal is stored in the request context, see PrincipalFromContext.
+// Requests without valid credentials are rejected with 401 Unauthorized.
+func Authenticate(opts *AuthOptions, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := opts.authenticate(r)
+		if err != nil {
+			internal.ServeError(w, err)
+			return
+		} else if principal == "" {
+			opts.challenge(w)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+func (opts *AuthOptions) authenticate(r *http.Request) (string, error) {
+	if username, password, ok := r.BasicAuth(); ok && opts.Basic != nil {
+		return opts.Basic(r.Context(), username, password)
+	}
+
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") && opts.Bearer != nil {
+		if token = strings.TrimSpace(token); token != "" {
+			return opts.Bearer(r.Context(), token)
+		}
+	}
+
+	return "", nil
+}
+
+func (opts *AuthOptions) challenge(w http.ResponseWriter) {
+	params := fmt.Sprintf("realm=%q", opts.Realm)
+	if opts.Basic != nil {
+		w.Header().Add("WWW-Authenticate", "Basic "+params+`, charset="UTF-8"`)
+	}
+	if opts.Bearer != nil {
+		w.Header().Add("WWW-Authenticate", "Bearer "+params)
+	}
+	http.Error(w, "webdav: authentication required", http.StatusUnauthorized)
+}
+
+// Authorizer checks whether a request is allowed, e.g. against a per-path,
+// per-method or per-principal policy. See Handler.Authorizer.
+type Authorizer interface {
+	// Authorize returns an error if the request isn't allowed to perform
+	// method on path. Errors carrying an HTTP status code, see NewHTTPError,
+	// are reported with it. Other errors are reported with 403 Forbidden,
+	// or 401 Unauthorized if the request has no principal.
+	Authorize(r *http.Request, method, path string) error
+}
+
+// AuthorizerFunc is an Authorizer implemented by a function.
+type AuthorizerFunc func(r *http.Request, method, path string) error
+
+var _ Authorizer = AuthorizerFunc(nil)
+
+func (f AuthorizerFunc) Authorize(r *http.Request, method, path string) error {
+	return f(r, method, path)
+}
+
+// authorize checks a request with the Authorizer, for the request URI and
+// the destination of COPY and MOVE requests.
+func (h *Handler) authorize(r *http.Request) error {
+	if h.Authorizer == nil {
+		return nil
+	}
+
+	paths := []string{r.URL.Path}
+	if r.Method == "COPY" || r.Method == "MOVE" {
+		// Malformed destinations are rejected later on
+		if u, err := url.Parse(r.Header.Get("Destination")); err == nil && u.Path != "" {
+			paths = append(paths, u.Path)
+		}
+	}
+
+	for _, p := range paths {
+		if err := h.authorizeMethod(r, r.Method, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorizeMethod checks whether the Authorizer allows method on path, and
+// associates the error with an HTTP status code if it doesn't have one
+// already.
+func (h *Handler) authorizeMethod(r *http.Request, method, path string) error {
+	err := h.Authorizer.Authorize(r, method, path)
+	if err == nil {
+		return nil
+	}
+	var httpErr *internal.HTTPError
+	if errors.As(err, &httpErr) {
+		return err
+	} else if _, ok := PrincipalFromContext(r.Context()); !ok {
+		return NewHTTPError(http.StatusUnauthorized, err)
+	}
+	return NewHTTPError(http.StatusForbidden, err)
+}
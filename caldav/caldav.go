@@ -63,11 +63,27 @@ func ValidateCalendarObject(cal *ical.Calendar) (eventType string, uid string, e
 	return eventType, uid, nil
 }
 
+// ObjectName returns the name of the calendar object resource storing cal,
+// derived from its UID: "<UID>.ics". Servers use it to store calendar objects
+// added to a calendar without a name.
+func ObjectName(cal *ical.Calendar) (string, error) {
+	_, uid, err := ValidateCalendarObject(cal)
+	if err != nil {
+		return "", err
+	} else if uid == "" {
+		return "", fmt.Errorf("calendar object has no UID")
+	}
+	return internal.ObjectName(uid, ".ics"), nil
+}
+
 type Calendar struct {
-	Path                  string
-	Name                  string
-	Description           string
-	MaxResourceSize       int64
+	Path            string
+	Name            string
+	Description     string
+	MaxResourceSize int64
+	// SupportedComponentSet lists the components calendar objects can
+	// contain, e.g. VEVENT or VTODO. It's advertised in PROPFIND responses and
+	// enforced on PUT. If nil, only VEVENT is supported.
 	SupportedComponentSet []string
 }
 
@@ -87,6 +103,8 @@ type CalendarExpandRequest struct {
 	Start, End time.Time
 }
 
+// CompFilter matches components. A zero Start or End leaves the time range
+// unbounded in that direction, if both are zero no time range is used.
 type CompFilter struct {
 	Name         string
 	IsNotDefined bool
@@ -112,6 +130,7 @@ type PropFilter struct {
 type TextMatch struct {
 	Text            string
 	NegateCondition bool
+	Collation       string // defaults to "i;ascii-casemap"
 }
 
 type CalendarQuery struct {
@@ -119,6 +138,28 @@ type CalendarQuery struct {
 	CompFilter  CompFilter
 }
 
+// NewEventTimeRangeQuery returns a query for all events overlapping the time
+// range between start and end. The full calendar data of each matching
+// calendar object is requested. A zero start or end leaves the time range
+// unbounded, e.g. to query all events after now.
+func NewEventTimeRangeQuery(start, end time.Time) *CalendarQuery {
+	return &CalendarQuery{
+		CompRequest: CalendarCompRequest{
+			Name:     ical.CompCalendar,
+			AllProps: true,
+			AllComps: true,
+		},
+		CompFilter: CompFilter{
+			Name: ical.CompCalendar,
+			Comps: []CompFilter{{
+				Name:  ical.CompEvent,
+				Start: start,
+				End:   end,
+			}},
+		},
+	}
+}
+
 type CalendarMultiGet struct {
 	Paths       []string
 	CompRequest CalendarCompRequest
@@ -129,7 +170,12 @@ type CalendarObject struct {
 	ModTime       time.Time
 	ContentLength int64
 	ETag          string
-	Data          *ical.Calendar
+	// ScheduleTag is the schedule tag of scheduling object resources, as
+	// defined in RFC 6638 section 3.2.10. Unlike the ETag, it only changes
+	// when the organizer or an attendee makes a significant change, not when
+	// attendee replies are merged.
+	ScheduleTag string
+	Data        *ical.Calendar
 }
 
 // SyncQuery is the query struct represents a sync-collection request
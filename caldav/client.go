@@ -32,6 +32,42 @@ func DiscoverContextURL(ctx context.Context, domain string) (string, error) {
 	return internal.DiscoverContextURL(ctx, "caldav", domain)
 }
 
+// DiscoverCalendars lists the calendars of the current user, starting from
+// the URL of a CalDAV server, e.g. "https://example.org". It follows the
+// bootstrapping procedure described in RFC 6764 section 6: the current user
+// principal is found via the /.well-known/caldav URL or the context path of
+// serverURL, then its calendar home set is listed.
+func DiscoverCalendars(ctx context.Context, serverURL string, c webdav.HTTPClient) ([]Calendar, error) {
+	endpoints, err := internal.DiscoveryEndpoints(serverURL, "caldav")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		client    *Client
+		principal string
+	)
+	for _, endpoint := range endpoints {
+		client, err = NewClient(c, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		principal, err = client.FindCurrentUserPrincipal(ctx)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("caldav: failed to find current user principal: %w", err)
+	}
+
+	homeSet, err := client.FindCalendarHomeSet(ctx, principal)
+	if err != nil {
+		return nil, fmt.Errorf("caldav: failed to find calendar home set: %w", err)
+	}
+	return client.FindCalendars(ctx, homeSet)
+}
+
 // Client provides access to a remote CardDAV server.
 type Client struct {
 	*webdav.Client
@@ -200,6 +236,9 @@ func encodeCalendarReq(c *CalendarCompRequest) (*internal.Prop, error) {
 
 func encodeCompFilter(filter *CompFilter) *compFilter {
 	encoded := compFilter{Name: filter.Name}
+	if filter.IsNotDefined {
+		encoded.IsNotDefined = &struct{}{}
+	}
 	if !filter.Start.IsZero() || !filter.End.IsZero() {
 		encoded.TimeRange = &timeRange{
 			Start: dateWithUTCTime(filter.Start),
@@ -217,6 +256,9 @@ func encodeCompFilter(filter *CompFilter) *compFilter {
 
 func encodePropFilter(filter *PropFilter) *propFilter {
 	encoded := propFilter{Name: filter.Name}
+	if filter.IsNotDefined {
+		encoded.IsNotDefined = &struct{}{}
+	}
 	if !filter.Start.IsZero() || !filter.End.IsZero() {
 		encoded.TimeRange = &timeRange{
 			Start: dateWithUTCTime(filter.Start),
@@ -235,6 +277,9 @@ func encodeParamFilter(pf ParamFilter) paramFilter {
 		Name:      pf.Name,
 		TextMatch: encodeTextMatch(pf.TextMatch),
 	}
+	if pf.IsNotDefined {
+		encoded.IsNotDefined = &struct{}{}
+	}
 	return encoded
 }
 
@@ -246,6 +291,7 @@ func encodeTextMatch(tm *TextMatch) *textMatch {
 	encoded := &textMatch{
 		Text:            tm.Text,
 		NegateCondition: negateCondition(tm.NegateCondition),
+		Collation:       tm.Collation,
 	}
 	return encoded
 }
@@ -372,12 +418,20 @@ func populateCalendarObject(co *CalendarObject, h http.Header) error {
 		co.Path = u.Path
 	}
 	if etag := h.Get("ETag"); etag != "" {
-		etag, err := strconv.Unquote(etag)
-		if err != nil {
+		var e internal.ETag
+		if err := e.UnmarshalText([]byte(etag)); err != nil {
 			return err
 		}
+		etag := string(e)
 		co.ETag = etag
 	}
+	if tag := h.Get("Schedule-Tag"); tag != "" {
+		tag, err := strconv.Unquote(tag)
+		if err != nil {
+			return err
+		}
+		co.ScheduleTag = tag
+	}
 	if contentLength := h.Get("Content-Length"); contentLength != "" {
 		n, err := strconv.ParseInt(contentLength, 10, 64)
 		if err != nil {
@@ -433,34 +487,140 @@ func (c *Client) GetCalendarObject(ctx context.Context, path string) (*CalendarO
 }
 
 func (c *Client) PutCalendarObject(ctx context.Context, path string, cal *ical.Calendar) (*CalendarObject, error) {
-	// TODO: add support for If-None-Match and If-Match
+	co, _, err := c.putCalendarObject(ctx, path, cal, nil)
+	return co, err
+}
+
+// PutCalendarObjectWithOptions is like PutCalendarObject, but sends the
+// conditional headers of opts: IfNoneMatch set to "*" only creates the
+// calendar object, and IfMatch set to an ETag only updates it if it hasn't
+// been modified. If the condition fails, the returned error matches
+// webdav.ErrPreconditionFailed. The returned calendar object holds the new
+// ETag, if the server sent one. opts may be nil.
+func (c *Client) PutCalendarObjectWithOptions(ctx context.Context, path string, cal *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error) {
+	co, _, err := c.putCalendarObject(ctx, path, cal, opts.header())
+	return co, err
+}
+
+func (opts *PutCalendarObjectOptions) header() http.Header {
+	if opts == nil {
+		return nil
+	}
+	header := make(http.Header)
+	if opts.IfNoneMatch.IsSet() {
+		header.Set("If-None-Match", string(opts.IfNoneMatch))
+	}
+	if opts.IfMatch.IsSet() {
+		header.Set("If-Match", string(opts.IfMatch))
+	}
+	if opts.IfScheduleTagMatch.IsSet() {
+		header.Set("If-Schedule-Tag-Match", string(opts.IfScheduleTagMatch))
+	}
+	return header
+}
 
+func (c *Client) putCalendarObject(ctx context.Context, path string, cal *ical.Calendar, header http.Header) (co *CalendarObject, created bool, err error) {
 	// TODO: some servers want a Content-Length header, so we can't stream the
 	// request body here. See the Radicale issue:
 	// https://github.com/Kozea/Radicale/issues/1016
 
 	var buf bytes.Buffer
 	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	req, err := c.ic.NewRequest(http.MethodPut, path, &buf)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
 	}
 	req.Header.Set("Content-Type", ical.MIMEType)
 
 	resp, err := c.ic.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	resp.Body.Close()
+	internal.DiscardBody(resp.Body)
 
-	co := &CalendarObject{Path: path}
+	co = &CalendarObject{Path: path}
 	if err := populateCalendarObject(co, resp.Header); err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return co, nil
+	return co, resp.StatusCode == http.StatusCreated, nil
+}
+
+// BatchCalendarObject is a calendar object to upload with
+// PutCalendarObjects.
+type BatchCalendarObject struct {
+	Path string
+	Data *ical.Calendar
+	// ETag is the current ETag of the calendar object. If empty, the
+	// calendar object is created and must not already exist. Otherwise, the
+	// calendar object is only updated if its ETag still matches.
+	ETag string
+}
+
+// PutStatus is the outcome of a single upload in a batch.
+type PutStatus int
+
+const (
+	PutFailed PutStatus = iota
+	PutCreated
+	PutUpdated
+	// PutConflict indicates that the object has been created or modified
+	// concurrently, i.e. the If-Match or If-None-Match precondition failed.
+	PutConflict
+)
+
+// BatchPutResult holds the result of a single upload in a batch.
+type BatchPutResult struct {
+	Path   string
+	Status PutStatus
+	// Object is set if the upload succeeded.
+	Object *CalendarObject
+	// Err is set if the upload failed.
+	Err error
+}
+
+// PutCalendarObjects uploads a batch of calendar objects. Each object is
+// either created with "If-None-Match: *" or updated with "If-Match", see
+// BatchCalendarObject.ETag. A failed upload doesn't abort the batch: the
+// outcome of each upload is reported in the returned results, in the same
+// order as objects. An error is only returned if the context is done.
+func (c *Client) PutCalendarObjects(ctx context.Context, objects []BatchCalendarObject) ([]BatchPutResult, error) {
+	results := make([]BatchPutResult, 0, len(objects))
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		var opts PutCalendarObjectOptions
+		if obj.ETag == "" {
+			opts.IfNoneMatch = "*"
+		} else {
+			opts.IfMatch = webdav.ConditionalMatch(internal.ETag(obj.ETag).String())
+		}
+
+		result := BatchPutResult{Path: obj.Path}
+		co, created, err := c.putCalendarObject(ctx, obj.Path, obj.Data, opts.header())
+		if err != nil {
+			result.Err = err
+			if errors.Is(err, webdav.ErrPreconditionFailed) {
+				result.Status = PutConflict
+			}
+		} else {
+			result.Object = co
+			if created {
+				result.Status = PutCreated
+			} else {
+				result.Status = PutUpdated
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
 
 // SyncCollection performs a collection synchronization operation on the
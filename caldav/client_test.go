@@ -0,0 +1,274 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+)
+
+var queryCalendarResponse = `<?xml version="1.0" encoding="utf-8" ?>
+<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:response>
+    <D:href>/user/calendars/cal/abcd1.ics</D:href>
+    <D:propstat>
+      <D:prop>
+        <D:getetag>"fffff-abcd1"</D:getetag>
+        <C:calendar-data>BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001102Z
+DTSTART:20060104T140000Z
+DURATION:PT1H
+SUMMARY:Event #1
+UID:74855313FA803DA593CD579A@example.com
+END:VEVENT
+END:VCALENDAR
+</C:calendar-data>
+      </D:prop>
+      <D:status>HTTP/1.1 200 OK</D:status>
+    </D:propstat>
+  </D:response>
+</D:multistatus>`
+
+func TestClientQueryCalendar(t *testing.T) {
+	var reqBody []byte
+	var reqDepth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "REPORT" {
+			t.Errorf("got method %v, want REPORT", r.Method)
+		}
+		reqDepth = r.Header.Get("Depth")
+		reqBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, queryCalendarResponse)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2006, 1, 4, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2006, 1, 5, 0, 0, 0, 0, time.UTC)
+	cos, err := c.QueryCalendar(context.Background(), "/user/calendars/cal/", NewEventTimeRangeQuery(start, end))
+	if err != nil {
+		t.Fatalf("QueryCalendar() = %v", err)
+	}
+
+	if reqDepth != "1" {
+		t.Errorf("got Depth %q, want 1", reqDepth)
+	}
+	var query calendarQuery
+	if err := xml.Unmarshal(reqBody, &query); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	cf := query.Filter.CompFilter
+	if cf.Name != ical.CompCalendar || len(cf.CompFilters) != 1 || cf.CompFilters[0].Name != ical.CompEvent {
+		t.Fatalf("unexpected comp-filter in request:\n%s", reqBody)
+	}
+	tr := cf.CompFilters[0].TimeRange
+	if tr == nil || !time.Time(tr.Start).Equal(start) || !time.Time(tr.End).Equal(end) {
+		t.Errorf("unexpected time-range in request:\n%s", reqBody)
+	}
+	if !strings.Contains(string(reqBody), "calendar-data") {
+		t.Errorf("request doesn't ask for calendar-data:\n%s", reqBody)
+	}
+
+	if len(cos) != 1 {
+		t.Fatalf("got %v calendar objects, want 1", len(cos))
+	}
+	co := cos[0]
+	if co.Path != "/user/calendars/cal/abcd1.ics" {
+		t.Errorf("got path %q", co.Path)
+	}
+	if co.ETag != "fffff-abcd1" {
+		t.Errorf("got ETag %q", co.ETag)
+	}
+	events := co.Data.Events()
+	if len(events) != 1 {
+		t.Fatalf("got %v events, want 1", len(events))
+	}
+	if summary, _ := events[0].Props.Text(ical.PropSummary); summary != "Event #1" {
+		t.Errorf("got summary %q", summary)
+	}
+}
+
+func TestClientQueryCalendarOpenTimeRange(t *testing.T) {
+	var reqBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, queryCalendarResponse)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2006, 1, 4, 0, 0, 0, 0, time.UTC)
+	if _, err := c.QueryCalendar(context.Background(), "/user/calendars/cal/", NewEventTimeRangeQuery(start, time.Time{})); err != nil {
+		t.Fatalf("QueryCalendar() = %v", err)
+	}
+
+	var query calendarQuery
+	if err := xml.Unmarshal(reqBody, &query); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	tr := query.Filter.CompFilter.CompFilters[0].TimeRange
+	if tr == nil || !time.Time(tr.Start).Equal(start) || !time.Time(tr.End).IsZero() {
+		t.Errorf("unexpected time-range in request:\n%s", reqBody)
+	}
+	if strings.Contains(string(reqBody), "end=") {
+		t.Errorf("request contains an end time:\n%s", reqBody)
+	}
+}
+
+func TestClientPutCalendarObjects(t *testing.T) {
+	etags := map[string]string{
+		"/cal/existing.ics": "1",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag, exists := etags[r.URL.Path]
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != `"`+etag+`"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		etags[r.URL.Path] = "2"
+		w.Header().Set("ETag", `"2"`)
+		if exists {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := ical.NewDecoder(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001102Z
+DTSTART:20060104T140000Z
+UID:74855313FA803DA593CD579A@example.com
+END:VEVENT
+END:VCALENDAR
+`)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []BatchCalendarObject{
+		{Path: "/cal/new.ics", Data: cal},
+		{Path: "/cal/existing.ics", Data: cal},
+		{Path: "/cal/existing.ics", Data: cal, ETag: "1"},
+		{Path: "/cal/existing.ics", Data: cal, ETag: "1"},
+	}
+	results, err := c.PutCalendarObjects(context.Background(), objects)
+	if err != nil {
+		t.Fatalf("PutCalendarObjects() = %v", err)
+	}
+
+	want := []PutStatus{PutCreated, PutConflict, PutUpdated, PutConflict}
+	if len(results) != len(want) {
+		t.Fatalf("got %v results, want %v", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Status != want[i] {
+			t.Errorf("result %v: got status %v, want %v (err: %v)", i, result.Status, want[i], result.Err)
+		}
+		if (result.Err == nil) != (result.Object != nil) {
+			t.Errorf("result %v: expected exactly one of Err and Object", i)
+		}
+	}
+	if results[2].Object != nil && results[2].Object.ETag != "2" {
+		t.Errorf("got ETag %q, want %q", results[2].Object.ETag, "2")
+	}
+}
+
+func TestClientPutCalendarObjectWithOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") != `"1"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", `"2"`)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := ical.NewDecoder(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example Corp.//CalDAV Client//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:123\r\nDTSTAMP:20060206T001102Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	co, err := c.PutCalendarObjectWithOptions(context.Background(), "/cal/a.ics", cal, &PutCalendarObjectOptions{IfMatch: `"1"`})
+	if err != nil {
+		t.Fatalf("PutCalendarObjectWithOptions() = %v", err)
+	} else if co.ETag != "2" {
+		t.Errorf("got ETag %q, want %q", co.ETag, "2")
+	}
+
+	_, err = c.PutCalendarObjectWithOptions(context.Background(), "/cal/a.ics", cal, &PutCalendarObjectOptions{IfNoneMatch: "*"})
+	if !errors.Is(err, webdav.ErrPreconditionFailed) {
+		t.Errorf("PutCalendarObjectWithOptions() = %v, want webdav.ErrPreconditionFailed", err)
+	}
+
+	// Nil options don't send any conditional header
+	_, err = c.PutCalendarObjectWithOptions(context.Background(), "/cal/a.ics", cal, nil)
+	if !errors.Is(err, webdav.ErrPreconditionFailed) {
+		t.Errorf("PutCalendarObjectWithOptions(nil) = %v, want webdav.ErrPreconditionFailed", err)
+	}
+}
+
+func TestDiscoverCalendars(t *testing.T) {
+	h := &Handler{Backend: testBackend{calendars: []Calendar{
+		{Path: "/user/calendars/cal/", Name: "Personal"},
+	}}}
+	var wellKnown bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/caldav" {
+			wellKnown = true
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cals, err := DiscoverCalendars(context.Background(), srv.URL, srv.Client())
+	if err != nil {
+		t.Fatalf("DiscoverCalendars() = %v", err)
+	}
+	if !wellKnown {
+		t.Errorf("DiscoverCalendars() didn't query the well-known URL")
+	}
+	if len(cals) != 1 || cals[0].Path != "/user/calendars/cal/" || cals[0].Name != "Personal" {
+		t.Errorf("DiscoverCalendars() = %+v", cals)
+	}
+}
@@ -8,21 +8,31 @@ import (
 	"github.com/emersion/go-webdav/internal"
 )
 
-const namespace = "urn:ietf:params:xml:ns:caldav"
+const (
+	namespace          = "urn:ietf:params:xml:ns:caldav"
+	appleICalNamespace = "http://apple.com/ns/ical/"
+)
 
 var (
-	calendarHomeSetName = xml.Name{namespace, "calendar-home-set"}
+	calendarHomeSetName        = xml.Name{namespace, "calendar-home-set"}
+	calendarUserAddressSetName = xml.Name{namespace, "calendar-user-address-set"}
 
 	calendarDescriptionName           = xml.Name{namespace, "calendar-description"}
 	supportedCalendarDataName         = xml.Name{namespace, "supported-calendar-data"}
 	supportedCalendarComponentSetName = xml.Name{namespace, "supported-calendar-component-set"}
 	maxResourceSizeName               = xml.Name{namespace, "max-resource-size"}
+	scheduleTagName                   = xml.Name{namespace, "schedule-tag"}
+	supportedCollationSetName         = xml.Name{namespace, "supported-collation-set"}
 
 	calendarQueryName    = xml.Name{namespace, "calendar-query"}
 	calendarMultigetName = xml.Name{namespace, "calendar-multiget"}
+	compFilterName       = xml.Name{namespace, "comp-filter"}
 
 	calendarName     = xml.Name{namespace, "calendar"}
 	calendarDataName = xml.Name{namespace, "calendar-data"}
+
+	calendarColorName = xml.Name{appleICalNamespace, "calendar-color"}
+	calendarOrderName = xml.Name{appleICalNamespace, "calendar-order"}
 )
 
 // https://tools.ietf.org/html/rfc4791#section-6.2.1
@@ -35,12 +45,28 @@ func (a *calendarHomeSet) GetXMLName() xml.Name {
 	return calendarHomeSetName
 }
 
+// https://tools.ietf.org/html/rfc6638#section-2.4.1
+type calendarUserAddressSet struct {
+	XMLName xml.Name        `xml:"urn:ietf:params:xml:ns:caldav calendar-user-address-set"`
+	Hrefs   []internal.Href `xml:"DAV: href"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-5.2.1
 type calendarDescription struct {
 	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
 	Description string   `xml:",chardata"`
 }
 
+type calendarColor struct {
+	XMLName xml.Name `xml:"http://apple.com/ns/ical/ calendar-color"`
+	Color   string   `xml:",chardata"`
+}
+
+type calendarOrder struct {
+	XMLName xml.Name `xml:"http://apple.com/ns/ical/ calendar-order"`
+	Order   int      `xml:",chardata"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-5.2.4
 type supportedCalendarData struct {
 	XMLName xml.Name           `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-data"`
@@ -53,6 +79,12 @@ type supportedCalendarComponentSet struct {
 	Comp    []comp   `xml:"comp"`
 }
 
+// https://tools.ietf.org/html/rfc4791#section-7.5.1
+type supportedCollationSet struct {
+	XMLName    xml.Name `xml:"urn:ietf:params:xml:ns:caldav supported-collation-set"`
+	Collations []string `xml:"supported-collation"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.6
 type calendarDataType struct {
 	XMLName     xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
@@ -66,6 +98,12 @@ type maxResourceSize struct {
 	Size    int64    `xml:",chardata"`
 }
 
+// https://tools.ietf.org/html/rfc6638#section-3.2.10
+type scheduleTag struct {
+	XMLName xml.Name      `xml:"urn:ietf:params:xml:ns:caldav schedule-tag"`
+	Tag     internal.ETag `xml:",chardata"`
+}
+
 // https://tools.ietf.org/html/rfc4791#section-9.5
 type calendarQuery struct {
 	XMLName  xml.Name       `xml:"urn:ietf:params:xml:ns:caldav calendar-query"`
@@ -175,6 +213,15 @@ func (t *dateWithUTCTime) MarshalText() ([]byte, error) {
 	return []byte(s), nil
 }
 
+// MarshalXMLAttr omits zero times, which leave time ranges unbounded.
+func (t *dateWithUTCTime) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if time.Time(*t).IsZero() {
+		return xml.Attr{}, nil
+	}
+	b, err := t.MarshalText()
+	return xml.Attr{Name: name, Value: string(b)}, err
+}
+
 // Request variant of https://tools.ietf.org/html/rfc4791#section-9.6
 type calendarDataReq struct {
 	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
@@ -215,8 +262,9 @@ type calendarDataResp struct {
 }
 
 type reportReq struct {
-	Query    *calendarQuery
-	Multiget *calendarMultiget
+	Query                   *calendarQuery
+	Multiget                *calendarMultiget
+	PrincipalPropertySearch *internal.PrincipalPropertySearch
 	// TODO: CALDAV:free-busy-query
 }
 
@@ -229,6 +277,9 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	case calendarMultigetName:
 		r.Multiget = &calendarMultiget{}
 		v = r.Multiget
+	case internal.PrincipalPropertySearchName:
+		r.PrincipalPropertySearch = &internal.PrincipalPropertySearch{}
+		v = r.PrincipalPropertySearch
 	default:
 		return fmt.Errorf("caldav: unsupported REPORT root %q %q", start.Name.Space, start.Name.Local)
 	}
@@ -0,0 +1,49 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http/httptest"
+	"testing"
+)
+
+func fuzzHandler(f *testing.F, method, depth string, seeds ...string) {
+	cal := Calendar{Path: "/user/calendars/cal/"}
+	h := Handler{Backend: &propertyStoreBackend{
+		testBackend: testBackend{calendars: []Calendar{cal}},
+		props:       make(map[xml.Name]string),
+	}}
+
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(method, cal.Path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", depth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if code := w.Result().StatusCode; code >= 500 {
+			t.Errorf("got status %v", code)
+		}
+	})
+}
+
+func FuzzReport(f *testing.F) {
+	fuzzHandler(f, "REPORT", "1",
+		`<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/></d:prop>`+
+			`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"><c:time-range start="20060104T000000Z" end="20060105T000000Z"/>`+
+			`<c:prop-filter name="SUMMARY"><c:text-match collation="i;octet" negate-condition="yes">x</c:text-match></c:prop-filter>`+
+			`</c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`,
+		`<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-data><c:comp name="VCALENDAR"><c:prop name="VERSION"/></c:comp></c:calendar-data></d:prop>`+
+			`<d:href>/user/calendars/cal/a.ics</d:href></c:calendar-multiget>`,
+		`<d:sync-collection xmlns:d="DAV:"><d:sync-token/><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`,
+	)
+}
+
+func FuzzPropPatch(f *testing.F) {
+	fuzzHandler(f, "PROPPATCH", "0",
+		`<d:propertyupdate xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/"><d:set><d:prop><a:calendar-color>#FF0000</a:calendar-color></d:prop></d:set></d:propertyupdate>`,
+		`<d:propertyupdate xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/"><d:remove><d:prop><a:calendar-order/></d:prop></d:remove></d:propertyupdate>`,
+	)
+}
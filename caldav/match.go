@@ -1,15 +1,48 @@
 package caldav
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
 )
 
+// MatchOptions contains options for FilterWithOptions and MatchWithOptions.
+type MatchOptions struct {
+	// Timezones resolves TZID parameters. If nil, the Go time zone database
+	// is used.
+	Timezones TimezoneProvider
+	// Location is used to interpret floating date and times. If nil, the
+	// location of the time range is used.
+	Location *time.Location
+	// MaxRecurrenceInstances limits the number of instances of a recurring
+	// component expanded to evaluate a time range, protecting against
+	// components recurring e.g. every second. Components exceeding the limit
+	// make matching fail with a 403 Forbidden error carrying a CALDAV:
+	// max-instances precondition. If zero, 10000 is used. If negative, there
+	// is no limit.
+	MaxRecurrenceInstances int
+}
+
+const defaultMaxRecurrenceInstances = 10000
+
+func (opts *MatchOptions) maxRecurrenceInstances() int {
+	if opts.MaxRecurrenceInstances == 0 {
+		return defaultMaxRecurrenceInstances
+	}
+	return opts.MaxRecurrenceInstances
+}
+
 // Filter returns the filtered list of calendar objects matching the provided query.
 // A nil query will return the full list of calendar objects.
 func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error) {
+	return FilterWithOptions(query, cos, nil)
+}
+
+// FilterWithOptions is like Filter, but with custom options.
+func FilterWithOptions(query *CalendarQuery, cos []CalendarObject, opts *MatchOptions) ([]CalendarObject, error) {
 	if query == nil {
 		// FIXME: should we always return a copy of the provided slice?
 		return cos, nil
@@ -17,7 +50,7 @@ func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error
 
 	var out []CalendarObject
 	for _, co := range cos {
-		ok, err := Match(query.CompFilter, &co)
+		ok, err := MatchWithOptions(query.CompFilter, &co, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -33,20 +66,36 @@ func Filter(query *CalendarQuery, cos []CalendarObject) ([]CalendarObject, error
 
 // Match reports whether the provided CalendarObject matches the query.
 func Match(query CompFilter, co *CalendarObject) (matched bool, err error) {
+	return MatchWithOptions(query, co, nil)
+}
+
+// MatchWithOptions is like Match, but with custom options.
+func MatchWithOptions(query CompFilter, co *CalendarObject, opts *MatchOptions) (matched bool, err error) {
 	if co.Data == nil || co.Data.Component == nil {
 		panic("request to process empty calendar object")
 	}
-	return match(query, co.Data.Component)
+	if opts == nil {
+		opts = new(MatchOptions)
+	}
+
+	tz := opts.Timezones
+	if tz == nil {
+		tz = TimezoneMap(nil)
+	}
+	comp, err := resolveTimezones(co.Data.Component, tz)
+	if err != nil {
+		return false, err
+	}
+	return match(query, comp, opts)
 }
 
-func match(filter CompFilter, comp *ical.Component) (bool, error) {
+func match(filter CompFilter, comp *ical.Component, opts *MatchOptions) (bool, error) {
 	if comp.Name != filter.Name {
 		return filter.IsNotDefined, nil
 	}
 
-	var zeroDate time.Time
-	if filter.Start != zeroDate {
-		match, err := matchCompTimeRange(filter.Start, filter.End, comp)
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		match, err := matchCompTimeRange(filter.Start, filter.End, comp, opts)
 		if err != nil {
 			return false, err
 		}
@@ -55,7 +104,7 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 	for _, compFilter := range filter.Comps {
-		match, err := matchCompFilter(compFilter, comp)
+		match, err := matchCompFilter(compFilter, comp, opts)
 		if err != nil {
 			return false, err
 		}
@@ -64,7 +113,7 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 	for _, propFilter := range filter.Props {
-		match, err := matchPropFilter(propFilter, comp)
+		match, err := matchPropFilter(propFilter, comp, opts.Location)
 		if err != nil {
 			return false, err
 		}
@@ -75,11 +124,11 @@ func match(filter CompFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchCompFilter(filter CompFilter, comp *ical.Component) (bool, error) {
+func matchCompFilter(filter CompFilter, comp *ical.Component, opts *MatchOptions) (bool, error) {
 	var matches []*ical.Component
 
 	for _, child := range comp.Children {
-		match, err := match(filter, child)
+		match, err := match(filter, child, opts)
 		if err != nil {
 			return false, err
 		} else if match {
@@ -92,7 +141,7 @@ func matchCompFilter(filter CompFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
+func matchPropFilter(filter PropFilter, comp *ical.Component, loc *time.Location) (bool, error) {
 	// TODO: this only matches first field, there can be multiple
 	field := comp.Props.Get(filter.Name)
 	if field == nil {
@@ -105,9 +154,8 @@ func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
 		}
 	}
 
-	var zeroDate time.Time
-	if filter.Start != zeroDate {
-		match, err := matchPropTimeRange(filter.Start, filter.End, field)
+	if !filter.Start.IsZero() || !filter.End.IsZero() {
+		match, err := matchPropTimeRange(filter.Start, filter.End, field, loc)
 		if err != nil {
 			return false, err
 		}
@@ -124,18 +172,33 @@ func matchPropFilter(filter PropFilter, comp *ical.Component) (bool, error) {
 	return true, nil
 }
 
-func matchCompTimeRange(start, end time.Time, comp *ical.Component) (bool, error) {
+// timeRangeLocation returns the location of a time range, whose start or end
+// may be zero.
+func timeRangeLocation(start, end time.Time) *time.Location {
+	if start.IsZero() {
+		return end.Location()
+	}
+	return start.Location()
+}
+
+// matchCompTimeRange reports whether a component overlaps a time range. A
+// zero start or end leaves the time range unbounded in that direction.
+func matchCompTimeRange(start, end time.Time, comp *ical.Component, opts *MatchOptions) (bool, error) {
 	// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
 
+	loc := opts.Location
+	if loc == nil {
+		loc = timeRangeLocation(start, end)
+	}
+
 	// evaluate recurring components
-	rset, err := comp.RecurrenceSet(start.Location())
+	rset, err := comp.RecurrenceSet(loc)
 	if err != nil {
 		return false, err
 	}
 	if rset != nil {
-		// TODO we can only set inclusive to true or false, but really the
-		// start time is inclusive while the end time is not :/
-		return len(rset.Between(start, end, true)) > 0, nil
+		// TODO: the start time is inclusive, but the end time shouldn't be
+		return matchRecurrenceTimeRange(rset.Iterator(), start, end, opts.maxRecurrenceInstances())
 	}
 
 	// TODO handle more than just events
@@ -144,11 +207,11 @@ func matchCompTimeRange(start, end time.Time, comp *ical.Component) (bool, error
 	}
 	event := ical.Event{comp}
 
-	eventStart, err := event.DateTimeStart(start.Location())
+	eventStart, err := event.DateTimeStart(loc)
 	if err != nil {
 		return false, err
 	}
-	eventEnd, err := event.DateTimeEnd(end.Location())
+	eventEnd, err := event.DateTimeEnd(loc)
 	if err != nil {
 		return false, err
 	}
@@ -168,10 +231,32 @@ func matchCompTimeRange(start, end time.Time, comp *ical.Component) (bool, error
 	return false, nil
 }
 
-func matchPropTimeRange(start, end time.Time, field *ical.Prop) (bool, error) {
+// matchRecurrenceTimeRange reports whether one of the instances of a
+// recurrence set returned by next is in a time range. Instances are expanded
+// in order, until one is found or the end of the time range is reached. The
+// recurrence set may be infinite.
+func matchRecurrenceTimeRange(next func() (time.Time, bool), start, end time.Time, max int) (bool, error) {
+	for n := 1; ; n++ {
+		t, ok := next()
+		if !ok || (!end.IsZero() && t.After(end)) {
+			return false, nil
+		}
+		if max > 0 && n > max {
+			return false, newContentError(PreconditionMaxInstances, fmt.Errorf("caldav: recurrence expands to more than %v instances", max))
+		}
+		if !t.Before(start) {
+			return true, nil
+		}
+	}
+}
+
+func matchPropTimeRange(start, end time.Time, field *ical.Prop, loc *time.Location) (bool, error) {
 	// See https://datatracker.ietf.org/doc/html/rfc4791#section-9.9
 
-	ptime, err := field.DateTime(start.Location())
+	if loc == nil {
+		loc = timeRangeLocation(start, end)
+	}
+	ptime, err := field.DateTime(loc)
 	if err != nil {
 		return false, err
 	}
@@ -196,8 +281,8 @@ func matchParamFilter(filter ParamFilter, field *ical.Prop) bool {
 }
 
 func matchTextMatch(txt TextMatch, value string) bool {
-	// TODO: handle text-match collation attribute
-	match := strings.Contains(value, txt.Text)
+	text := internal.FoldCollation(txt.Collation, txt.Text)
+	match := strings.Contains(internal.FoldCollation(txt.Collation, value), text)
 	if txt.NegateCondition {
 		match = !match
 	}
@@ -1,12 +1,15 @@
 package caldav
 
 import (
+	"errors"
+	"net/http"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/internal"
 )
 
 var dateFormat = "20060102T150405Z"
@@ -160,6 +163,19 @@ ACTION:AUDIO
 TRIGGER;RELATED=START:-PT10M
 END:VALARM
 END:VTODO
+END:VCALENDAR`)
+
+	weekly := newCO(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001102Z
+DTSTART:20060105T090000Z
+DURATION:PT1H
+RRULE:FREQ=WEEKLY
+SUMMARY:Weekly meeting
+UID:4A6C1F7E3C2B9D8E@example.com
+END:VEVENT
 END:VCALENDAR`)
 
 	for _, tc := range []struct {
@@ -270,6 +286,40 @@ END:VCALENDAR`)
 			addrs: []CalendarObject{event1, event2, event3, todo1},
 			want:  []CalendarObject{event1},
 		},
+		{
+			name: "events by description substring, case-insensitive",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Props: []PropFilter{{
+							Name:      "Description",
+							TextMatch: &TextMatch{Text: "STEELERS"},
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event2, event3, todo1},
+			want:  []CalendarObject{event1},
+		},
+		{
+			name: "events by description substring, octet collation",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{{
+						Name: "VEVENT",
+						Props: []PropFilter{{
+							Name:      "Description",
+							TextMatch: &TextMatch{Text: "STEELERS", Collation: "i;octet"},
+						}},
+					}},
+				},
+			},
+			addrs: []CalendarObject{event1, event2, event3, todo1},
+			want:  nil,
+		},
 		{
 			// Query a time range that only returns a result if recurrence is properly evaluated.
 			name: "recurring events in time range",
@@ -288,6 +338,38 @@ END:VCALENDAR`)
 			addrs: []CalendarObject{event1, event2, event3, todo1},
 			want:  []CalendarObject{event2},
 		},
+		{
+			name: "events after now",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{
+						CompFilter{
+							Name:  "VEVENT",
+							Start: time.Now(),
+						},
+					},
+				},
+			},
+			addrs: []CalendarObject{event1, event2, event3, weekly, todo1},
+			want:  []CalendarObject{weekly},
+		},
+		{
+			name: "events before a date (no start date)",
+			query: &CalendarQuery{
+				CompFilter: CompFilter{
+					Name: "VCALENDAR",
+					Comps: []CompFilter{
+						CompFilter{
+							Name: "VEVENT",
+							End:  toDate(t, "20060103T000000Z"),
+						},
+					},
+				},
+			},
+			addrs: []CalendarObject{event1, event2, event3, weekly, todo1},
+			want:  []CalendarObject{event1, event2},
+		},
 		// TODO add more examples
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -309,3 +391,112 @@ END:VCALENDAR`)
 		})
 	}
 }
+
+func TestMatchTimezones(t *testing.T) {
+	newCO := func(dtstart string) *CalendarObject {
+		cal, err := ical.NewDecoder(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example Corp.//CalDAV Client//EN\r\n" +
+			"BEGIN:VEVENT\r\nUID:1@example.com\r\nDTSTAMP:20060206T001102Z\r\n" + dtstart + "\r\nDURATION:PT1H\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &CalendarObject{Data: cal}
+	}
+
+	// 08:00 UTC to 08:30 UTC
+	query := CompFilter{
+		Name: "VCALENDAR",
+		Comps: []CompFilter{{
+			Name:  "VEVENT",
+			Start: toDate(t, "20060104T075900Z"),
+			End:   toDate(t, "20060104T083000Z"),
+		}},
+	}
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		dtstart string
+		opts    *MatchOptions
+		want    bool
+	}{
+		{"utc", "DTSTART:20060104T080000Z", nil, true},
+		{"tzdata", "DTSTART;TZID=Europe/Paris:20060104T090000", nil, true},
+		{"map", "DTSTART;TZID=Romance Standard Time:20060104T090000", &MatchOptions{Timezones: TimezoneMap{"Romance Standard Time": paris}}, true},
+		{"fixed", "DTSTART;TZID=Custom:20060104T100000", &MatchOptions{Timezones: TimezoneMap{"Custom": time.FixedZone("Custom", 2*60*60)}}, true},
+		{"floating", "DTSTART:20060104T090000", &MatchOptions{Location: paris}, true},
+		{"floating-utc", "DTSTART:20060104T090000", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := MatchWithOptions(query, newCO(tc.dtstart), tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	_, err = Match(query, newCO("DTSTART;TZID=Unknown/Zone:20060104T090000"))
+	var httpErr *internal.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusForbidden {
+		t.Errorf("got error %v, want a valid-calendar-data error", err)
+	}
+}
+
+func TestMatchMaxRecurrenceInstances(t *testing.T) {
+	newCO := func(rrule string) *CalendarObject {
+		cal, err := ical.NewDecoder(strings.NewReader(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example Corp.//CalDAV Client//EN
+BEGIN:VEVENT
+DTSTAMP:20060206T001102Z
+DTSTART:20000101T000000Z
+DURATION:PT1S
+RRULE:` + rrule + `
+UID:2E1C5A3B7F9D4E60@example.com
+END:VEVENT
+END:VCALENDAR`)).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &CalendarObject{Data: cal}
+	}
+
+	query := CompFilter{
+		Name: "VCALENDAR",
+		Comps: []CompFilter{{
+			Name:  "VEVENT",
+			Start: toDate(t, "20060104T000000Z"),
+			End:   toDate(t, "20060105T000000Z"),
+		}},
+	}
+
+	_, err := Match(query, newCO("FREQ=SECONDLY"))
+	var httpErr *internal.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusForbidden {
+		t.Errorf("got error %v, want a max-instances error", err)
+	}
+
+	for _, tc := range []struct {
+		max     int
+		wantErr bool
+	}{
+		{2000, true},
+		{3000, false},
+		{-1, false},
+	} {
+		got, err := MatchWithOptions(query, newCO("FREQ=DAILY"), &MatchOptions{MaxRecurrenceInstances: tc.max})
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("MaxRecurrenceInstances = %v: expected an error", tc.max)
+			}
+		} else if err != nil || !got {
+			t.Errorf("MaxRecurrenceInstances = %v: got %v, %v, want true", tc.max, got, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/internal"
+)
+
+// defaultCalendarColor is returned for calendars without a stored
+// calendar-color property.
+const defaultCalendarColor = "#0082C9FF"
+
+// calendarColorRegexp matches the #RRGGBB and #RRGGBBAA formats used by
+// clients.
+var calendarColorRegexp = regexp.MustCompile(`^#[0-9A-Fa-f]{6}([0-9A-Fa-f]{2})?$`)
+
+// calendarProps adds the calendar-color and calendar-order properties to
+// props. These properties are defined by Apple and read by most clients. They
+// can be set with PROPPATCH requests if the Backend implements
+// webdav.PropertyStore, and are stored as strings. The store is only called if
+// one of the properties is requested.
+func (b *backend) calendarProps(ctx context.Context, cal *Calendar, props map[xml.Name]internal.PropFindFunc) {
+	var (
+		stored map[xml.Name]string
+		err    error
+		done   bool
+	)
+	storedProps := func() (map[xml.Name]string, error) {
+		if store, ok := b.Backend.(webdav.PropertyStore); ok && !done {
+			stored, err = store.Properties(ctx, cal.Path)
+			done = true
+		}
+		return stored, err
+	}
+
+	props[calendarColorName] = func(*internal.RawXMLValue) (interface{}, error) {
+		stored, err := storedProps()
+		if err != nil {
+			return nil, err
+		}
+		color, ok := stored[calendarColorName]
+		if !ok {
+			color = defaultCalendarColor
+		}
+		return &calendarColor{Color: color}, nil
+	}
+	props[calendarOrderName] = func(*internal.RawXMLValue) (interface{}, error) {
+		stored, err := storedProps()
+		if err != nil {
+			return nil, err
+		}
+		order, _ := strconv.Atoi(stored[calendarOrderName])
+		return &calendarOrder{Order: order}, nil
+	}
+}
+
+func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*internal.Response, error) {
+	store, _ := b.Backend.(webdav.PropertyStore)
+	isCalendar := b.resourceTypeAtPath(r.URL.Path) == resourceTypeCalendar
+
+	p := r.URL.Path
+	if isCalendar {
+		cal, err := b.Backend.GetCalendar(r.Context(), r.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		p = cal.Path
+	}
+
+	resp := internal.NewOKResponse(p)
+
+	set := make(map[xml.Name]string)
+	var remove []xml.Name
+	for _, s := range update.Set {
+		for _, raw := range s.Prop.Raw {
+			xmlName, ok := raw.XMLName()
+			if !ok {
+				continue
+			}
+
+			code := http.StatusForbidden
+			if store != nil && isCalendar {
+				var value string
+				var err error
+				code, value, err = propPatchCalendarSet(&raw)
+				if err != nil {
+					return nil, err
+				} else if code == http.StatusOK {
+					set[xmlName] = value
+				}
+			}
+
+			emptyVal := internal.NewRawXMLElement(xmlName, nil, nil)
+			if err := resp.EncodeProp(code, emptyVal); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, rm := range update.Remove {
+		for _, raw := range rm.Prop.Raw {
+			xmlName, ok := raw.XMLName()
+			if !ok {
+				continue
+			}
+
+			code := http.StatusForbidden
+			if store != nil && isCalendar && (xmlName == calendarColorName || xmlName == calendarOrderName) {
+				code = http.StatusOK
+				remove = append(remove, xmlName)
+			}
+
+			emptyVal := internal.NewRawXMLElement(xmlName, nil, nil)
+			if err := resp.EncodeProp(code, emptyVal); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(resp.PropStats) == 0 {
+		return nil, internal.HTTPErrorf(http.StatusBadRequest,
+			"caldav: request missing properties to update")
+	}
+
+	if internal.FailPropPatchDependencies(resp) || (len(set) == 0 && len(remove) == 0) {
+		return resp, nil
+	}
+	if err := store.PatchProperties(r.Context(), p, set, remove); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// propPatchCalendarSet validates a calendar property set by a PROPPATCH
+// request, and returns the status of the update and the value to store.
+func propPatchCalendarSet(raw *internal.RawXMLValue) (int, string, error) {
+	name, _ := raw.XMLName()
+	switch name {
+	case calendarColorName:
+		var prop calendarColor
+		if err := raw.Decode(&prop); err != nil {
+			return 0, "", err
+		}
+		color := strings.TrimSpace(prop.Color)
+		if !calendarColorRegexp.MatchString(color) {
+			return http.StatusConflict, "", nil
+		}
+		return http.StatusOK, color, nil
+	case calendarOrderName:
+		var s struct {
+			Order string `xml:",chardata"`
+		}
+		if err := raw.Decode(&s); err != nil {
+			return 0, "", err
+		}
+		order, err := strconv.Atoi(strings.TrimSpace(s.Order))
+		if err != nil {
+			return http.StatusConflict, "", nil
+		}
+		return http.StatusOK, strconv.Itoa(order), nil
+	default:
+		return http.StatusForbidden, "", nil
+	}
+}
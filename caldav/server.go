@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
 	"strings"
@@ -25,6 +27,13 @@ type PutCalendarObjectOptions struct {
 	// IfMatch provides the ETag of the resource that the client intends
 	// to overwrite, can be ""
 	IfMatch webdav.ConditionalMatch
+	// IfScheduleTagMatch provides the schedule tag of the resource that the
+	// client intends to overwrite, can be "". It's checked against
+	// CalendarObject.ScheduleTag before PutCalendarObject is called. Since
+	// the schedule tag can change in between, e.g. when the server delivers
+	// an organizer update to an attendee, backends should check it again
+	// atomically and fail with 412 Precondition Failed if it doesn't match.
+	IfScheduleTagMatch webdav.ConditionalMatch
 }
 
 // Backend is a CalDAV server backend.
@@ -49,6 +58,35 @@ type Backend interface {
 type Handler struct {
 	Backend Backend
 	Prefix  string
+
+	// MaxResourceSize is the maximum size in bytes of calendar objects uploaded
+	// with PUT. Calendar.MaxResourceSize can further restrict the size for a
+	// given calendar. Larger objects are rejected with 403 Forbidden and the
+	// CALDAV:max-resource-size precondition, and the limit is advertised in
+	// PROPFIND responses. If zero, the size is unlimited.
+	MaxResourceSize int64
+	// MaxContentLines is the maximum number of iCalendar content lines,
+	// including BEGIN and END lines, of calendar objects uploaded with PUT. It
+	// limits the number of components and properties. If zero, the number of
+	// lines is unlimited.
+	MaxContentLines int
+	// StrictParsing enables strict parsing of calendar objects uploaded with
+	// PUT. Objects containing malformed content lines, even if tolerated by
+	// the iCalendar decoder, are rejected, and objects must satisfy the
+	// constraints of RFC 4791 section 4.1, see ValidateCalendarObject.
+	StrictParsing bool
+	// MaxMultigetHrefs limits the number of hrefs in calendar-multiget REPORT
+	// requests. Larger requests are rejected with 507 Insufficient Storage
+	// and the DAV:number-of-matches-within-limits precondition. Zero means no
+	// limit.
+	MaxMultigetHrefs int
+	// MaxFilterDepth limits the nesting depth of comp-filter elements in
+	// calendar-query REPORT requests. Deeper filters are rejected with 400
+	// Bad Request. Zero means no limit.
+	MaxFilterDepth int
+	// NamespacePrefixes overrides the XML namespace prefixes used in
+	// responses, see webdav.Handler.NamespacePrefixes.
+	NamespacePrefixes map[string]string
 }
 
 // ServeHTTP implements http.Handler.
@@ -69,38 +107,71 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var err error
-	switch r.Method {
-	case "REPORT":
-		err = h.handleReport(w, r)
-	default:
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
-		hh := internal.Handler{Backend: &b}
-		hh.ServeHTTP(w, r)
-	}
-
-	if err != nil {
-		internal.ServeError(w, err)
+	b := backend{
+		Backend:          h.Backend,
+		Prefix:           strings.TrimSuffix(h.Prefix, "/"),
+		MaxResourceSize:  h.MaxResourceSize,
+		MaxContentLines:  h.MaxContentLines,
+		StrictParsing:    h.StrictParsing,
+		MaxMultigetHrefs: h.MaxMultigetHrefs,
+		MaxFilterDepth:   h.MaxFilterDepth,
 	}
+	hh := internal.Handler{Backend: &b, NamespacePrefixes: h.NamespacePrefixes}
+	hh.ServeHTTP(w, r)
 }
 
-func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
+func (b *backend) Report(w http.ResponseWriter, r *http.Request, depth internal.Depth) error {
 	var report reportReq
-	if err := internal.DecodeXMLRequest(r, &report); err != nil {
+	if err := internal.DecodeXMLRequestWithLimits(r, &report, b.reportLimits()); err != nil {
 		return err
 	}
 
 	if report.Query != nil {
-		return h.handleQuery(r, w, report.Query)
+		return b.handleQuery(r, w, report.Query, depth)
 	} else if report.Multiget != nil {
-		return h.handleMultiget(r.Context(), w, report.Multiget)
+		return b.handleMultiget(r, w, report.Multiget)
+	} else if report.PrincipalPropertySearch != nil {
+		return b.handlePrincipalSearch(r, w, report.PrincipalPropertySearch)
 	}
 	return internal.HTTPErrorf(http.StatusBadRequest, "caldav: expected calendar-query or calendar-multiget element in REPORT request")
 }
 
+func decodePrincipalSearch(el *internal.PrincipalPropertySearch) *webdav.PrincipalSearchQuery {
+	query := &webdav.PrincipalSearchQuery{AnyOf: el.Test == "anyof"}
+	for _, ps := range el.PropertySearch {
+		match := webdav.PrincipalPropMatch{Text: ps.Match}
+		for _, raw := range ps.Prop.Raw {
+			if name, ok := raw.XMLName(); ok {
+				match.Props = append(match.Props, name)
+			}
+		}
+		query.Matches = append(query.Matches, match)
+	}
+	return query
+}
+
+func (b *backend) handlePrincipalSearch(r *http.Request, w http.ResponseWriter, search *internal.PrincipalPropertySearch) error {
+	searcher, ok := b.Backend.(webdav.PrincipalSearcher)
+	if !ok {
+		return internal.HTTPErrorf(http.StatusForbidden, "caldav: principal-property-search not supported")
+	}
+
+	principals, err := searcher.SearchPrincipals(r.Context(), decodePrincipalSearch(search))
+	if err != nil {
+		return err
+	}
+
+	var resps []internal.Response
+	for _, p := range principals {
+		resp, err := propFindSearchedPrincipal(search.Prop, &p)
+		if err != nil {
+			return err
+		}
+		resps = append(resps, *resp)
+	}
+	return internal.ServeMultiStatus(w, internal.NewMultiStatus(resps...))
+}
+
 func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 	pf := &ParamFilter{Name: el.Name}
 	if el.IsNotDefined != nil {
@@ -110,7 +181,11 @@ func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = &TextMatch{Text: el.TextMatch.Text}
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	return pf, nil
 }
@@ -124,7 +199,11 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = &TextMatch{Text: el.TextMatch.Text}
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	if el.TimeRange != nil {
 		pf.Start = time.Time(el.TimeRange.Start)
@@ -140,6 +219,38 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 	return pf, nil
 }
 
+// reportLimits returns the limits enforced while decoding REPORT requests.
+func (b *backend) reportLimits() []internal.XMLElementLimit {
+	var limits []internal.XMLElementLimit
+	if b.MaxMultigetHrefs > 0 {
+		limits = append(limits, internal.XMLElementLimit{
+			Name:     internal.HrefName,
+			Parent:   calendarMultigetName,
+			MaxCount: b.MaxMultigetHrefs,
+			Err:      internal.NewNumberOfMatchesError(),
+		})
+	}
+	if b.MaxFilterDepth > 0 {
+		limits = append(limits, internal.XMLElementLimit{
+			Name:     compFilterName,
+			MaxDepth: b.MaxFilterDepth,
+			Err:      internal.HTTPErrorf(http.StatusBadRequest, "caldav: comp-filter nested deeper than %v levels", b.MaxFilterDepth),
+		})
+	}
+	return limits
+}
+
+func decodeTextMatch(el *textMatch) (*TextMatch, error) {
+	if !internal.IsSupportedCollation(el.Collation) {
+		return nil, newPreconditionError(http.StatusForbidden, PreconditionSupportedCollation)
+	}
+	return &TextMatch{
+		Text:            el.Text,
+		NegateCondition: bool(el.NegateCondition),
+		Collation:       el.Collation,
+	}, nil
+}
+
 func decodeCompFilter(el *compFilter) (*CompFilter, error) {
 	cf := &CompFilter{Name: el.Name}
 	if el.IsNotDefined != nil {
@@ -207,7 +318,7 @@ func decodeCalendarDataReq(calendarData *calendarDataReq) (*CalendarCompRequest,
 	return decodeComp(calendarData.Comp)
 }
 
-func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *calendarQuery) error {
+func (b *backend) handleQuery(r *http.Request, w http.ResponseWriter, query *calendarQuery, depth internal.Depth) error {
 	var q CalendarQuery
 	// TODO: calendar-data in query.Prop
 	cf, err := decodeCompFilter(&query.Filter.CompFilter)
@@ -216,17 +327,13 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *cal
 	}
 	q.CompFilter = *cf
 
-	cos, err := h.Backend.QueryCalendarObjects(r.Context(), r.URL.Path, &q)
+	cos, err := b.queryCalendarObjects(r, &q, depth)
 	if err != nil {
 		return err
 	}
 
 	var resps []internal.Response
 	for _, co := range cos {
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
 		propfind := internal.PropFind{
 			Prop:     query.Prop,
 			AllProp:  query.AllProp,
@@ -241,15 +348,46 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *cal
 
 	ms := internal.NewMultiStatus(resps...)
 
-	return internal.ServeMultiStatus(w, ms)
+	return internal.ServePropFindMultiStatus(w, r, ms)
 }
 
-func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, multiget *calendarMultiget) error {
+// queryCalendarObjects runs a calendar query on the request URI. With
+// "Depth: 0", the query only applies to the request URI itself: a calendar
+// object is matched against the query, and a calendar never matches.
+// Queries on collections without a Depth header apply to their members, as
+// most clients omit it.
+func (b *backend) queryCalendarObjects(r *http.Request, q *CalendarQuery, depth internal.Depth) ([]CalendarObject, error) {
+	isObject := b.resourceTypeAtPath(r.URL.Path) == resourceTypeCalendarObject
+	if depth == internal.DepthZero && r.Header.Get("Depth") == "" && !isObject {
+		depth = internal.DepthOne
+	}
+	if depth != internal.DepthZero {
+		return b.Backend.QueryCalendarObjects(r.Context(), r.URL.Path, q)
+	}
+	if !isObject {
+		return nil, nil
+	}
+
+	co, err := b.Backend.GetCalendarObject(r.Context(), r.URL.Path, &CalendarCompRequest{AllProps: true, AllComps: true})
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := Match(q.CompFilter, co); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, nil
+	}
+	return []CalendarObject{*co}, nil
+}
+
+func (b *backend) handleMultiget(r *http.Request, w http.ResponseWriter, multiget *calendarMultiget) error {
+	ctx := r.Context()
+
 	var dataReq CalendarCompRequest
 	if multiget.Prop != nil {
 		var calendarData calendarDataReq
 		if err := multiget.Prop.Decode(&calendarData); err != nil && !internal.IsNotFound(err) {
-			return err
+			return &internal.HTTPError{Code: http.StatusBadRequest, Err: err}
 		}
 		decoded, err := decodeCalendarDataReq(&calendarData)
 		if err != nil {
@@ -260,17 +398,13 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 
 	var resps []internal.Response
 	for _, href := range multiget.Hrefs {
-		co, err := h.Backend.GetCalendarObject(ctx, href.Path, &dataReq)
+		co, err := b.Backend.GetCalendarObject(ctx, href.Path, &dataReq)
 		if err != nil {
 			resp := internal.NewErrorResponse(href.Path, err)
 			resps = append(resps, *resp)
 			continue
 		}
 
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
 		propfind := internal.PropFind{
 			Prop:     multiget.Prop,
 			AllProp:  multiget.AllProp,
@@ -284,12 +418,17 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 	}
 
 	ms := internal.NewMultiStatus(resps...)
-	return internal.ServeMultiStatus(w, ms)
+	return internal.ServePropFindMultiStatus(w, r, ms)
 }
 
 type backend struct {
-	Backend Backend
-	Prefix  string
+	Backend          Backend
+	Prefix           string
+	MaxResourceSize  int64
+	MaxContentLines  int
+	StrictParsing    bool
+	MaxMultigetHrefs int
+	MaxFilterDepth   int
 }
 
 type resourceType int
@@ -314,16 +453,33 @@ func (b *backend) resourceTypeAtPath(reqPath string) resourceType {
 	return resourceType(len(strings.Split(p, "/")) - 1)
 }
 
+// collectionReports are the reports supported by calendars.
+var collectionReports = []xml.Name{calendarQueryName, calendarMultigetName}
+
+func (b *backend) SupportedReports(path string) []xml.Name {
+	switch b.resourceTypeAtPath(path) {
+	case resourceTypeCalendar:
+		return collectionReports
+	case resourceTypeRoot, resourceTypeUserPrincipal:
+		if _, ok := b.Backend.(webdav.PrincipalSearcher); ok {
+			return []xml.Name{internal.PrincipalPropertySearchName}
+		}
+	}
+	return nil
+}
+
 func (b *backend) Options(r *http.Request) (caps []string, allow []string, err error) {
 	caps = []string{"calendar-access"}
 
-	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendarObject {
+	if t := b.resourceTypeAtPath(r.URL.Path); t == resourceTypeCalendar {
+		return caps, []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL", http.MethodPost}, nil
+	} else if t != resourceTypeCalendarObject {
 		return caps, []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL"}, nil
 	}
 
 	var dataReq CalendarCompRequest
 	_, err = b.Backend.GetCalendarObject(r.Context(), r.URL.Path, &dataReq)
-	if httpErr, ok := err.(*internal.HTTPError); ok && httpErr.Code == http.StatusNotFound {
+	if internal.IsNotFound(err) {
 		return caps, []string{http.MethodOptions, http.MethodPut}, nil
 	} else if err != nil {
 		return nil, nil, err
@@ -356,6 +512,9 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 	if co.ETag != "" {
 		w.Header().Set("ETag", internal.ETag(co.ETag).String())
 	}
+	if co.ScheduleTag != "" {
+		w.Header().Set("Schedule-Tag", internal.ETag(co.ScheduleTag).String())
+	}
 	if !co.ModTime.IsZero() {
 		w.Header().Set("Last-Modified", co.ModTime.UTC().Format(http.TimeFormat))
 	}
@@ -492,9 +651,39 @@ func (b *backend) propFindUserPrincipal(ctx context.Context, propfind *internal.
 		}),
 		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.CollectionName, internal.PrincipalName)),
 	}
+	if reports := b.SupportedReports(principalPath); len(reports) > 0 {
+		props[internal.SupportedReportSetName] = internal.PropFindValue(internal.NewSupportedReportSet(reports...))
+	}
 	return internal.NewPropFindResponse(principalPath, propfind, props)
 }
 
+// propFindSearchedPrincipal returns the properties of a principal matching a
+// principal-property-search REPORT request.
+func propFindSearchedPrincipal(prop *internal.Prop, p *webdav.Principal) (*internal.Response, error) {
+	if prop == nil {
+		return internal.NewOKResponse(p.Path), nil
+	}
+
+	props := map[xml.Name]internal.PropFindFunc{
+		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.PrincipalName)),
+	}
+	if p.DisplayName != "" {
+		props[internal.DisplayNameName] = internal.PropFindValue(&internal.DisplayName{Name: p.DisplayName})
+	}
+	if len(p.Addresses) > 0 {
+		set := &calendarUserAddressSet{}
+		for _, addr := range p.Addresses {
+			u, err := url.Parse(addr)
+			if err != nil {
+				return nil, fmt.Errorf("caldav: invalid calendar user address %q: %v", addr, err)
+			}
+			set.Hrefs = append(set.Hrefs, internal.Href(*u))
+		}
+		props[calendarUserAddressSetName] = internal.PropFindValue(set)
+	}
+	return internal.NewPropFindResponse(p.Path, &internal.PropFind{Prop: prop}, props)
+}
+
 func (b *backend) propFindHomeSet(ctx context.Context, propfind *internal.PropFind) (*internal.Response, error) {
 	principalPath, err := b.Backend.CurrentUserPrincipal(ctx)
 	if err != nil {
@@ -517,6 +706,8 @@ func (b *backend) propFindHomeSet(ctx context.Context, propfind *internal.PropFi
 
 func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropFind, cal *Calendar) (*internal.Response, error) {
 	props := map[xml.Name]internal.PropFindFunc{
+		internal.SupportedReportSetName: internal.PropFindValue(internal.NewSupportedReportSet(collectionReports...)),
+		internal.AddMemberName:          internal.PropFindValue(&internal.AddMember{Href: internal.Href{Path: cal.Path}}),
 		internal.CurrentUserPrincipalName: func(*internal.RawXMLValue) (interface{}, error) {
 			path, err := b.Backend.CurrentUserPrincipal(ctx)
 			if err != nil {
@@ -533,14 +724,13 @@ func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropF
 				{ContentType: ical.MIMEType, Version: "2.0"},
 			},
 		}),
+		supportedCollationSetName: internal.PropFindValue(&supportedCollationSet{
+			Collations: internal.Collations,
+		}),
 		supportedCalendarComponentSetName: func(*internal.RawXMLValue) (interface{}, error) {
 			components := []comp{}
-			if cal.SupportedComponentSet != nil {
-				for _, name := range cal.SupportedComponentSet {
-					components = append(components, comp{Name: name})
-				}
-			} else {
-				components = append(components, comp{Name: ical.CompEvent})
+			for _, name := range supportedComponentSet(cal) {
+				components = append(components, comp{Name: name})
 			}
 			return &supportedCalendarComponentSet{
 				Comp: components,
@@ -565,9 +755,10 @@ func (b *backend) propFindCalendar(ctx context.Context, propfind *internal.PropF
 			Description: cal.Description,
 		})
 	}
-	if cal.MaxResourceSize > 0 {
+	b.calendarProps(ctx, cal, props)
+	if size := b.maxResourceSize(cal); size > 0 {
 		props[maxResourceSizeName] = internal.PropFindValue(&maxResourceSize{
-			Size: cal.MaxResourceSize,
+			Size: size,
 		})
 	}
 
@@ -639,6 +830,11 @@ func (b *backend) propFindCalendarObject(ctx context.Context, propfind *internal
 			ETag: internal.ETag(co.ETag),
 		})
 	}
+	if co.ScheduleTag != "" {
+		props[scheduleTagName] = internal.PropFindValue(&scheduleTag{
+			Tag: internal.ETag(co.ScheduleTag),
+		})
+	}
 
 	return internal.NewPropFindResponse(co.Path, propfind, props)
 }
@@ -661,17 +857,76 @@ func (b *backend) propFindAllCalendarObjects(ctx context.Context, propfind *inte
 	return resps, nil
 }
 
-func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*internal.Response, error) {
-	return nil, internal.HTTPErrorf(http.StatusNotImplemented, "caldav: PropPatch not implemented")
+// checkScheduleTag checks the If-Schedule-Tag-Match header against the
+// schedule tag of the existing calendar object, as defined in RFC 6638
+// section 8.3.
+func (b *backend) checkScheduleTag(r *http.Request, ifScheduleTagMatch webdav.ConditionalMatch) error {
+	co, err := b.Backend.GetCalendarObject(r.Context(), r.URL.Path, &CalendarCompRequest{})
+	if internal.IsNotFound(err) {
+		return internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: calendar object %q doesn't exist", r.URL.Path)
+	} else if err != nil {
+		return err
+	}
+
+	ok, err := ifScheduleTagMatch.MatchETag(co.ScheduleTag)
+	if err != nil {
+		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: malformed If-Schedule-Tag-Match header: %v", err)
+	} else if !ok {
+		return internal.HTTPErrorf(http.StatusPreconditionFailed, "caldav: schedule tag of %q doesn't match", r.URL.Path)
+	}
+	return nil
+}
+
+// supportedComponentSet returns the names of the components a calendar can
+// contain. Calendars which don't specify it only contain events.
+func supportedComponentSet(cal *Calendar) []string {
+	if cal.SupportedComponentSet != nil {
+		return cal.SupportedComponentSet
+	}
+	return []string{ical.CompEvent}
+}
+
+// isSupportedCalendarObject checks that all components of a calendar object,
+// except time zones, can be stored in a calendar.
+func isSupportedCalendarObject(cal *Calendar, data *ical.Calendar) bool {
+	supported := supportedComponentSet(cal)
+	for _, child := range data.Children {
+		if child.Name == ical.CompTimezone {
+			continue
+		}
+		ok := false
+		for _, name := range supported {
+			if strings.EqualFold(name, child.Name) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// maxResourceSize returns the maximum size of calendar objects in a calendar: the
+// smallest of the calendar limit and the handler limit. The calendar may be nil.
+func (b *backend) maxResourceSize(cal *Calendar) int64 {
+	size := b.MaxResourceSize
+	if cal != nil && cal.MaxResourceSize > 0 && (size == 0 || cal.MaxResourceSize < size) {
+		size = cal.MaxResourceSize
+	}
+	return size
 }
 
 func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	ifNoneMatch := webdav.ConditionalMatch(r.Header.Get("If-None-Match"))
 	ifMatch := webdav.ConditionalMatch(r.Header.Get("If-Match"))
+	ifScheduleTagMatch := webdav.ConditionalMatch(r.Header.Get("If-Schedule-Tag-Match"))
 
 	opts := PutCalendarObjectOptions{
-		IfNoneMatch: ifNoneMatch,
-		IfMatch:     ifMatch,
+		IfNoneMatch:        ifNoneMatch,
+		IfMatch:            ifMatch,
+		IfScheduleTagMatch: ifScheduleTagMatch,
 	}
 
 	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
@@ -683,14 +938,52 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: unsupported Content-Type %q", t)
 	}
 
-	// TODO: check CALDAV:max-resource-size precondition
-	cal, err := ical.NewDecoder(r.Body).Decode()
+	// Calendar objects added to the calendar itself are named after their
+	// UID
+	objectPath, calendarPath := r.URL.Path, path.Dir(r.URL.Path)
+	addMember := b.resourceTypeAtPath(r.URL.Path) == resourceTypeCalendar
+	if addMember {
+		calendarPath = r.URL.Path
+	}
+
+	// The calendar may not exist, in which case the backend reports the error
+	parent, _ := b.Backend.GetCalendar(r.Context(), calendarPath)
+	maxSize := b.maxResourceSize(parent)
+	if maxSize > 0 && r.ContentLength > maxSize {
+		return newPreconditionError(http.StatusForbidden, PreconditionMaxResourceSize)
+	}
+	body := internal.NewContentLimitReader(r.Body, maxSize, b.MaxContentLines)
+	data, err := io.ReadAll(body)
+	if body.Exceeded() {
+		return newPreconditionError(http.StatusForbidden, PreconditionMaxResourceSize)
+	} else if err != nil {
+		return err
+	}
+	cal, err := b.decodeCalendar(data)
 	if err != nil {
-		// TODO: send CALDAV:valid-calendar-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "caldav: failed to parse iCalendar: %v", err)
+		return err
+	}
+	if parent != nil && !isSupportedCalendarObject(parent, cal) {
+		return newPreconditionError(http.StatusForbidden, PreconditionSupportedCalendarComponent)
 	}
 
-	co, err := b.Backend.PutCalendarObject(r.Context(), r.URL.Path, cal, &opts)
+	if addMember {
+		name, err := ObjectName(cal)
+		if err != nil {
+			return internal.HTTPErrorf(http.StatusBadRequest, "caldav: invalid calendar object: %v", err)
+		}
+		objectPath = path.Join(calendarPath, name)
+		if err := b.checkNoUIDConflict(r.Context(), objectPath); err != nil {
+			return err
+		}
+		opts = PutCalendarObjectOptions{IfNoneMatch: "*"}
+	} else if ifScheduleTagMatch.IsSet() {
+		if err := b.checkScheduleTag(r, ifScheduleTagMatch); err != nil {
+			return err
+		}
+	}
+
+	co, err := b.Backend.PutCalendarObject(r.Context(), objectPath, cal, &opts)
 	if err != nil {
 		return err
 	}
@@ -698,11 +991,14 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	if co.ETag != "" {
 		w.Header().Set("ETag", internal.ETag(co.ETag).String())
 	}
+	if co.ScheduleTag != "" {
+		w.Header().Set("Schedule-Tag", internal.ETag(co.ScheduleTag).String())
+	}
 	if !co.ModTime.IsZero() {
 		w.Header().Set("Last-Modified", co.ModTime.UTC().Format(http.TimeFormat))
 	}
 	if co.Path != "" {
-		w.Header().Set("Location", co.Path)
+		w.Header().Set("Location", (&url.URL{Path: co.Path}).String())
 	}
 
 	// TODO: http.StatusNoContent if the resource already existed
@@ -711,6 +1007,53 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// checkNoUIDConflict checks that no calendar object is stored at the path
+// derived from its UID.
+// decodeCalendar parses a calendar object uploaded with PUT. Malformed
+// objects are rejected with 403 Forbidden and the CALDAV:valid-calendar-data
+// precondition, along with the position of the error.
+func (b *backend) decodeCalendar(data []byte) (*ical.Calendar, error) {
+	if b.StrictParsing {
+		if err := internal.CheckContentSyntax(data); err != nil {
+			return nil, newContentError(PreconditionValidCalendarData, err)
+		}
+	}
+
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		// The decoder doesn't report the position of errors
+		if syntaxErr := internal.CheckContentSyntax(data); syntaxErr != nil {
+			err = syntaxErr
+		}
+		return nil, newContentError(PreconditionValidCalendarData, err)
+	}
+
+	if b.StrictParsing {
+		if _, _, err := ValidateCalendarObject(cal); err != nil {
+			return nil, newContentError(PreconditionValidCalendarObjectResource, err)
+		}
+	}
+	return cal, nil
+}
+
+func (b *backend) checkNoUIDConflict(ctx context.Context, p string) error {
+	_, err := b.Backend.GetCalendarObject(ctx, p, &CalendarCompRequest{})
+	if err == nil {
+		return newPreconditionError(http.StatusForbidden, PreconditionNoUIDConflict)
+	} else if !internal.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Post handles RFC 5995 add-member requests on calendars, see Put.
+func (b *backend) Post(w http.ResponseWriter, r *http.Request) error {
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeCalendar {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "caldav: POST requests must target a calendar")
+	}
+	return b.Put(w, r)
+}
+
 func (b *backend) Delete(r *http.Request) error {
 	return b.Backend.DeleteCalendarObject(r.Context(), r.URL.Path)
 }
@@ -740,14 +1083,6 @@ func (b *backend) Mkcol(r *http.Request) error {
 	return b.Backend.CreateCalendar(r.Context(), &cal)
 }
 
-func (b *backend) Copy(r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "caldav: Copy not implemented")
-}
-
-func (b *backend) Move(r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "caldav: Move not implemented")
-}
-
 // https://datatracker.ietf.org/doc/html/rfc4791#section-5.3.2.1
 type PreconditionType string
 
@@ -763,13 +1098,25 @@ const (
 	PreconditionMaxDateTime                  PreconditionType = "max-date-time"
 	PreconditionMaxInstances                 PreconditionType = "max-instances"
 	PreconditionMaxAttendeesPerInstance      PreconditionType = "max-attendees-per-instance"
+	PreconditionSupportedCollation           PreconditionType = "supported-collation"
 )
 
 func NewPreconditionError(err PreconditionType) error {
+	return newPreconditionError(http.StatusConflict, err)
+}
+
+// newContentError returns a 403 Forbidden precondition error describing a
+// malformed calendar object.
+func newContentError(precondition PreconditionType, err error) error {
+	name := xml.Name{Space: "urn:ietf:params:xml:ns:caldav", Local: string(precondition)}
+	return internal.NewContentHTTPError(http.StatusForbidden, name, err)
+}
+
+func newPreconditionError(code int, err PreconditionType) error {
 	name := xml.Name{Space: "urn:ietf:params:xml:ns:caldav", Local: string(err)}
 	elem := internal.NewRawXMLElement(name, nil, nil)
 	return &internal.HTTPError{
-		Code: 409,
+		Code: code,
 		Err: &internal.Error{
 			Raw: []internal.RawXMLValue{*elem},
 		},
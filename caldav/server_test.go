@@ -2,15 +2,20 @@ package caldav
 
 import (
 	"context"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/internal/xmltest"
 )
 
 var propFindSupportedCalendarComponentRequest = `
@@ -52,6 +57,22 @@ func TestPropFindSupportedCalendarComponent(t *testing.T) {
 	}
 }
 
+func TestPropFindResourceType(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/cal/"}
+	handler := Handler{Backend: testBackend{calendars: []Calendar{calendar}}}
+
+	for path, want := range map[string]string{
+		"/user/calendars/":     `<resourcetype xmlns="DAV:"><collection/></resourcetype>`,
+		"/user/calendars/cal/": `<resourcetype xmlns="DAV:"><collection/><calendar xmlns="urn:ietf:params:xml:ns:caldav"/></resourcetype>`,
+	} {
+		req := httptest.NewRequest("PROPFIND", path, nil)
+		req.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		xmltest.AssertContains(t, w.Body.Bytes(), want)
+	}
+}
+
 var propFindUserPrincipal = `
 <?xml version="1.0" encoding="UTF-8"?>
 <A:propfind xmlns:A="DAV:">
@@ -77,10 +98,7 @@ func TestPropFindRoot(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	resp := string(data)
-	if !strings.Contains(resp, `<current-user-principal xmlns="DAV:"><href>/user/</href></current-user-principal>`) {
-		t.Errorf("No user-principal returned when doing a PROPFIND against root, response:\n%s", resp)
-	}
+	xmltest.AssertContains(t, data, `<current-user-principal xmlns="DAV:"><href>/user/</href></current-user-principal>`)
 }
 
 var reportCalendarData = `
@@ -132,11 +150,8 @@ func TestMultiCalendarBackend(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	resp := string(data)
 	for _, calendar := range calendars {
-		if !strings.Contains(resp, fmt.Sprintf(`<response xmlns="DAV:"><href>%s</href>`, calendar.Path)) {
-			t.Errorf("Calendar: %v not returned in PROPFIND, response:\n%s", calendar, resp)
-		}
+		xmltest.AssertContains(t, data, fmt.Sprintf(`<href xmlns="DAV:">%s</href>`, calendar.Path))
 	}
 
 	// Now do a PROPFIND for the last calendar
@@ -151,7 +166,7 @@ func TestMultiCalendarBackend(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	resp = string(data)
+	resp := string(data)
 	if !strings.Contains(resp, "VTODO") {
 		t.Errorf("Expected component: VTODO not found in response:\n%v", resp)
 	}
@@ -231,5 +246,595 @@ func (t testBackend) ListCalendarObjects(ctx context.Context, path string, req *
 }
 
 func (t testBackend) QueryCalendarObjects(ctx context.Context, path string, query *CalendarQuery) ([]CalendarObject, error) {
-	return nil, nil
+	return Filter(query, t.objectMap[path])
+}
+
+func TestPutMaxResourceSize(t *testing.T) {
+	event := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:123\r\nDTSTAMP:19960704T120000Z\r\nSUMMARY:A very long summary which\r\n  spans two lines\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+	for _, tc := range []struct {
+		name          string
+		handler       Handler
+		calendar      Calendar
+		contentLength int64
+	}{
+		{"size", Handler{MaxResourceSize: 64}, Calendar{}, -1},
+		{"content-length", Handler{MaxResourceSize: 64}, Calendar{}, int64(len(event))},
+		{"lines", Handler{MaxContentLines: 8}, Calendar{}, -1},
+		{"calendar", Handler{MaxResourceSize: 4096}, Calendar{MaxResourceSize: 64}, -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.calendar.Path = "/user/calendars/cal"
+			h := tc.handler
+			h.Backend = testBackend{calendars: []Calendar{tc.calendar}}
+
+			req := httptest.NewRequest("PUT", "/user/calendars/cal/event.ics", strings.NewReader(event))
+			req.Header.Set("Content-Type", ical.MIMEType)
+			req.ContentLength = tc.contentLength
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			res := w.Result()
+			if res.StatusCode != http.StatusForbidden {
+				t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusForbidden)
+			}
+			data, _ := io.ReadAll(res.Body)
+			xmltest.AssertContains(t, data, `<max-resource-size xmlns="urn:ietf:params:xml:ns:caldav"></max-resource-size>`)
+		})
+	}
+}
+
+func TestPropFindMaxResourceSize(t *testing.T) {
+	propFind := `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:max-resource-size/></d:prop></d:propfind>`
+
+	for _, tc := range []struct {
+		handlerSize, calendarSize, want int64
+	}{
+		{1000, 0, 1000},
+		{1000, 500, 500},
+		{0, 500, 500},
+		{500, 1000, 500},
+	} {
+		cal := Calendar{Path: "/user/calendars/cal", MaxResourceSize: tc.calendarSize}
+		h := Handler{Backend: testBackend{calendars: []Calendar{cal}}, MaxResourceSize: tc.handlerSize}
+
+		req := httptest.NewRequest("PROPFIND", cal.Path, strings.NewReader(propFind))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		data, _ := io.ReadAll(w.Result().Body)
+		xmltest.AssertContains(t, data, fmt.Sprintf(`<max-resource-size xmlns="urn:ietf:params:xml:ns:caldav">%v</max-resource-size>`, tc.want))
+	}
+}
+
+func TestPutSupportedCalendarComponent(t *testing.T) {
+	todo := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN\r\n" +
+		"BEGIN:VTODO\r\nUID:123\r\nDTSTAMP:19960704T120000Z\r\nSUMMARY:Buy milk\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+	cal := Calendar{Path: "/user/calendars/cal", SupportedComponentSet: []string{ical.CompEvent, ical.CompJournal}}
+	h := Handler{Backend: testBackend{calendars: []Calendar{cal}}}
+
+	req := httptest.NewRequest("PUT", "/user/calendars/cal/todo.ics", strings.NewReader(todo))
+	req.Header.Set("Content-Type", ical.MIMEType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusForbidden)
+	}
+	data, _ := io.ReadAll(res.Body)
+	xmltest.AssertContains(t, data, `<supported-calendar-component xmlns="urn:ietf:params:xml:ns:caldav"></supported-calendar-component>`)
+}
+
+type scheduleTagBackend struct {
+	testBackend
+}
+
+func (b scheduleTagBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error) {
+	return &CalendarObject{Path: path, ETag: "etag2", ScheduleTag: "tag2"}, nil
+}
+
+func TestScheduleTag(t *testing.T) {
+	event := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:123\r\nDTSTAMP:19960704T120000Z\r\nDTSTART:19960918T143000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	data, err := ical.NewDecoder(strings.NewReader(event)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal := Calendar{Path: "/user/calendars/cal"}
+	obj := CalendarObject{Path: "/user/calendars/cal/event.ics", ETag: "etag1", ScheduleTag: "tag1", Data: data}
+	h := Handler{Backend: scheduleTagBackend{testBackend{
+		calendars: []Calendar{cal},
+		objectMap: map[string][]CalendarObject{cal.Path: {obj}},
+	}}}
+
+	req := httptest.NewRequest("GET", obj.Path, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Result().Header.Get("Schedule-Tag"); got != `"tag1"` {
+		t.Errorf("GET: got Schedule-Tag %q, want %q", got, `"tag1"`)
+	}
+
+	for _, tc := range []struct {
+		ifScheduleTagMatch string
+		status             int
+	}{
+		{`"tag1"`, http.StatusCreated},
+		{`"tag0"`, http.StatusPreconditionFailed},
+	} {
+		req := httptest.NewRequest("PUT", obj.Path, strings.NewReader(event))
+		req.Header.Set("Content-Type", ical.MIMEType)
+		req.Header.Set("If-Schedule-Tag-Match", tc.ifScheduleTagMatch)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		if res.StatusCode != tc.status {
+			t.Errorf("PUT with If-Schedule-Tag-Match %v: got status %v, want %v", tc.ifScheduleTagMatch, res.StatusCode, tc.status)
+		}
+		if tc.status == http.StatusCreated && res.Header.Get("Schedule-Tag") != `"tag2"` {
+			t.Errorf("PUT: got Schedule-Tag %q, want %q", res.Header.Get("Schedule-Tag"), `"tag2"`)
+		}
+	}
+}
+
+func TestPropFindSupportedReportSet(t *testing.T) {
+	cal := Calendar{Path: "/user/calendars/cal"}
+	h := Handler{Backend: testBackend{calendars: []Calendar{cal}}}
+
+	propFind := `<d:propfind xmlns:d="DAV:"><d:prop><d:supported-report-set/></d:prop></d:propfind>`
+	req := httptest.NewRequest("PROPFIND", cal.Path, strings.NewReader(propFind))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	data, _ := io.ReadAll(w.Result().Body)
+	xmltest.AssertContains(t, data, `<supported-report xmlns="DAV:"><report xmlns="DAV:"><calendar-query xmlns="urn:ietf:params:xml:ns:caldav"></calendar-query></report></supported-report>`)
+	xmltest.AssertContains(t, data, `<supported-report xmlns="DAV:"><report xmlns="DAV:"><calendar-multiget xmlns="urn:ietf:params:xml:ns:caldav"></calendar-multiget></report></supported-report>`)
+}
+
+func TestReportDepth(t *testing.T) {
+	event := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:123\r\nDTSTAMP:19960704T120000Z\r\nDTSTART:19960918T143000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	data, err := ical.NewDecoder(strings.NewReader(event)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal := Calendar{Path: "/user/calendars/cal"}
+	obj := CalendarObject{Path: "/user/calendars/cal/event.ics", Data: data}
+	h := Handler{Backend: testBackend{
+		calendars: []Calendar{cal},
+		objectMap: map[string][]CalendarObject{cal.Path: {obj}},
+	}}
+
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter></c:filter>
+</c:calendar-query>`
+
+	for _, tc := range []struct {
+		path, depth string
+		status      int
+		matches     bool
+	}{
+		{obj.Path, "0", http.StatusMultiStatus, true},
+		{obj.Path, "", http.StatusMultiStatus, true},
+		{cal.Path, "0", http.StatusMultiStatus, false},
+		{cal.Path, "", http.StatusMultiStatus, true},
+		{cal.Path, "2", http.StatusBadRequest, false},
+	} {
+		req := httptest.NewRequest("REPORT", tc.path, strings.NewReader(query))
+		req.Header.Set("Content-Type", "application/xml")
+		if tc.depth != "" {
+			req.Header.Set("Depth", tc.depth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		if res.StatusCode != tc.status {
+			t.Errorf("REPORT %v with Depth %q: got status %v, want %v", tc.path, tc.depth, res.StatusCode, tc.status)
+			continue
+		}
+		body, _ := io.ReadAll(res.Body)
+		if got := strings.Contains(string(body), obj.Path); got != tc.matches {
+			t.Errorf("REPORT %v with Depth %q: got match %v, want %v:\n%s", tc.path, tc.depth, got, tc.matches, body)
+		}
+	}
+}
+
+// addMemberBackend stores the calendar objects put by clients.
+type addMemberBackend struct {
+	testBackend
+	objects map[string]*ical.Calendar
+}
+
+func (b *addMemberBackend) GetCalendarObject(ctx context.Context, path string, req *CalendarCompRequest) (*CalendarObject, error) {
+	if cal, ok := b.objects[path]; ok {
+		return &CalendarObject{Path: path, Data: cal}, nil
+	}
+	return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar object %q not found", path))
+}
+
+func (b *addMemberBackend) PutCalendarObject(ctx context.Context, path string, cal *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error) {
+	b.objects[path] = cal
+	return &CalendarObject{Path: path, ETag: "etag"}, nil
+}
+
+func TestPostAddMember(t *testing.T) {
+	event := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:%v\r\nDTSTAMP:19960704T120000Z\r\nSUMMARY:Meeting\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+	cal := Calendar{Path: "/user/calendars/cal"}
+	backend := &addMemberBackend{testBackend: testBackend{calendars: []Calendar{cal}}, objects: make(map[string]*ical.Calendar)}
+	h := Handler{Backend: backend}
+
+	post := func(uid string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, cal.Path, strings.NewReader(fmt.Sprintf(event, uid)))
+		req.Header.Set("Content-Type", ical.MIMEType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	for _, tc := range []struct {
+		uid, location string
+	}{
+		{"123@example.org", "/user/calendars/cal/123@example.org.ics"},
+		{"a/b", "/user/calendars/cal/c14cddc033f64b9dea80ea675cf280a015e672516090a5626781153dc68fea11.ics"},
+	} {
+		res := post(tc.uid)
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %q: got status %v, want %v", tc.uid, res.StatusCode, http.StatusCreated)
+		}
+		if loc := res.Header.Get("Location"); loc != tc.location {
+			t.Errorf("POST %q: got Location %q, want %q", tc.uid, loc, tc.location)
+		}
+	}
+
+	res := post("123@example.org")
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("POST with a conflicting UID: got status %v, want %v", res.StatusCode, http.StatusForbidden)
+	}
+	data, _ := io.ReadAll(res.Body)
+	xmltest.AssertContains(t, data, `<no-uid-conflict xmlns="urn:ietf:params:xml:ns:caldav"></no-uid-conflict>`)
+}
+
+type principalSearchBackend struct {
+	testBackend
+	query *webdav.PrincipalSearchQuery
+}
+
+func (b *principalSearchBackend) SearchPrincipals(ctx context.Context, query *webdav.PrincipalSearchQuery) ([]webdav.Principal, error) {
+	b.query = query
+	return []webdav.Principal{{
+		Path:        "/principals/alice/",
+		DisplayName: "Alice",
+		Addresses:   []string{"mailto:alice@example.org"},
+	}}, nil
+}
+
+func TestPrincipalPropertySearch(t *testing.T) {
+	search := `<d:principal-property-search xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" test="anyof">
+  <d:property-search>
+    <d:prop><d:displayname/></d:prop>
+    <d:match>ali</d:match>
+  </d:property-search>
+  <d:property-search>
+    <d:prop><c:calendar-user-address-set/></d:prop>
+    <d:match>alice@</d:match>
+  </d:property-search>
+  <d:prop>
+    <d:displayname/>
+    <c:calendar-user-address-set/>
+  </d:prop>
+</d:principal-property-search>`
+
+	backend := &principalSearchBackend{}
+	h := Handler{Backend: backend}
+	req := httptest.NewRequest("REPORT", "/user/", strings.NewReader(search))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	data, _ := io.ReadAll(res.Body)
+	xmltest.AssertContains(t, data, `<href xmlns="DAV:">/principals/alice/</href>`)
+	xmltest.AssertContains(t, data, `<displayname xmlns="DAV:">Alice</displayname>`)
+	xmltest.AssertContains(t, data, `<calendar-user-address-set xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">mailto:alice@example.org</href></calendar-user-address-set>`)
+
+	q := backend.query
+	if q == nil || !q.AnyOf || len(q.Matches) != 2 {
+		t.Fatalf("got query %+v", q)
+	}
+	if m := q.Matches[1]; m.Text != "alice@" || len(m.Props) != 1 || m.Props[0] != calendarUserAddressSetName {
+		t.Errorf("got match %+v", m)
+	}
+}
+
+type propertyStoreBackend struct {
+	testBackend
+	props map[xml.Name]string
+}
+
+func (b *propertyStoreBackend) Properties(ctx context.Context, path string) (map[xml.Name]string, error) {
+	return b.props, nil
+}
+
+func (b *propertyStoreBackend) PatchProperties(ctx context.Context, path string, set map[xml.Name]string, remove []xml.Name) error {
+	for k, v := range set {
+		b.props[k] = v
+	}
+	for _, k := range remove {
+		delete(b.props, k)
+	}
+	return nil
+}
+
+func TestCalendarColor(t *testing.T) {
+	calendar := Calendar{Path: "/user/calendars/cal/"}
+	backend := &propertyStoreBackend{
+		testBackend: testBackend{calendars: []Calendar{calendar}},
+		props:       make(map[xml.Name]string),
+	}
+	h := Handler{Backend: backend}
+
+	propFind := func() []byte {
+		req := httptest.NewRequest("PROPFIND", calendar.Path, strings.NewReader(`<d:propfind xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/">
+  <d:prop><a:calendar-color/><a:calendar-order/></d:prop>
+</d:propfind>`))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		data, _ := io.ReadAll(w.Result().Body)
+		return data
+	}
+	propPatch := func(body string) []byte {
+		req := httptest.NewRequest("PROPPATCH", calendar.Path, strings.NewReader(`<d:propertyupdate xmlns:d="DAV:" xmlns:a="http://apple.com/ns/ical/">
+  <d:set><d:prop>`+body+`</d:prop></d:set>
+</d:propertyupdate>`))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		res := w.Result()
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("PROPPATCH: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+		}
+		data, _ := io.ReadAll(res.Body)
+		return data
+	}
+
+	data := propFind()
+	xmltest.AssertContains(t, data, `<calendar-color xmlns="http://apple.com/ns/ical/">`+defaultCalendarColor+`</calendar-color>`)
+	xmltest.AssertContains(t, data, `<calendar-order xmlns="http://apple.com/ns/ical/">0</calendar-order>`)
+
+	data = propPatch(`<a:calendar-color>#FF2968FF</a:calendar-color><a:calendar-order>3</a:calendar-order>`)
+	xmltest.AssertContains(t, data, `<status xmlns="DAV:">HTTP/1.1 200 OK</status>`)
+
+	data = propFind()
+	xmltest.AssertContains(t, data, `<calendar-color xmlns="http://apple.com/ns/ical/">#FF2968FF</calendar-color>`)
+	xmltest.AssertContains(t, data, `<calendar-order xmlns="http://apple.com/ns/ical/">3</calendar-order>`)
+
+	data = propPatch(`<a:calendar-color>red</a:calendar-color><a:calendar-order>4</a:calendar-order>`)
+	xmltest.AssertContains(t, data, `<status xmlns="DAV:">HTTP/1.1 409 Conflict</status>`)
+	xmltest.AssertContains(t, data, `<status xmlns="DAV:">HTTP/1.1 424 Failed Dependency</status>`)
+	if got := backend.props[calendarOrderName]; got != "3" {
+		t.Errorf("failed PROPPATCH updated calendar-order to %q", got)
+	}
+}
+
+func TestPutMalformedCalendar(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler Handler
+		data    string
+		want    string
+	}{
+		{
+			name: "syntax",
+			data: "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:123\r\nSUMMARY\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: `<valid-calendar-data xmlns="urn:ietf:params:xml:ns:caldav"></valid-calendar-data>`,
+		},
+		{
+			name:    "strict",
+			handler: Handler{StrictParsing: true},
+			data:    "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nEND:VCALENDAR\r\nSUMMARY:Trailing\r\n",
+			want:    `<valid-calendar-data xmlns="urn:ietf:params:xml:ns:caldav"></valid-calendar-data>`,
+		},
+		{
+			name:    "strict-object",
+			handler: Handler{StrictParsing: true},
+			data:    "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n",
+			want:    `<valid-calendar-object-resource xmlns="urn:ietf:params:xml:ns:caldav"></valid-calendar-object-resource>`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := tc.handler
+			h.Backend = testBackend{calendars: []Calendar{{Path: "/user/calendars/cal"}}}
+
+			req := httptest.NewRequest("PUT", "/user/calendars/cal/event.ics", strings.NewReader(tc.data))
+			req.Header.Set("Content-Type", ical.MIMEType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			res := w.Result()
+			if res.StatusCode != http.StatusForbidden {
+				t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusForbidden)
+			}
+			data, _ := io.ReadAll(res.Body)
+			xmltest.AssertContains(t, data, tc.want)
+			if tc.name == "syntax" {
+				xmltest.AssertContains(t, data, `<content-error xmlns="https://github.com/emersion/go-webdav" line="5" component="VEVENT">malformed content line: missing colon</content-error>`)
+			}
+		})
+	}
+}
+
+// scheduleInboxBackend stores a single scheduling object resource, whose
+// schedule tag changes when an organizer update is delivered.
+type scheduleInboxBackend struct {
+	testBackend
+
+	mu        sync.Mutex
+	obj       CalendarObject
+	beforePut func()
+}
+
+func (b *scheduleInboxBackend) deliverOrganizerUpdate(tag string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.obj.ScheduleTag = tag
+}
+
+func (b *scheduleInboxBackend) GetCalendarObject(ctx context.Context, path string, req *CalendarCompRequest) (*CalendarObject, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	obj := b.obj
+	return &obj, nil
+}
+
+func (b *scheduleInboxBackend) PutCalendarObject(ctx context.Context, path string, calendar *ical.Calendar, opts *PutCalendarObjectOptions) (*CalendarObject, error) {
+	if b.beforePut != nil {
+		b.beforePut()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok, err := opts.IfScheduleTagMatch.MatchETag(b.obj.ScheduleTag); err != nil {
+		return nil, err
+	} else if opts.IfScheduleTagMatch.IsSet() && !ok {
+		return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("schedule tag changed"))
+	}
+	b.obj.Data = calendar
+	return &b.obj, nil
+}
+
+func TestScheduleTagAttendeeReply(t *testing.T) {
+	reply := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//xyz Corp//NONSGML PDA Calendar Version 1.0//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:123\r\nDTSTAMP:19960704T120000Z\r\nDTSTART:19960918T143000Z\r\n" +
+		"ORGANIZER:mailto:bob@example.org\r\nATTENDEE;PARTSTAT=ACCEPTED:mailto:alice@example.org\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+	for _, tc := range []struct {
+		name string
+		// race delivers the organizer update between the handler check and
+		// the backend update
+		race bool
+	}{
+		{"before-check", false},
+		{"before-put", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := &scheduleInboxBackend{
+				testBackend: testBackend{calendars: []Calendar{{Path: "/user/calendars/cal"}}},
+				obj:         CalendarObject{Path: "/user/calendars/cal/event.ics", ScheduleTag: "tag1"},
+			}
+			h := Handler{Backend: backend}
+
+			// The attendee fetched the object with schedule tag "tag1", and
+			// the organizer updates the event while the attendee replies
+			if tc.race {
+				backend.beforePut = func() { backend.deliverOrganizerUpdate("tag2") }
+			} else {
+				backend.deliverOrganizerUpdate("tag2")
+			}
+
+			req := httptest.NewRequest("PUT", backend.obj.Path, strings.NewReader(reply))
+			req.Header.Set("Content-Type", ical.MIMEType)
+			req.Header.Set("If-Schedule-Tag-Match", `"tag1"`)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if res := w.Result(); res.StatusCode != http.StatusPreconditionFailed {
+				t.Errorf("got status %v, want %v", res.StatusCode, http.StatusPreconditionFailed)
+			}
+			if backend.obj.Data != nil {
+				t.Errorf("attendee reply clobbered the organizer update")
+			}
+		})
+	}
+}
+
+func TestReportLimits(t *testing.T) {
+	cal := Calendar{Path: "/user/calendars/cal"}
+	h := Handler{
+		Backend:          testBackend{calendars: []Calendar{cal}},
+		MaxMultigetHrefs: 2,
+		MaxFilterDepth:   2,
+	}
+
+	multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <d:href>/user/calendars/cal/a.ics</d:href>
+  <d:href>/user/calendars/cal/b.ics</d:href>
+  <d:href>/user/calendars/cal/c.ics</d:href>
+</c:calendar-multiget>`
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"><c:comp-filter name="VALARM"/></c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+
+	// Bodies truncated after the first element over the limit must be
+	// rejected before the rest of the body is parsed
+	truncatedMultiget := multiget[:strings.Index(multiget, "c.ics</d:href>")+len("c.ics</d:href>")]
+	truncatedQuery := query[:strings.Index(query, `name="VALARM"/>`)+len(`name="VALARM"/>`)]
+
+	for _, tc := range []struct {
+		name, body string
+		status     int
+	}{
+		{"multiget", multiget, http.StatusInsufficientStorage},
+		{"query", query, http.StatusBadRequest},
+		{"truncated multiget", truncatedMultiget, http.StatusInsufficientStorage},
+		{"truncated query", truncatedQuery, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("REPORT", cal.Path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		if res.StatusCode != tc.status {
+			t.Errorf("%v: got status %v, want %v", tc.name, res.StatusCode, tc.status)
+		}
+		data, _ := io.ReadAll(res.Body)
+		if tc.status == http.StatusInsufficientStorage {
+			xmltest.AssertContains(t, data, `<number-of-matches-within-limits xmlns="DAV:"></number-of-matches-within-limits>`)
+		} else if !strings.Contains(string(data), "nested deeper") {
+			t.Errorf("%v: got body %q, want filter depth error", tc.name, data)
+		}
+	}
+}
+
+func TestReportUnsupportedCollation(t *testing.T) {
+	cal := Calendar{Path: "/user/calendars/cal"}
+	h := Handler{Backend: testBackend{calendars: []Calendar{cal}}}
+
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">
+    <c:prop-filter name="SUMMARY"><c:text-match collation="i;klingon">meeting</c:text-match></c:prop-filter>
+  </c:comp-filter></c:comp-filter></c:filter>
+</c:calendar-query>`
+	req := httptest.NewRequest("REPORT", cal.Path, strings.NewReader(query))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusForbidden)
+	}
+	data, _ := io.ReadAll(res.Body)
+	xmltest.AssertContains(t, data, `<supported-collation xmlns="urn:ietf:params:xml:ns:caldav"></supported-collation>`)
 }
@@ -0,0 +1,123 @@
+package caldav
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// TimezoneProvider resolves the time zone identifiers referenced by TZID
+// parameters.
+type TimezoneProvider interface {
+	Location(tzid string) (*time.Location, error)
+}
+
+// TimezoneMap is a TimezoneProvider mapping time zone identifiers to
+// locations, e.g. to support the non-standard identifiers used by some
+// clients. Identifiers missing from the map are looked up in the Go time zone
+// database.
+type TimezoneMap map[string]*time.Location
+
+var _ TimezoneProvider = TimezoneMap(nil)
+
+func (m TimezoneMap) Location(tzid string) (*time.Location, error) {
+	if loc, ok := m[tzid]; ok {
+		return loc, nil
+	}
+	return time.LoadLocation(tzid)
+}
+
+const (
+	datetimeFormat    = "20060102T150405"
+	datetimeUTCFormat = "20060102T150405Z"
+)
+
+// resolveTimezones returns a copy of comp where TZID parameters are replaced
+// with identifiers of the Go time zone database. Date and times in locations
+// which aren't part of the database are converted to UTC.
+//
+// Unknown time zones are reported as a CALDAV:valid-calendar-data error.
+func resolveTimezones(comp *ical.Component, tz TimezoneProvider) (*ical.Component, error) {
+	out := &ical.Component{
+		Name:     comp.Name,
+		Props:    make(ical.Props, len(comp.Props)),
+		Children: make([]*ical.Component, 0, len(comp.Children)),
+	}
+
+	for name, props := range comp.Props {
+		l := make([]ical.Prop, len(props))
+		for i, prop := range props {
+			resolved, err := resolvePropTimezone(&prop, tz)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = *resolved
+		}
+		out.Props[name] = l
+	}
+
+	for _, child := range comp.Children {
+		resolved, err := resolveTimezones(child, tz)
+		if err != nil {
+			return nil, err
+		}
+		out.Children = append(out.Children, resolved)
+	}
+
+	return out, nil
+}
+
+func resolvePropTimezone(prop *ical.Prop, tz TimezoneProvider) (*ical.Prop, error) {
+	tzid := prop.Params.Get(ical.ParamTimezoneID)
+	if tzid == "" {
+		return prop, nil
+	}
+
+	loc, err := tz.Location(tzid)
+	if err != nil {
+		return nil, &invalidCalendarDataError{fmt.Errorf("caldav: unknown time zone %q: %v", tzid, err)}
+	}
+
+	out := &ical.Prop{Name: prop.Name, Params: make(ical.Params, len(prop.Params)), Value: prop.Value}
+	for k, v := range prop.Params {
+		out.Params[k] = v
+	}
+
+	if _, err := time.LoadLocation(loc.String()); err == nil {
+		out.Params.Set(ical.ParamTimezoneID, loc.String())
+		return out, nil
+	}
+
+	// The location can't be referenced by name, convert to UTC
+	values := strings.Split(prop.Value, ",")
+	for i, v := range values {
+		if len(v) != len(datetimeFormat) {
+			continue
+		}
+		t, err := time.ParseInLocation(datetimeFormat, v, loc)
+		if err != nil {
+			return nil, &invalidCalendarDataError{fmt.Errorf("caldav: invalid date and time %q: %v", v, err)}
+		}
+		values[i] = t.UTC().Format(datetimeUTCFormat)
+	}
+	out.Value = strings.Join(values, ",")
+	out.Params.Del(ical.ParamTimezoneID)
+	return out, nil
+}
+
+// invalidCalendarDataError is reported to clients as a
+// CALDAV:valid-calendar-data error.
+type invalidCalendarDataError struct {
+	err error
+}
+
+func (err *invalidCalendarDataError) Error() string {
+	return err.err.Error()
+}
+
+func (err *invalidCalendarDataError) Unwrap() error {
+	return newPreconditionError(http.StatusForbidden, PreconditionValidCalendarData)
+}
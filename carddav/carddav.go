@@ -4,6 +4,7 @@
 package carddav
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/emersion/go-vcard"
@@ -17,6 +18,17 @@ func NewAddressBookHomeSet(path string) webdav.BackendSuppliedHomeSet {
 	return &addressbookHomeSet{Href: internal.Href{Path: path}}
 }
 
+// ObjectName returns the name of the address object resource storing card,
+// derived from its UID: "<UID>.vcf". Servers use it to store address objects
+// added to an address book without a name.
+func ObjectName(card vcard.Card) (string, error) {
+	uid := card.Value(vcard.FieldUID)
+	if uid == "" {
+		return "", fmt.Errorf("address object has no UID")
+	}
+	return internal.ObjectName(uid, ".vcf"), nil
+}
+
 type AddressDataType struct {
 	ContentType string
 	Version     string
@@ -51,6 +63,33 @@ type AddressBookQuery struct {
 	Limit int // <= 0 means unlimited
 }
 
+// NewNameSearchQuery returns a query for address objects whose formatted
+// name, structured name or nickname contains text. The full vCard of each
+// matching address object is requested.
+func NewNameSearchQuery(text string) *AddressBookQuery {
+	return newSearchQuery(text, vcard.FieldFormattedName, vcard.FieldName, vcard.FieldNickname)
+}
+
+// NewEmailSearchQuery returns a query for address objects with an email
+// address containing text. See NewNameSearchQuery.
+func NewEmailSearchQuery(text string) *AddressBookQuery {
+	return newSearchQuery(text, vcard.FieldEmail)
+}
+
+func newSearchQuery(text string, fields ...string) *AddressBookQuery {
+	query := &AddressBookQuery{
+		DataRequest: AddressDataRequest{AllProp: true},
+		FilterTest:  FilterAnyOf,
+	}
+	for _, field := range fields {
+		query.PropFilters = append(query.PropFilters, PropFilter{
+			Name:        field,
+			TextMatches: []TextMatch{{Text: text, MatchType: MatchContains}},
+		})
+	}
+	return query
+}
+
 type AddressDataRequest struct {
 	Props   []string
 	AllProp bool
@@ -78,6 +117,7 @@ type TextMatch struct {
 	Text            string
 	NegateCondition bool
 	MatchType       MatchType // defaults to MatchContains
+	Collation       string    // defaults to "i;ascii-casemap"
 }
 
 type FilterTest string
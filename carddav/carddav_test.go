@@ -3,6 +3,7 @@ package carddav
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/emersion/go-vcard"
 	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/internal/xmltest"
 )
 
 type testBackend struct {
@@ -107,8 +109,12 @@ func (b *testBackend) ListAddressObjects(ctx context.Context, path string, req *
 	return []AddressObject{*alice}, nil
 }
 
-func (*testBackend) QueryAddressObjects(ctx context.Context, path string, query *AddressBookQuery) ([]AddressObject, error) {
-	panic("TODO: implement")
+func (b *testBackend) QueryAddressObjects(ctx context.Context, path string, query *AddressBookQuery) ([]AddressObject, error) {
+	aos, err := b.ListAddressObjects(ctx, path, &query.DataRequest)
+	if err != nil {
+		return nil, err
+	}
+	return Filter(query, aos)
 }
 
 func (*testBackend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error) {
@@ -145,7 +151,7 @@ func TestAddressBookDiscovery(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := context.Background()
 
-			h := Handler{&testBackend{}, tc.prefix}
+			h := Handler{Backend: &testBackend{}, Prefix: tc.prefix}
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				ctx := r.Context()
 				ctx = context.WithValue(ctx, currentUserPrincipalKey, tc.currentUserPrincipal)
@@ -190,10 +196,55 @@ func TestAddressBookDiscovery(t *testing.T) {
 			if abs[0].Path != tc.addressBookPath {
 				t.Fatalf("Found address book at %s, expected %s", abs[0].Path, tc.addressBookPath)
 			}
+
+			abs, err = DiscoverAddressBooks(ctx, ts.URL, nil)
+			if err != nil {
+				t.Fatalf("error discovering address books: %s", err)
+			}
+			if len(abs) != 1 || abs[0].Path != tc.addressBookPath {
+				t.Fatalf("Discovered address books %+v, expected one at %s", abs, tc.addressBookPath)
+			}
 		})
 	}
 }
 
+func TestPropFindResourceType(t *testing.T) {
+	h := Handler{Backend: &testBackend{}}
+
+	for path, want := range map[string]string{
+		"/test/contacts/":        `<resourcetype xmlns="DAV:"><collection/></resourcetype>`,
+		"/test/contacts/private": `<resourcetype xmlns="DAV:"><collection/><addressbook xmlns="urn:ietf:params:xml:ns:carddav"/></resourcetype>`,
+	} {
+		ctx := context.WithValue(context.Background(), currentUserPrincipalKey, "/test/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, "/test/contacts/private")
+		req := httptest.NewRequest("PROPFIND", path, nil).WithContext(ctx)
+		req.Header.Set("Depth", "0")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		xmltest.AssertContains(t, w.Body.Bytes(), want)
+	}
+}
+
+func TestPropFindSupportedCollationSet(t *testing.T) {
+	h := Handler{Backend: &testBackend{}}
+
+	ctx := context.WithValue(context.Background(), currentUserPrincipalKey, "/test/")
+	ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+	ctx = context.WithValue(ctx, addressBookPathKey, "/test/contacts/private")
+	body := `<propfind xmlns="DAV:"><prop><supported-collation-set xmlns="urn:ietf:params:xml:ns:carddav"/></prop></propfind>`
+	req := httptest.NewRequest("PROPFIND", "/test/contacts/private", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	xmltest.AssertContains(t, w.Body.Bytes(), `<supported-collation-set xmlns="urn:ietf:params:xml:ns:carddav">`+
+		`<supported-collation>i;ascii-casemap</supported-collation>`+
+		`<supported-collation>i;octet</supported-collation>`+
+		`<supported-collation>i;unicode-casemap</supported-collation>`+
+		`</supported-collation-set>`)
+}
+
 var mkcolRequestBody = `
 <?xml version="1.0" encoding="utf-8" ?>
    <D:mkcol xmlns:D="DAV:"
@@ -240,3 +291,153 @@ func TestCreateAddressbookMinimalBody(t *testing.T) {
 		t.Fatalf("Address book sdscription is '%s', expected 'My primary address book.'", c.Description)
 	}
 }
+
+func TestPutMaxResourceSize(t *testing.T) {
+	for _, h := range []Handler{
+		{MaxResourceSize: 64},
+		{MaxContentLines: 4},
+	} {
+		h.Backend = &testBackend{}
+
+		req := httptest.NewRequest("PUT", "/dav/addressbooks/user0/default/"+alicePath, strings.NewReader(aliceData))
+		req = req.WithContext(context.WithValue(req.Context(), addressBookPathKey, "/dav/addressbooks/user0/default"))
+		req.Header.Set("Content-Type", vcard.MIMEType)
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		if res.StatusCode != http.StatusForbidden {
+			t.Errorf("got status %v, want %v", res.StatusCode, http.StatusForbidden)
+		}
+	}
+}
+
+func TestReportQueryDefaultDepth(t *testing.T) {
+	h := Handler{Backend: &testBackend{}, Prefix: "/dav"}
+
+	query := `<c:addressbook-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:prop-filter name="FN"><c:text-match>alice</c:text-match></c:prop-filter></c:filter>
+</c:addressbook-query>`
+	req := httptest.NewRequest("REPORT", "/dav/addressbooks/user0/default/", strings.NewReader(query))
+	req = req.WithContext(context.WithValue(req.Context(), addressBookPathKey, "/dav/addressbooks/user0/default"))
+	req.Header.Set("Content-Type", "application/xml")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	data, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(data), alicePath) {
+		t.Errorf("query without Depth on an address book didn't match its members:\n%s", data)
+	}
+}
+
+func TestReportMaxMultigetHrefs(t *testing.T) {
+	h := Handler{Backend: &testBackend{}, MaxMultigetHrefs: 2}
+
+	// The body is truncated after the first href over the limit: the
+	// request must be rejected before the rest of the body is parsed
+	multiget := `<c:addressbook-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav">
+  <d:href>/dav/addressbooks/user0/default/a.vcf</d:href>
+  <d:href>/dav/addressbooks/user0/default/b.vcf</d:href>
+  <d:href>/dav/addressbooks/user0/default/c.vcf</d:href>`
+	req := httptest.NewRequest("REPORT", "/dav/addressbooks/user0/default/", strings.NewReader(multiget))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("got status %v, want %v", res.StatusCode, http.StatusInsufficientStorage)
+	}
+	data, _ := io.ReadAll(res.Body)
+	xmltest.AssertContains(t, data, `<number-of-matches-within-limits xmlns="DAV:"></number-of-matches-within-limits>`)
+}
+
+// addMemberBackend records the paths of the address objects put by clients.
+type addMemberBackend struct {
+	testBackend
+	paths []string
+}
+
+func (b *addMemberBackend) GetAddressObject(ctx context.Context, path string, req *AddressDataRequest) (*AddressObject, error) {
+	for _, p := range b.paths {
+		if p == path {
+			return &AddressObject{Path: path}, nil
+		}
+	}
+	return nil, webdav.NewHTTPError(404, fmt.Errorf("Not found"))
+}
+
+func (b *addMemberBackend) PutAddressObject(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error) {
+	b.paths = append(b.paths, path)
+	return &AddressObject{Path: path}, nil
+}
+
+func TestPutAddressBookMember(t *testing.T) {
+	const addressBookPath = "/dav/addressbooks/default"
+	backend := &addMemberBackend{}
+	h := Handler{Backend: backend}
+
+	for _, tc := range []struct {
+		method, uid string
+		status      int
+	}{
+		{http.MethodPost, "bob@example.org", http.StatusCreated},
+		{http.MethodPut, "carol@example.org", http.StatusCreated},
+		{http.MethodPost, "bob@example.org", http.StatusForbidden},
+	} {
+		card := strings.Replace(aliceData, "urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1", tc.uid, 1)
+		req := httptest.NewRequest(tc.method, addressBookPath, strings.NewReader(card))
+		req = req.WithContext(context.WithValue(req.Context(), addressBookPathKey, addressBookPath))
+		req.Header.Set("Content-Type", vcard.MIMEType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if res := w.Result(); res.StatusCode != tc.status {
+			t.Errorf("%v %q: got status %v, want %v", tc.method, tc.uid, res.StatusCode, tc.status)
+		}
+	}
+
+	want := []string{addressBookPath + "/bob@example.org.vcf", addressBookPath + "/carol@example.org.vcf"}
+	if len(backend.paths) != len(want) || backend.paths[0] != want[0] || backend.paths[1] != want[1] {
+		t.Errorf("got paths %v, want %v", backend.paths, want)
+	}
+}
+
+func TestPutStrictParsing(t *testing.T) {
+	data := "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:alice\r\nFN:Alice\r\nNOTE\r\nEND:VCARD\r\n"
+
+	for _, strict := range []bool{false, true} {
+		backend := &addMemberBackend{}
+		h := Handler{Backend: backend, StrictParsing: strict}
+
+		req := httptest.NewRequest("PUT", "/dav/addressbooks/user0/default/alice.vcf", strings.NewReader(data))
+		req = req.WithContext(context.WithValue(req.Context(), addressBookPathKey, "/dav/addressbooks/user0/default"))
+		req.Header.Set("Content-Type", vcard.MIMEType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		res := w.Result()
+		if !strict {
+			if res.StatusCode != http.StatusCreated {
+				t.Errorf("lenient: got status %v, want %v", res.StatusCode, http.StatusCreated)
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("strict: got status %v, want %v", res.StatusCode, http.StatusForbidden)
+		}
+		body, _ := io.ReadAll(res.Body)
+		xmltest.AssertContains(t, body, `<valid-address-data xmlns="urn:ietf:params:xml:ns:carddav"></valid-address-data>`)
+		xmltest.AssertContains(t, body, `<content-error xmlns="https://github.com/emersion/go-webdav" line="5" component="VCARD">malformed content line: missing colon</content-error>`)
+		if len(backend.paths) != 0 {
+			t.Errorf("strict: address object was stored")
+		}
+	}
+}
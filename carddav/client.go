@@ -23,6 +23,42 @@ func DiscoverContextURL(ctx context.Context, domain string) (string, error) {
 	return internal.DiscoverContextURL(ctx, "carddav", domain)
 }
 
+// DiscoverAddressBooks lists the address books of the current user, starting
+// from the URL of a CardDAV server, e.g. "https://example.org". It follows
+// the bootstrapping procedure described in RFC 6764 section 6: the current
+// user principal is found via the /.well-known/carddav URL or the context
+// path of serverURL, then its address book home set is listed.
+func DiscoverAddressBooks(ctx context.Context, serverURL string, c webdav.HTTPClient) ([]AddressBook, error) {
+	endpoints, err := internal.DiscoveryEndpoints(serverURL, "carddav")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		client    *Client
+		principal string
+	)
+	for _, endpoint := range endpoints {
+		client, err = NewClient(c, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		principal, err = client.FindCurrentUserPrincipal(ctx)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("carddav: failed to find current user principal: %w", err)
+	}
+
+	homeSet, err := client.FindAddressBookHomeSet(ctx, principal)
+	if err != nil {
+		return nil, fmt.Errorf("carddav: failed to find address book home set: %w", err)
+	}
+	return client.FindAddressBooks(ctx, homeSet)
+}
+
 // Client provides access to a remote CardDAV server.
 type Client struct {
 	*webdav.Client
@@ -197,6 +233,7 @@ func encodeTextMatch(tm *TextMatch) *textMatch {
 		Text:            tm.Text,
 		NegateCondition: negateCondition(tm.NegateCondition),
 		MatchType:       matchType(tm.MatchType),
+		Collation:       tm.Collation,
 	}
 }
 
@@ -324,10 +361,11 @@ func populateAddressObject(ao *AddressObject, h http.Header) error {
 		ao.Path = u.Path
 	}
 	if etag := h.Get("ETag"); etag != "" {
-		etag, err := strconv.Unquote(etag)
-		if err != nil {
+		var e internal.ETag
+		if err := e.UnmarshalText([]byte(etag)); err != nil {
 			return err
 		}
+		etag := string(e)
 		ao.ETag = etag
 	}
 	if contentLength := h.Get("Content-Length"); contentLength != "" {
@@ -385,8 +423,36 @@ func (c *Client) GetAddressObject(ctx context.Context, path string) (*AddressObj
 }
 
 func (c *Client) PutAddressObject(ctx context.Context, path string, card vcard.Card) (*AddressObject, error) {
-	// TODO: add support for If-None-Match and If-Match
+	ao, _, err := c.putAddressObject(ctx, path, card, nil)
+	return ao, err
+}
+
+// PutAddressObjectWithOptions is like PutAddressObject, but sends the
+// conditional headers of opts: IfNoneMatch set to "*" only creates the
+// address object, and IfMatch set to an ETag only updates it if it hasn't
+// been modified. If the condition fails, the returned error matches
+// webdav.ErrPreconditionFailed. The returned address object holds the new
+// ETag, if the server sent one. opts may be nil.
+func (c *Client) PutAddressObjectWithOptions(ctx context.Context, path string, card vcard.Card, opts *PutAddressObjectOptions) (*AddressObject, error) {
+	ao, _, err := c.putAddressObject(ctx, path, card, opts.header())
+	return ao, err
+}
+
+func (opts *PutAddressObjectOptions) header() http.Header {
+	if opts == nil {
+		return nil
+	}
+	header := make(http.Header)
+	if opts.IfNoneMatch.IsSet() {
+		header.Set("If-None-Match", string(opts.IfNoneMatch))
+	}
+	if opts.IfMatch.IsSet() {
+		header.Set("If-Match", string(opts.IfMatch))
+	}
+	return header
+}
 
+func (c *Client) putAddressObject(ctx context.Context, path string, card vcard.Card, header http.Header) (ao *AddressObject, created bool, err error) {
 	// TODO: some servers want a Content-Length header, so we can't stream the
 	// request body here. See the Radicale issue:
 	// https://github.com/Kozea/Radicale/issues/1016
@@ -399,27 +465,101 @@ func (c *Client) PutAddressObject(ctx context.Context, path string, card vcard.C
 
 	var buf bytes.Buffer
 	if err := vcard.NewEncoder(&buf).Encode(card); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	req, err := c.ic.NewRequest(http.MethodPut, path, &buf)
 	if err != nil {
 		//pr.Close()
-		return nil, err
+		return nil, false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
 	}
 	req.Header.Set("Content-Type", vcard.MIMEType)
 
 	resp, err := c.ic.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	resp.Body.Close()
+	internal.DiscardBody(resp.Body)
 
-	ao := &AddressObject{Path: path}
+	ao = &AddressObject{Path: path}
 	if err := populateAddressObject(ao, resp.Header); err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return ao, nil
+	return ao, resp.StatusCode == http.StatusCreated, nil
+}
+
+// BatchAddressObject is an address object to upload with PutAddressObjects.
+type BatchAddressObject struct {
+	Path string
+	Card vcard.Card
+	// ETag is the current ETag of the address object. If empty, the address
+	// object is created and must not already exist. Otherwise, the address
+	// object is only updated if its ETag still matches.
+	ETag string
+}
+
+// PutStatus is the outcome of a single upload in a batch.
+type PutStatus int
+
+const (
+	PutFailed PutStatus = iota
+	PutCreated
+	PutUpdated
+	// PutConflict indicates that the object has been created or modified
+	// concurrently, i.e. the If-Match or If-None-Match precondition failed.
+	PutConflict
+)
+
+// BatchPutResult holds the result of a single upload in a batch.
+type BatchPutResult struct {
+	Path   string
+	Status PutStatus
+	// Object is set if the upload succeeded.
+	Object *AddressObject
+	// Err is set if the upload failed.
+	Err error
+}
+
+// PutAddressObjects uploads a batch of address objects. Each object is either
+// created with "If-None-Match: *" or updated with "If-Match", see
+// BatchAddressObject.ETag. A failed upload doesn't abort the batch: the
+// outcome of each upload is reported in the returned results, in the same
+// order as objects. An error is only returned if the context is done.
+func (c *Client) PutAddressObjects(ctx context.Context, objects []BatchAddressObject) ([]BatchPutResult, error) {
+	results := make([]BatchPutResult, 0, len(objects))
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		var opts PutAddressObjectOptions
+		if obj.ETag == "" {
+			opts.IfNoneMatch = "*"
+		} else {
+			opts.IfMatch = webdav.ConditionalMatch(internal.ETag(obj.ETag).String())
+		}
+
+		result := BatchPutResult{Path: obj.Path}
+		ao, created, err := c.putAddressObject(ctx, obj.Path, obj.Card, opts.header())
+		if err != nil {
+			result.Err = err
+			if errors.Is(err, webdav.ErrPreconditionFailed) {
+				result.Status = PutConflict
+			}
+		} else {
+			result.Object = ao
+			if created {
+				result.Status = PutCreated
+			} else {
+				result.Status = PutUpdated
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
 
 // SyncCollection performs a collection synchronization operation on the
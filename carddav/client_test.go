@@ -0,0 +1,122 @@
+package carddav
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-vcard"
+)
+
+var queryAddressBookResponse = `<?xml version="1.0" encoding="utf-8" ?>
+<D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:response>
+    <D:href>/user/contacts/default/` + alicePath + `</D:href>
+    <D:propstat>
+      <D:prop>
+        <D:getetag>"23ba4d-ff11fb"</D:getetag>
+        <C:address-data>` + aliceData + `</C:address-data>
+      </D:prop>
+      <D:status>HTTP/1.1 200 OK</D:status>
+    </D:propstat>
+  </D:response>
+</D:multistatus>`
+
+func TestClientQueryAddressBook(t *testing.T) {
+	var reqBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, queryAddressBookResponse)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aos, err := c.QueryAddressBook(context.Background(), "/user/contacts/default/", NewEmailSearchQuery("alice"))
+	if err != nil {
+		t.Fatalf("QueryAddressBook() = %v", err)
+	}
+
+	var query addressbookQuery
+	if err := xml.Unmarshal(reqBody, &query); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	props := query.Filter.Props
+	if len(props) != 1 || props[0].Name != vcard.FieldEmail || len(props[0].TextMatches) != 1 {
+		t.Fatalf("unexpected prop-filter in request:\n%s", reqBody)
+	}
+	if tm := props[0].TextMatches[0]; tm.Text != "alice" || tm.MatchType != matchType(MatchContains) {
+		t.Errorf("unexpected text-match in request:\n%s", reqBody)
+	}
+
+	if len(aos) != 1 {
+		t.Fatalf("got %v address objects, want 1", len(aos))
+	}
+	if aos[0].ETag != "23ba4d-ff11fb" {
+		t.Errorf("got ETag %q", aos[0].ETag)
+	}
+	if email := aos[0].Card.PreferredValue(vcard.FieldEmail); email != "alice@example.com" {
+		t.Errorf("got email %q", email)
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	card, err := vcard.NewDecoder(strings.NewReader(aliceData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ao := &AddressObject{Card: card}
+
+	for _, tc := range []struct {
+		query *AddressBookQuery
+		want  bool
+	}{
+		{NewNameSearchQuery("Alice"), true},
+		{NewNameSearchQuery("Bob"), false},
+		{NewEmailSearchQuery("@example.com"), true},
+		{NewEmailSearchQuery("Gopher"), false},
+	} {
+		got, err := Match(tc.query, ao)
+		if err != nil {
+			t.Errorf("Match(%v) = %v", tc.query.PropFilters[0].TextMatches[0].Text, err)
+		} else if got != tc.want {
+			t.Errorf("Match(%v) = %v, want %v", tc.query.PropFilters[0].TextMatches[0].Text, got, tc.want)
+		}
+	}
+}
+
+func TestClientPutAddressObjectNilOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != "" {
+			t.Errorf("unexpected conditional headers: %v", r.Header)
+		}
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card, err := vcard.NewDecoder(strings.NewReader(aliceData)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ao, err := c.PutAddressObjectWithOptions(context.Background(), "/user/contacts/default/"+alicePath, card, nil)
+	if err != nil {
+		t.Fatalf("PutAddressObjectWithOptions() = %v", err)
+	} else if ao.ETag != "1" {
+		t.Errorf("got ETag %q, want %q", ao.ETag, "1")
+	}
+}
@@ -16,6 +16,7 @@ var (
 	addressBookDescriptionName = xml.Name{namespace, "addressbook-description"}
 	supportedAddressDataName   = xml.Name{namespace, "supported-address-data"}
 	maxResourceSizeName        = xml.Name{namespace, "max-resource-size"}
+	supportedCollationSetName  = xml.Name{namespace, "supported-collation-set"}
 
 	addressBookQueryName    = xml.Name{namespace, "addressbook-query"}
 	addressBookMultigetName = xml.Name{namespace, "addressbook-multiget"}
@@ -50,6 +51,12 @@ type addressDataType struct {
 	Version     string   `xml:"version,attr"`
 }
 
+// https://tools.ietf.org/html/rfc6352#section-8.3.1
+type supportedCollationSet struct {
+	XMLName    xml.Name `xml:"urn:ietf:params:xml:ns:carddav supported-collation-set"`
+	Collations []string `xml:"supported-collation"`
+}
+
 // https://tools.ietf.org/html/rfc6352#section-6.2.3
 type maxResourceSize struct {
 	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:carddav max-resource-size"`
@@ -192,8 +199,9 @@ type addressDataResp struct {
 }
 
 type reportReq struct {
-	Query    *addressbookQuery
-	Multiget *addressbookMultiget
+	Query                   *addressbookQuery
+	Multiget                *addressbookMultiget
+	PrincipalPropertySearch *internal.PrincipalPropertySearch
 }
 
 func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -205,6 +213,9 @@ func (r *reportReq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	case addressBookMultigetName:
 		r.Multiget = &addressbookMultiget{}
 		v = r.Multiget
+	case internal.PrincipalPropertySearchName:
+		r.PrincipalPropertySearch = &internal.PrincipalPropertySearch{}
+		v = r.PrincipalPropertySearch
 	default:
 		return fmt.Errorf("carddav: unsupported REPORT root %q %q", start.Name.Space, start.Name.Local)
 	}
@@ -0,0 +1,39 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+type queryBackend struct {
+	*testBackend
+}
+
+func (queryBackend) QueryAddressObjects(ctx context.Context, path string, query *AddressBookQuery) ([]AddressObject, error) {
+	return nil, nil
+}
+
+func FuzzReport(f *testing.F) {
+	h := Handler{Backend: queryBackend{&testBackend{}}}
+
+	f.Add([]byte(`<c:addressbook-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav"><d:prop><c:address-data><c:prop name="FN"/></c:address-data></d:prop>` +
+		`<c:filter test="anyof"><c:prop-filter name="EMAIL" test="allof"><c:text-match collation="i;unicode-casemap" match-type="starts-with">a</c:text-match>` +
+		`<c:param-filter name="TYPE"><c:is-not-defined/></c:param-filter></c:prop-filter></c:filter><c:limit><c:nresults>10</c:nresults></c:limit></c:addressbook-query>`))
+	f.Add([]byte(`<c:addressbook-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav"><d:prop><d:getetag/><c:address-data/></d:prop>` +
+		`<d:href>/test/contacts/private/a.vcf</d:href></c:addressbook-multiget>`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		ctx := context.WithValue(context.Background(), currentUserPrincipalKey, "/test/")
+		ctx = context.WithValue(ctx, homeSetPathKey, "/test/contacts/")
+		ctx = context.WithValue(ctx, addressBookPathKey, "/test/contacts/private")
+		req := httptest.NewRequest("REPORT", "/test/contacts/private", bytes.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if code := w.Result().StatusCode; code >= 500 {
+			t.Errorf("got status %v", code)
+		}
+	})
+}
@@ -295,6 +295,35 @@ END:VCARD`)
 			addr: alice,
 			want: true,
 		},
+		{
+			name: "match-name-equals-default-collation",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{{
+					Name: vcard.FieldFormattedName,
+					TextMatches: []TextMatch{{
+						Text:      "ALICE gopher",
+						MatchType: MatchEquals,
+					}},
+				}},
+			},
+			addr: alice,
+			want: true,
+		},
+		{
+			name: "match-name-equals-octet",
+			query: &AddressBookQuery{
+				PropFilters: []PropFilter{{
+					Name: vcard.FieldFormattedName,
+					TextMatches: []TextMatch{{
+						Text:      "ALICE gopher",
+						MatchType: MatchEquals,
+						Collation: "i;octet",
+					}},
+				}},
+			},
+			addr: alice,
+			want: false,
+		},
 		{
 			name: "match-email-equals-ok",
 			query: &AddressBookQuery{
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
 	"strings"
@@ -46,6 +49,31 @@ type Backend interface {
 type Handler struct {
 	Backend Backend
 	Prefix  string
+
+	// MaxResourceSize is the maximum size in bytes of address objects uploaded
+	// with PUT. AddressBook.MaxResourceSize can further restrict the size for a
+	// given address book. Larger objects are rejected with 403 Forbidden and the
+	// CARDDAV:max-resource-size precondition, and the limit is advertised in
+	// PROPFIND responses. If zero, the size is unlimited.
+	MaxResourceSize int64
+	// MaxContentLines is the maximum number of vCard content lines,
+	// including BEGIN and END lines, of address objects uploaded with PUT. It
+	// limits the number of components and properties. If zero, the number of
+	// lines is unlimited.
+	MaxContentLines int
+	// StrictParsing enables strict parsing of address objects uploaded with
+	// PUT. By default, malformed content lines are ignored by the vCard
+	// decoder. In strict mode, objects containing malformed content lines are
+	// rejected.
+	StrictParsing bool
+	// MaxMultigetHrefs limits the number of hrefs in addressbook-multiget REPORT
+	// requests. Larger requests are rejected with 507 Insufficient Storage
+	// and the DAV:number-of-matches-within-limits precondition. Zero means no
+	// limit.
+	MaxMultigetHrefs int
+	// NamespacePrefixes overrides the XML namespace prefixes used in
+	// responses, see webdav.Handler.NamespacePrefixes.
+	NamespacePrefixes map[string]string
 }
 
 // ServeHTTP implements http.Handler.
@@ -66,38 +94,79 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var err error
-	switch r.Method {
-	case "REPORT":
-		err = h.handleReport(w, r)
-	default:
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
-		hh := internal.Handler{Backend: &b}
-		hh.ServeHTTP(w, r)
-	}
-
-	if err != nil {
-		internal.ServeError(w, err)
+	b := backend{
+		Backend:          h.Backend,
+		Prefix:           strings.TrimSuffix(h.Prefix, "/"),
+		MaxResourceSize:  h.MaxResourceSize,
+		MaxContentLines:  h.MaxContentLines,
+		StrictParsing:    h.StrictParsing,
+		MaxMultigetHrefs: h.MaxMultigetHrefs,
 	}
+	hh := internal.Handler{Backend: &b, NamespacePrefixes: h.NamespacePrefixes}
+	hh.ServeHTTP(w, r)
 }
 
-func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
+func (b *backend) Report(w http.ResponseWriter, r *http.Request, depth internal.Depth) error {
 	var report reportReq
-	if err := internal.DecodeXMLRequest(r, &report); err != nil {
+	var limits []internal.XMLElementLimit
+	if b.MaxMultigetHrefs > 0 {
+		limits = append(limits, internal.XMLElementLimit{
+			Name:     internal.HrefName,
+			Parent:   addressBookMultigetName,
+			MaxCount: b.MaxMultigetHrefs,
+			Err:      internal.NewNumberOfMatchesError(),
+		})
+	}
+	if err := internal.DecodeXMLRequestWithLimits(r, &report, limits); err != nil {
 		return err
 	}
 
 	if report.Query != nil {
-		return h.handleQuery(r, w, report.Query)
+		return b.handleQuery(r, w, report.Query, depth)
 	} else if report.Multiget != nil {
-		return h.handleMultiget(r.Context(), w, report.Multiget)
+		return b.handleMultiget(r, w, report.Multiget)
+	} else if report.PrincipalPropertySearch != nil {
+		return b.handlePrincipalSearch(r, w, report.PrincipalPropertySearch)
 	}
 	return internal.HTTPErrorf(http.StatusBadRequest, "carddav: expected addressbook-query or addressbook-multiget element in REPORT request")
 }
 
+func decodePrincipalSearch(el *internal.PrincipalPropertySearch) *webdav.PrincipalSearchQuery {
+	query := &webdav.PrincipalSearchQuery{AnyOf: el.Test == "anyof"}
+	for _, ps := range el.PropertySearch {
+		match := webdav.PrincipalPropMatch{Text: ps.Match}
+		for _, raw := range ps.Prop.Raw {
+			if name, ok := raw.XMLName(); ok {
+				match.Props = append(match.Props, name)
+			}
+		}
+		query.Matches = append(query.Matches, match)
+	}
+	return query
+}
+
+func (b *backend) handlePrincipalSearch(r *http.Request, w http.ResponseWriter, search *internal.PrincipalPropertySearch) error {
+	searcher, ok := b.Backend.(webdav.PrincipalSearcher)
+	if !ok {
+		return internal.HTTPErrorf(http.StatusForbidden, "carddav: principal-property-search not supported")
+	}
+
+	principals, err := searcher.SearchPrincipals(r.Context(), decodePrincipalSearch(search))
+	if err != nil {
+		return err
+	}
+
+	var resps []internal.Response
+	for _, p := range principals {
+		resp, err := propFindSearchedPrincipal(search.Prop, &p)
+		if err != nil {
+			return err
+		}
+		resps = append(resps, *resp)
+	}
+	return internal.ServeMultiStatus(w, internal.NewMultiStatus(resps...))
+}
+
 func decodePropFilter(el *propFilter) (*PropFilter, error) {
 	pf := &PropFilter{Name: el.Name, Test: FilterTest(el.Test)}
 	if el.IsNotDefined != nil {
@@ -106,8 +175,12 @@ func decodePropFilter(el *propFilter) (*PropFilter, error) {
 		}
 		pf.IsNotDefined = true
 	}
-	for _, tm := range el.TextMatches {
-		pf.TextMatches = append(pf.TextMatches, *decodeTextMatch(&tm))
+	for _, tmEl := range el.TextMatches {
+		tm, err := decodeTextMatch(&tmEl)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatches = append(pf.TextMatches, *tm)
 	}
 	for _, paramEl := range el.Params {
 		param, err := decodeParamFilter(&paramEl)
@@ -128,17 +201,25 @@ func decodeParamFilter(el *paramFilter) (*ParamFilter, error) {
 		pf.IsNotDefined = true
 	}
 	if el.TextMatch != nil {
-		pf.TextMatch = decodeTextMatch(el.TextMatch)
+		tm, err := decodeTextMatch(el.TextMatch)
+		if err != nil {
+			return nil, err
+		}
+		pf.TextMatch = tm
 	}
 	return pf, nil
 }
 
-func decodeTextMatch(tm *textMatch) *TextMatch {
+func decodeTextMatch(tm *textMatch) (*TextMatch, error) {
+	if !internal.IsSupportedCollation(tm.Collation) {
+		return nil, newPreconditionError(http.StatusForbidden, PreconditionSupportedCollation)
+	}
 	return &TextMatch{
 		Text:            tm.Text,
 		NegateCondition: bool(tm.NegateCondition),
 		MatchType:       MatchType(tm.MatchType),
-	}
+		Collation:       tm.Collation,
+	}, nil
 }
 
 func decodeAddressDataReq(addressData *addressDataReq) (*AddressDataRequest, error) {
@@ -153,12 +234,12 @@ func decodeAddressDataReq(addressData *addressDataReq) (*AddressDataRequest, err
 	return req, nil
 }
 
-func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *addressbookQuery) error {
+func (b *backend) handleQuery(r *http.Request, w http.ResponseWriter, query *addressbookQuery, depth internal.Depth) error {
 	var q AddressBookQuery
 	if query.Prop != nil {
 		var addressData addressDataReq
 		if err := query.Prop.Decode(&addressData); err != nil && !internal.IsNotFound(err) {
-			return err
+			return &internal.HTTPError{Code: http.StatusBadRequest, Err: err}
 		}
 		req, err := decodeAddressDataReq(&addressData)
 		if err != nil {
@@ -170,6 +251,10 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *add
 	for _, el := range query.Filter.Props {
 		pf, err := decodePropFilter(&el)
 		if err != nil {
+			var httpErr *internal.HTTPError
+			if errors.As(err, &httpErr) {
+				return err
+			}
 			return &internal.HTTPError{Code: http.StatusBadRequest, Err: err}
 		}
 		q.PropFilters = append(q.PropFilters, *pf)
@@ -181,17 +266,13 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *add
 		}
 	}
 
-	aos, err := h.Backend.QueryAddressObjects(r.Context(), r.URL.Path, &q)
+	aos, err := b.queryAddressObjects(r, &q, depth)
 	if err != nil {
 		return err
 	}
 
 	var resps []internal.Response
 	for _, ao := range aos {
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
 		propfind := internal.PropFind{
 			Prop:     query.Prop,
 			AllProp:  query.AllProp,
@@ -205,15 +286,46 @@ func (h *Handler) handleQuery(r *http.Request, w http.ResponseWriter, query *add
 	}
 
 	ms := internal.NewMultiStatus(resps...)
-	return internal.ServeMultiStatus(w, ms)
+	return internal.ServePropFindMultiStatus(w, r, ms)
+}
+
+// queryAddressObjects runs an address book query on the request URI. With
+// "Depth: 0", the query only applies to the request URI itself: an address
+// object is matched against the query, and an address book never matches.
+// Queries on collections without a Depth header apply to their members, as
+// most clients omit it.
+func (b *backend) queryAddressObjects(r *http.Request, q *AddressBookQuery, depth internal.Depth) ([]AddressObject, error) {
+	isObject := b.resourceTypeAtPath(r.URL.Path) == resourceTypeAddressObject
+	if depth == internal.DepthZero && r.Header.Get("Depth") == "" && !isObject {
+		depth = internal.DepthOne
+	}
+	if depth != internal.DepthZero {
+		return b.Backend.QueryAddressObjects(r.Context(), r.URL.Path, q)
+	}
+	if !isObject {
+		return nil, nil
+	}
+
+	ao, err := b.Backend.GetAddressObject(r.Context(), r.URL.Path, &q.DataRequest)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := Match(q, ao); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, nil
+	}
+	return []AddressObject{*ao}, nil
 }
 
-func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, multiget *addressbookMultiget) error {
+func (b *backend) handleMultiget(r *http.Request, w http.ResponseWriter, multiget *addressbookMultiget) error {
+	ctx := r.Context()
+
 	var dataReq AddressDataRequest
 	if multiget.Prop != nil {
 		var addressData addressDataReq
 		if err := multiget.Prop.Decode(&addressData); err != nil && !internal.IsNotFound(err) {
-			return err
+			return &internal.HTTPError{Code: http.StatusBadRequest, Err: err}
 		}
 		decoded, err := decodeAddressDataReq(&addressData)
 		if err != nil {
@@ -224,17 +336,13 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 
 	var resps []internal.Response
 	for _, href := range multiget.Hrefs {
-		ao, err := h.Backend.GetAddressObject(ctx, href.Path, &dataReq)
+		ao, err := b.Backend.GetAddressObject(ctx, href.Path, &dataReq)
 		if err != nil {
 			resp := internal.NewErrorResponse(href.Path, err)
 			resps = append(resps, *resp)
 			continue
 		}
 
-		b := backend{
-			Backend: h.Backend,
-			Prefix:  strings.TrimSuffix(h.Prefix, "/"),
-		}
 		propfind := internal.PropFind{
 			Prop:     multiget.Prop,
 			AllProp:  multiget.AllProp,
@@ -248,12 +356,16 @@ func (h *Handler) handleMultiget(ctx context.Context, w http.ResponseWriter, mul
 	}
 
 	ms := internal.NewMultiStatus(resps...)
-	return internal.ServeMultiStatus(w, ms)
+	return internal.ServePropFindMultiStatus(w, r, ms)
 }
 
 type backend struct {
-	Backend Backend
-	Prefix  string
+	Backend          Backend
+	Prefix           string
+	MaxResourceSize  int64
+	MaxContentLines  int
+	StrictParsing    bool
+	MaxMultigetHrefs int
 }
 
 type resourceType int
@@ -278,18 +390,35 @@ func (b *backend) resourceTypeAtPath(reqPath string) resourceType {
 	return resourceType(len(strings.Split(p, "/")) - 1)
 }
 
+// collectionReports are the reports supported by address books.
+var collectionReports = []xml.Name{addressBookQueryName, addressBookMultigetName}
+
+func (b *backend) SupportedReports(path string) []xml.Name {
+	switch b.resourceTypeAtPath(path) {
+	case resourceTypeAddressBook:
+		return collectionReports
+	case resourceTypeRoot, resourceTypeUserPrincipal:
+		if _, ok := b.Backend.(webdav.PrincipalSearcher); ok {
+			return []xml.Name{internal.PrincipalPropertySearchName}
+		}
+	}
+	return nil
+}
+
 func (b *backend) Options(r *http.Request) (caps []string, allow []string, err error) {
 	caps = []string{"addressbook"}
 
-	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeAddressObject {
-		// Note: some clients assume the address book is read-only when
-		// DELETE/MKCOL are missing
+	// Note: some clients assume the address book is read-only when
+	// DELETE/MKCOL are missing
+	if t := b.resourceTypeAtPath(r.URL.Path); t == resourceTypeAddressBook {
+		return caps, []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL", http.MethodPost}, nil
+	} else if t != resourceTypeAddressObject {
 		return caps, []string{http.MethodOptions, "PROPFIND", "REPORT", "DELETE", "MKCOL"}, nil
 	}
 
 	var dataReq AddressDataRequest
 	_, err = b.Backend.GetAddressObject(r.Context(), r.URL.Path, &dataReq)
-	if httpErr, ok := err.(*internal.HTTPError); ok && httpErr.Code == http.StatusNotFound {
+	if internal.IsNotFound(err) {
 		return caps, []string{http.MethodOptions, http.MethodPut}, nil
 	} else if err != nil {
 		return nil, nil, err
@@ -458,9 +587,28 @@ func (b *backend) propFindUserPrincipal(ctx context.Context, propfind *internal.
 		},
 		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.CollectionName, internal.PrincipalName)),
 	}
+	if reports := b.SupportedReports(principalPath); len(reports) > 0 {
+		props[internal.SupportedReportSetName] = internal.PropFindValue(internal.NewSupportedReportSet(reports...))
+	}
 	return internal.NewPropFindResponse(principalPath, propfind, props)
 }
 
+// propFindSearchedPrincipal returns the properties of a principal matching a
+// principal-property-search REPORT request.
+func propFindSearchedPrincipal(prop *internal.Prop, p *webdav.Principal) (*internal.Response, error) {
+	if prop == nil {
+		return internal.NewOKResponse(p.Path), nil
+	}
+
+	props := map[xml.Name]internal.PropFindFunc{
+		internal.ResourceTypeName: internal.PropFindValue(internal.NewResourceType(internal.PrincipalName)),
+	}
+	if p.DisplayName != "" {
+		props[internal.DisplayNameName] = internal.PropFindValue(&internal.DisplayName{Name: p.DisplayName})
+	}
+	return internal.NewPropFindResponse(p.Path, &internal.PropFind{Prop: prop}, props)
+}
+
 func (b *backend) propFindHomeSet(ctx context.Context, propfind *internal.PropFind) (*internal.Response, error) {
 	homeSetPath, err := b.Backend.AddressBookHomeSetPath(ctx)
 	if err != nil {
@@ -483,6 +631,8 @@ func (b *backend) propFindHomeSet(ctx context.Context, propfind *internal.PropFi
 
 func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.PropFind, ab *AddressBook) (*internal.Response, error) {
 	props := map[xml.Name]internal.PropFindFunc{
+		internal.SupportedReportSetName: internal.PropFindValue(internal.NewSupportedReportSet(collectionReports...)),
+		internal.AddMemberName:          internal.PropFindValue(&internal.AddMember{Href: internal.Href{Path: ab.Path}}),
 		internal.CurrentUserPrincipalName: func(*internal.RawXMLValue) (interface{}, error) {
 			path, err := b.Backend.CurrentUserPrincipal(ctx)
 			if err != nil {
@@ -497,6 +647,9 @@ func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.Pr
 				{ContentType: vcard.MIMEType, Version: "4.0"},
 			},
 		}),
+		supportedCollationSetName: internal.PropFindValue(&supportedCollationSet{
+			Collations: internal.Collations,
+		}),
 		// TODO: Gather UserPrivilege from backend to control read-and-write
 		internal.CurrentUserPrivilegeSetName: internal.PropFindValue(&internal.CurrentUserPrivilegeSet{
 			Privilege: []internal.Privilege{{
@@ -516,9 +669,9 @@ func (b *backend) propFindAddressBook(ctx context.Context, propfind *internal.Pr
 			Description: ab.Description,
 		})
 	}
-	if ab.MaxResourceSize > 0 {
+	if size := b.maxResourceSize(ab); size > 0 {
 		props[maxResourceSizeName] = internal.PropFindValue(&maxResourceSize{
-			Size: ab.MaxResourceSize,
+			Size: size,
 		})
 	}
 
@@ -650,6 +803,16 @@ func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*
 	return resp, nil
 }
 
+// maxResourceSize returns the maximum size of address objects in a address book: the
+// smallest of the address book limit and the handler limit. The address book may be nil.
+func (b *backend) maxResourceSize(ab *AddressBook) int64 {
+	size := b.MaxResourceSize
+	if ab != nil && ab.MaxResourceSize > 0 && (size == 0 || ab.MaxResourceSize < size) {
+		size = ab.MaxResourceSize
+	}
+	return size
+}
+
 func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	ifNoneMatch := webdav.ConditionalMatch(r.Header.Get("If-None-Match"))
 	ifMatch := webdav.ConditionalMatch(r.Header.Get("If-Match"))
@@ -668,15 +831,46 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: unsupporetd Content-Type %q", t)
 	}
 
-	// TODO: check CARDDAV:max-resource-size precondition
-	card, err := vcard.NewDecoder(r.Body).Decode()
+	// Address objects added to the address book itself are named after
+	// their UID
+	objectPath, addressBookPath := r.URL.Path, path.Dir(r.URL.Path)
+	addMember := b.resourceTypeAtPath(r.URL.Path) == resourceTypeAddressBook
+	if addMember {
+		addressBookPath = r.URL.Path
+	}
+
+	// The address book may not exist, in which case the backend reports the error
+	ab, _ := b.Backend.GetAddressBook(r.Context(), addressBookPath)
+	maxSize := b.maxResourceSize(ab)
+	if maxSize > 0 && r.ContentLength > maxSize {
+		return newPreconditionError(http.StatusForbidden, PreconditionMaxResourceSize)
+	}
+	body := internal.NewContentLimitReader(r.Body, maxSize, b.MaxContentLines)
+	data, err := io.ReadAll(body)
+	if body.Exceeded() {
+		return newPreconditionError(http.StatusForbidden, PreconditionMaxResourceSize)
+	} else if err != nil {
+		return err
+	}
+	card, err := b.decodeCard(data)
 	if err != nil {
-		// TODO: send CARDDAV:valid-address-data error
-		return internal.HTTPErrorf(http.StatusBadRequest, "carddav: failed to parse vCard: %v", err)
+		return err
+	}
+
+	if addMember {
+		name, err := ObjectName(card)
+		if err != nil {
+			return internal.HTTPErrorf(http.StatusBadRequest, "carddav: invalid address object: %v", err)
+		}
+		objectPath = path.Join(addressBookPath, name)
+		if err := b.checkNoUIDConflict(r.Context(), objectPath); err != nil {
+			return err
+		}
+		opts = PutAddressObjectOptions{IfNoneMatch: "*"}
 	}
 
-	// TODO: add support for the CARDDAV:no-uid-conflict error
-	ao, err := b.Backend.PutAddressObject(r.Context(), r.URL.Path, card, &opts)
+	// TODO: add support for the CARDDAV:no-uid-conflict error on other paths
+	ao, err := b.Backend.PutAddressObject(r.Context(), objectPath, card, &opts)
 	if err != nil {
 		return err
 	}
@@ -687,7 +881,7 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 		w.Header().Set("Last-Modified", ao.ModTime.UTC().Format(http.TimeFormat))
 	}
 	if ao.Path != "" {
-		w.Header().Set("Location", ao.Path)
+		w.Header().Set("Location", (&url.URL{Path: ao.Path}).String())
 	}
 
 	// TODO: http.StatusNoContent if the resource already existed
@@ -696,6 +890,47 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// checkNoUIDConflict checks that no address object is stored at the path
+// derived from its UID.
+// decodeCard parses an address object uploaded with PUT. Malformed objects
+// are rejected with 403 Forbidden and the CARDDAV:valid-address-data
+// precondition, along with the position of the error.
+func (b *backend) decodeCard(data []byte) (vcard.Card, error) {
+	if b.StrictParsing {
+		if err := internal.CheckContentSyntax(data); err != nil {
+			return nil, newContentError(PreconditionValidAddressData, err)
+		}
+	}
+
+	card, err := vcard.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		// The decoder doesn't report the position of errors
+		if syntaxErr := internal.CheckContentSyntax(data); syntaxErr != nil {
+			err = syntaxErr
+		}
+		return nil, newContentError(PreconditionValidAddressData, err)
+	}
+	return card, nil
+}
+
+func (b *backend) checkNoUIDConflict(ctx context.Context, p string) error {
+	_, err := b.Backend.GetAddressObject(ctx, p, &AddressDataRequest{})
+	if err == nil {
+		return newPreconditionError(http.StatusForbidden, PreconditionNoUIDConflict)
+	} else if !internal.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Post handles RFC 5995 add-member requests on address books, see Put.
+func (b *backend) Post(w http.ResponseWriter, r *http.Request) error {
+	if b.resourceTypeAtPath(r.URL.Path) != resourceTypeAddressBook {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "carddav: POST requests must target an address book")
+	}
+	return b.Put(w, r)
+}
+
 func (b *backend) Delete(r *http.Request) error {
 	switch b.resourceTypeAtPath(r.URL.Path) {
 	case resourceTypeAddressBook:
@@ -732,14 +967,6 @@ func (b *backend) Mkcol(r *http.Request) error {
 	return b.Backend.CreateAddressBook(r.Context(), &ab)
 }
 
-func (b *backend) Copy(r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "carddav: Copy not implemented")
-}
-
-func (b *backend) Move(r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
-	return false, internal.HTTPErrorf(http.StatusNotImplemented, "carddav: Move not implemented")
-}
-
 // PreconditionType as defined in https://tools.ietf.org/rfcmarkup?doc=6352#section-6.3.2.1
 type PreconditionType string
 
@@ -748,13 +975,25 @@ const (
 	PreconditionSupportedAddressData PreconditionType = "supported-address-data"
 	PreconditionValidAddressData     PreconditionType = "valid-address-data"
 	PreconditionMaxResourceSize      PreconditionType = "max-resource-size"
+	PreconditionSupportedCollation   PreconditionType = "supported-collation"
 )
 
 func NewPreconditionError(err PreconditionType) error {
+	return newPreconditionError(http.StatusConflict, err)
+}
+
+// newContentError returns a 403 Forbidden precondition error describing a
+// malformed address object.
+func newContentError(precondition PreconditionType, err error) error {
+	name := xml.Name{Space: "urn:ietf:params:xml:ns:carddav", Local: string(precondition)}
+	return internal.NewContentHTTPError(http.StatusForbidden, name, err)
+}
+
+func newPreconditionError(code int, err PreconditionType) error {
 	name := xml.Name{Space: "urn:ietf:params:xml:ns:carddav", Local: string(err)}
 	elem := internal.NewRawXMLElement(name, nil, nil)
 	return &internal.HTTPError{
-		Code: 409,
+		Code: code,
 		Err: &internal.Error{
 			Raw: []internal.RawXMLValue{*elem},
 		},
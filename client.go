@@ -2,10 +2,15 @@ package webdav
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-webdav/internal"
@@ -36,6 +41,48 @@ func HTTPClientWithBasicAuth(c HTTPClient, username, password string) HTTPClient
 	return &basicAuthHTTPClient{c, username, password}
 }
 
+// HTTPClientOptions contains options for NewHTTPClient.
+type HTTPClientOptions struct {
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept
+	// open to the server. If zero, http.DefaultMaxIdleConnsPerHost is used.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is the maximum amount of time an idle connection is
+	// kept open. If zero, idle connections are kept open for 90 seconds.
+	IdleConnTimeout time.Duration
+	// EnableHTTP2 allows the client to negotiate HTTP/2 with the server.
+	EnableHTTP2 bool
+}
+
+// NewHTTPClient creates an HTTP client with tuned connection pooling, suitable
+// for clients issuing many requests to the same server, e.g. when mirroring.
+// The result can be passed to NewClient.
+//
+// A connection is only reused once the previous response body has been
+// consumed. Client drains response bodies it doesn't use, including large
+// PROPFIND multi-status responses, so callers don't need to do it. Callers
+// must close the body returned by Client.Open.
+func NewHTTPClient(opts *HTTPClientOptions) *http.Client {
+	if opts == nil {
+		opts = new(HTTPClientOptions)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	if opts.MaxIdleConnsPerHost > transport.MaxIdleConns {
+		transport.MaxIdleConns = opts.MaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	transport.ForceAttemptHTTP2 = opts.EnableHTTP2
+	if !opts.EnableHTTP2 {
+		// A non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	return &http.Client{Transport: transport}
+}
+
 // Client provides access to a remote WebDAV filesystem.
 type Client struct {
 	ic *internal.Client
@@ -110,16 +157,17 @@ func fileInfoFromResponse(resp *internal.Response) (*FileInfo, error) {
 			return nil, err
 		}
 
-		var getETag internal.GetETag
-		if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
-			return nil, err
-		}
-
 		fi.Size = getLen.Length
 		fi.MIMEType = getType.Type
-		fi.ETag = string(getETag.ETag)
 	}
 
+	// Some servers, including this package's, provide ETags for collections
+	var getETag internal.GetETag
+	if err := resp.DecodeProp(&getETag); err != nil && !internal.IsNotFound(err) {
+		return nil, err
+	}
+	fi.ETag = string(getETag.ETag)
+
 	var getMod internal.GetLastModified
 	if err := resp.DecodeProp(&getMod); err != nil && !internal.IsNotFound(err) {
 		return nil, err
@@ -212,13 +260,83 @@ func (c *Client) Create(ctx context.Context, name string) (io.WriteCloser, error
 			done <- err
 			return
 		}
-		resp.Body.Close()
+		internal.DiscardBody(resp.Body)
 		done <- nil
 	}()
 
 	return &fileWriter{pw, done}, nil
 }
 
+// UploadOptions holds options for Client.Upload.
+type UploadOptions struct {
+	// DigestAlgorithms lists the algorithms used to compute the Digest header
+	// sent along with the file. If nil, SHA-256 is used.
+	DigestAlgorithms []DigestAlgorithm
+}
+
+// Upload writes a file's contents, sending a digest of the contents so that
+// the server can detect corruption. The reader is read twice: once to compute
+// the digest and once to send the request.
+func (c *Client) Upload(ctx context.Context, name string, r io.ReadSeeker, opts *UploadOptions) (*FileInfo, error) {
+	algs := []DigestAlgorithm{DigestSHA256}
+	if opts != nil && opts.DigestAlgorithms != nil {
+		algs = opts.DigestAlgorithms
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := formatDigest(r, algs)
+	if err != nil {
+		return nil, err
+	}
+	end, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	req, err := c.ic.NewRequest(http.MethodPut, name, io.NopCloser(r))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = end - start
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Digest", digest)
+
+	resp, err := c.ic.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	internal.DiscardBody(resp.Body)
+
+	fi := &FileInfo{
+		Path:     name,
+		Size:     end - start,
+		MIMEType: resp.Header.Get("Content-Type"),
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		var e internal.ETag
+		if err := e.UnmarshalText([]byte(etag)); err != nil {
+			return nil, err
+		}
+		fi.ETag = string(e)
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		t, err := http.ParseTime(lastModified)
+		if err != nil {
+			return nil, err
+		}
+		fi.ModTime = t
+	}
+	return fi, nil
+}
+
 // RemoveAll deletes a file. If the file is a directory, all of its descendants
 // are recursively deleted as well.
 func (c *Client) RemoveAll(ctx context.Context, name string) error {
@@ -231,10 +349,95 @@ func (c *Client) RemoveAll(ctx context.Context, name string) error {
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	internal.DiscardBody(resp.Body)
 	return nil
 }
 
+// ETagDiff is the result of DiffETags.
+type ETagDiff struct {
+	// Changed lists the members which are new or whose ETag changed.
+	Changed []FileInfo
+	// Deleted lists the known paths which aren't members anymore.
+	Deleted []string
+}
+
+// DiffETags lists the changes made to the members of a directory since a
+// previous listing, by comparing their ETags with the known ones, indexed by
+// path, as returned in FileInfo.ETag. This is the fallback used by clients
+// to synchronize collections on servers which don't support sync-collection
+// REPORT requests. If the server provides ETags for collections, comparing
+// the ETag of the directory returned by Stat first avoids listing unchanged
+// directories.
+func (c *Client) DiffETags(ctx context.Context, name string, known map[string]string) (*ETagDiff, error) {
+	l, err := c.ReadDir(ctx, name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]string, len(known))
+	for p := range known {
+		byPath[path.Clean(c.ic.ResolveHref(p).Path)] = p
+	}
+	dir := path.Clean(c.ic.ResolveHref(name).Path)
+
+	diff := &ETagDiff{}
+	seen := make(map[string]bool, len(l))
+	for _, fi := range l {
+		p := path.Clean(fi.Path)
+		if p == dir {
+			continue
+		}
+		seen[p] = true
+		if knownPath, ok := byPath[p]; !ok || known[knownPath] != fi.ETag {
+			diff.Changed = append(diff.Changed, fi)
+		}
+	}
+	for p, knownPath := range byPath {
+		if !seen[p] {
+			diff.Deleted = append(diff.Deleted, knownPath)
+		}
+	}
+	sort.Strings(diff.Deleted)
+	return diff, nil
+}
+
+// RemoveAllBatch deletes multiple members of a directory with a single
+// batch-delete REPORT request, which is only supported by servers built with
+// this package. The returned map contains an error for each name which
+// couldn't be deleted.
+func (c *Client) RemoveAllBatch(ctx context.Context, dir string, names []string) (map[string]error, error) {
+	body := internal.BatchDelete{Hrefs: make([]internal.Href, 0, len(names))}
+	byPath := make(map[string]string, len(names))
+	for _, name := range names {
+		u := c.ic.ResolveHref(name)
+		body.Hrefs = append(body.Hrefs, internal.Href(*u))
+		byPath[path.Clean(u.Path)] = name
+	}
+
+	req, err := c.ic.NewXMLRequest("REPORT", dir, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := c.ic.DoMultiStatus(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(map[string]error)
+	for _, resp := range ms.Responses {
+		p, err := resp.Path()
+		if err == nil {
+			continue
+		}
+		if name, ok := byPath[path.Clean(p)]; ok {
+			p = name
+		}
+		errs[p] = err
+	}
+	return errs, nil
+}
+
 // Mkdir creates a new directory.
 func (c *Client) Mkdir(ctx context.Context, name string) error {
 	req, err := c.ic.NewRequest("MKCOL", name, nil)
@@ -246,7 +449,7 @@ func (c *Client) Mkdir(ctx context.Context, name string) error {
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	internal.DiscardBody(resp.Body)
 	return nil
 }
 
@@ -277,7 +480,7 @@ func (c *Client) Copy(ctx context.Context, name, dest string, options *CopyOptio
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	internal.DiscardBody(resp.Body)
 	return nil
 }
 
@@ -299,6 +502,105 @@ func (c *Client) Move(ctx context.Context, name, dest string, options *MoveOptio
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	internal.DiscardBody(resp.Body)
+	return nil
+}
+
+// CopyTo copies a file to another server, streaming its contents from a GET
+// request on this server to a PUT request on the destination. If the file is
+// a directory, its descendants are copied as well, and directories are
+// created on the destination as needed.
+//
+// The content type is preserved. WebDAV doesn't define a way to set
+// modification times, they're sent in the X-OC-Mtime header understood by
+// some servers.
+//
+// Failing to copy a file doesn't abort the copy of the other ones: the
+// returned error joins the errors of each file.
+func (c *Client) CopyTo(ctx context.Context, name string, dest *Client, destName string) error {
+	fi, err := c.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir {
+		return c.copyFileTo(ctx, fi, dest, destName)
+	}
+
+	var errs []error
+	c.copyDirTo(ctx, fi.Path, dest, destName, &errs)
+	return errors.Join(errs...)
+}
+
+func (c *Client) copyDirTo(ctx context.Context, dir string, dest *Client, destDir string, errs *[]error) {
+	if err := dest.Mkdir(ctx, destDir); err != nil && internal.HTTPErrorFromError(err).Code != http.StatusMethodNotAllowed {
+		// 405 Method Not Allowed means that the directory already exists
+		*errs = append(*errs, fmt.Errorf("webdav: failed to create %q: %w", destDir, err))
+		return
+	}
+
+	l, err := c.ReadDir(ctx, dir, false)
+	if err != nil {
+		*errs = append(*errs, fmt.Errorf("webdav: failed to list %q: %w", dir, err))
+		return
+	}
+
+	prefix := path.Clean(dir)
+	if prefix != "/" {
+		prefix += "/"
+	}
+	for i := range l {
+		fi := &l[i]
+		rel, ok := strings.CutPrefix(path.Clean(fi.Path), prefix)
+		if !ok || rel == "" {
+			// The directory itself
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			*errs = append(*errs, err)
+			return
+		}
+
+		target := path.Join(destDir, rel)
+		if fi.IsDir {
+			c.copyDirTo(ctx, fi.Path, dest, target, errs)
+		} else if err := c.copyFileTo(ctx, fi, dest, target); err != nil {
+			*errs = append(*errs, err)
+		}
+	}
+}
+
+func (c *Client) copyFileTo(ctx context.Context, fi *FileInfo, dest *Client, destName string) error {
+	req, err := c.ic.NewRequest(http.MethodGet, fi.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.ic.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("webdav: failed to read %q: %w", fi.Path, err)
+	}
+	defer resp.Body.Close()
+
+	req, err = dest.ic.NewRequest(http.MethodPut, destName, resp.Body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = resp.ContentLength
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+	if t := resp.Header.Get("Content-Type"); t != "" {
+		req.Header.Set("Content-Type", t)
+	} else if fi.MIMEType != "" {
+		req.Header.Set("Content-Type", fi.MIMEType)
+	}
+	if !fi.ModTime.IsZero() {
+		req.Header.Set("X-OC-Mtime", strconv.FormatInt(fi.ModTime.Unix(), 10))
+	}
+
+	putResp, err := dest.ic.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("webdav: failed to write %q: %w", destName, err)
+	}
+	internal.DiscardBody(putResp.Body)
 	return nil
 }
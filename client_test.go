@@ -0,0 +1,144 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClientDiffETags(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"cal/a.ics": "a",
+		"cal/b.ics": "b",
+		"cal/c.ics": "c",
+	})
+	srv := httptest.NewServer(&Handler{FileSystem: fs})
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	l, err := c.ReadDir(ctx, "/cal/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := make(map[string]string)
+	for _, fi := range l {
+		if !fi.IsDir {
+			known[fi.Path] = fi.ETag
+		}
+	}
+	dir, err := c.Stat(ctx, "/cal/")
+	if err != nil {
+		t.Fatal(err)
+	} else if dir.ETag == "" {
+		t.Fatalf("Stat(): missing collection ETag")
+	}
+
+	if _, _, err := fs.Create(ctx, "/cal/a.ics", io.NopCloser(strings.NewReader("new a")), &CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fs.Create(ctx, "/cal/d.ics", io.NopCloser(strings.NewReader("d")), &CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll(ctx, "/cal/c.ics", &RemoveAllOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := c.Stat(ctx, "/cal/"); err != nil {
+		t.Fatal(err)
+	} else if fi.ETag == dir.ETag {
+		t.Errorf("Stat(): collection ETag unchanged")
+	}
+
+	diff, err := c.DiffETags(ctx, "/cal/", known)
+	if err != nil {
+		t.Fatalf("DiffETags() = %v", err)
+	}
+	var changed []string
+	for _, fi := range diff.Changed {
+		changed = append(changed, fi.Path)
+	}
+	if want := []string{"/cal/a.ics", "/cal/d.ics"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("DiffETags(): got changed %v, want %v", changed, want)
+	}
+	if want := []string{"/cal/c.ics"}; !reflect.DeepEqual(diff.Deleted, want) {
+		t.Errorf("DiffETags(): got deleted %v, want %v", diff.Deleted, want)
+	}
+}
+
+func TestClientCopyTo(t *testing.T) {
+	srcFS := newTestFileSystem(t, map[string]string{
+		"photos/a.jpg":       "a",
+		"photos/2024/b.jpg":  "b",
+		"photos/2024/c.jpg":  "c",
+		"photos/empty/.keep": "",
+		"photos-other/d.jpg": "d",
+	})
+	src := httptest.NewServer(&Handler{FileSystem: srcFS})
+	defer src.Close()
+
+	destFS := newTestFileSystem(t, nil)
+	dest := httptest.NewServer(&Handler{
+		FileSystem: destFS,
+		Authorizer: AuthorizerFunc(func(r *http.Request, method, p string) error {
+			if p == "/backup/2024/c.jpg" {
+				return NewHTTPError(http.StatusForbidden, errors.New("read-only"))
+			}
+			return nil
+		}),
+	})
+	defer dest.Close()
+
+	srcClient, err := NewClient(src.Client(), src.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destClient, err := NewClient(dest.Client(), dest.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	err = srcClient.CopyTo(ctx, "/photos/", destClient, "/backup")
+	if err == nil || !strings.Contains(err.Error(), "/backup/2024/c.jpg") {
+		t.Errorf("CopyTo() = %v, want an error for /backup/2024/c.jpg", err)
+	}
+
+	for name, want := range map[string]string{
+		"/backup/a.jpg":       "a",
+		"/backup/2024/b.jpg":  "b",
+		"/backup/empty/.keep": "",
+	} {
+		rc, err := destFS.Open(ctx, name)
+		if err != nil {
+			t.Errorf("Open(%q) = %v", name, err)
+			continue
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(b) != want {
+			t.Errorf("%v: got %q, want %q", name, b, want)
+		}
+	}
+	for _, name := range []string{"/backup/2024/c.jpg", "/backup/d.jpg"} {
+		if _, err := destFS.Stat(ctx, name); err == nil {
+			t.Errorf("Stat(%q): file shouldn't exist", name)
+		}
+	}
+
+	if err := srcClient.CopyTo(ctx, "/photos/a.jpg", destClient, "/single.jpg"); err != nil {
+		t.Fatalf("CopyTo() with a file = %v", err)
+	}
+	if _, err := destFS.Stat(ctx, "/single.jpg"); err != nil {
+		t.Errorf("Stat() = %v", err)
+	}
+}
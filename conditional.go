@@ -0,0 +1,43 @@
+package webdav
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// checkConditionalRead evaluates the preconditions of a GET or HEAD request
+// against a file, in the order described in RFC 7232 section 6. It returns
+// http.StatusNotModified if the client's copy is up-to-date,
+// http.StatusPreconditionFailed if a precondition failed, and zero if the
+// request should be processed normally.
+func checkConditionalRead(h http.Header, fi *FileInfo) (int, error) {
+	modTime := fi.ModTime.Truncate(time.Second)
+
+	if ifMatch := ConditionalMatch(h.Get("If-Match")); ifMatch.IsSet() {
+		if ok, err := ifMatch.MatchETag(fi.ETag); err != nil {
+			return 0, internal.HTTPErrorf(http.StatusBadRequest, "webdav: invalid If-Match header: %v", err)
+		} else if !ok {
+			return http.StatusPreconditionFailed, nil
+		}
+	} else if t, err := http.ParseTime(h.Get("If-Unmodified-Since")); err == nil && !fi.ModTime.IsZero() {
+		if modTime.After(t) {
+			return http.StatusPreconditionFailed, nil
+		}
+	}
+
+	if ifNoneMatch := ConditionalMatch(h.Get("If-None-Match")); ifNoneMatch.IsSet() {
+		if ok, err := ifNoneMatch.MatchETagWeak(fi.ETag); err != nil {
+			return 0, internal.HTTPErrorf(http.StatusBadRequest, "webdav: invalid If-None-Match header: %v", err)
+		} else if ok {
+			return http.StatusNotModified, nil
+		}
+	} else if t, err := http.ParseTime(h.Get("If-Modified-Since")); err == nil && !fi.ModTime.IsZero() {
+		if !modTime.After(t) {
+			return http.StatusNotModified, nil
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,110 @@
+package webdav
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures Cross-Origin Resource Sharing for a Handler, so that
+// browser-based clients can access the server.
+//
+// WebDAV methods and headers aren't part of the CORS safelist, so they are
+// explicitly listed in preflight responses.
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to access the server, e.g.
+	// "https://example.org". The special value "*" allows all origins.
+	AllowedOrigins []string
+	// AllowedHeaders lists the request headers clients are allowed to send.
+	// If nil, a default list containing the headers used by WebDAV, CalDAV
+	// and CardDAV is used.
+	AllowedHeaders []string
+	// AllowCredentials allows requests with credentials, e.g. cookies or
+	// an Authorization header.
+	AllowCredentials bool
+	// MaxAge indicates how long the results of a preflight request can be
+	// cached by clients. If zero, no Access-Control-Max-Age header is sent.
+	MaxAge time.Duration
+}
+
+var corsAllowedMethods = []string{
+	http.MethodOptions,
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPut,
+	http.MethodPost,
+	http.MethodDelete,
+	"PROPFIND",
+	"PROPPATCH",
+	"MKCOL",
+	"COPY",
+	"MOVE",
+	"REPORT",
+}
+
+var corsDefaultAllowedHeaders = []string{
+	"Authorization",
+	"Brief",
+	"Content-MD5",
+	"Content-Type",
+	"Depth",
+	"Destination",
+	"Digest",
+	"If",
+	"If-Match",
+	"If-None-Match",
+	"Overwrite",
+	"Prefer",
+}
+
+var corsExposedHeaders = []string{
+	"Allow",
+	"DAV",
+	"ETag",
+	"Lock-Token",
+	"Location",
+	"Preference-Applied",
+}
+
+func (opts *CORSOptions) allowOrigin(origin string) bool {
+	for _, o := range opts.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// serve sets the CORS response headers. It returns true if the request is a
+// preflight request, in which case the response has been written.
+func (opts *CORSOptions) serve(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !opts.allowOrigin(origin) {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		return false
+	}
+
+	allowedHeaders := opts.AllowedHeaders
+	if allowedHeaders == nil {
+		allowedHeaders = corsDefaultAllowedHeaders
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+	if opts.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,110 @@
+package webdav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// DebugOptions configures the capture of requests and responses, to debug
+// specific clients.
+//
+// Captured messages are written to Writer in the HTTP/1.1 wire format, each
+// preceded by a line identifying the exchange. Bodies are copied as they are
+// streamed, so messages of concurrent requests may be interleaved. Credentials
+// in the Authorization and Proxy-Authorization headers are redacted.
+type DebugOptions struct {
+	// Match reports whether a request should be captured. If nil, all
+	// requests are captured.
+	Match func(r *http.Request) bool
+	// Writer receives the captured messages.
+	Writer io.Writer
+
+	mu sync.Mutex
+	n  uint64
+}
+
+var debugRedactedHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+func (opts *DebugOptions) write(b []byte) {
+	opts.mu.Lock()
+	defer opts.mu.Unlock()
+	opts.Writer.Write(b)
+}
+
+func (opts *DebugOptions) writeHeader(startLine string, h http.Header) {
+	h = h.Clone()
+	for _, k := range debugRedactedHeaders {
+		if _, ok := h[k]; ok {
+			h.Set(k, "[redacted]")
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(startLine + "\r\n")
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	opts.write(buf.Bytes())
+}
+
+// wrap starts capturing an exchange if the request matches.
+func (opts *DebugOptions) wrap(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	if opts.Writer == nil || (opts.Match != nil && !opts.Match(r)) {
+		return w, r
+	}
+
+	opts.mu.Lock()
+	opts.n++
+	id := opts.n
+	opts.mu.Unlock()
+
+	opts.write([]byte(fmt.Sprintf("\n--- request %v\n", id)))
+	opts.writeHeader(fmt.Sprintf("%v %v %v", r.Method, r.URL.RequestURI(), r.Proto), r.Header)
+
+	r = r.WithContext(r.Context())
+	r.Body = &debugReadCloser{r.Body, opts}
+	return &debugResponseWriter{ResponseWriter: w, opts: opts, id: id}, r
+}
+
+type debugReadCloser struct {
+	io.ReadCloser
+	opts *DebugOptions
+}
+
+func (rc *debugReadCloser) Read(b []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(b)
+	if n > 0 {
+		rc.opts.write(b[:n])
+	}
+	return n, err
+}
+
+type debugResponseWriter struct {
+	http.ResponseWriter
+	opts        *DebugOptions
+	id          uint64
+	wroteHeader bool
+}
+
+func (dw *debugResponseWriter) WriteHeader(code int) {
+	if !dw.wroteHeader {
+		dw.wroteHeader = true
+		dw.opts.write([]byte(fmt.Sprintf("\n--- response %v\n", dw.id)))
+		dw.opts.writeHeader(fmt.Sprintf("HTTP/1.1 %v %v", code, http.StatusText(code)), dw.Header())
+	}
+	dw.ResponseWriter.WriteHeader(code)
+}
+
+func (dw *debugResponseWriter) Write(b []byte) (int, error) {
+	if !dw.wroteHeader {
+		dw.WriteHeader(http.StatusOK)
+	}
+	dw.opts.write(b)
+	return dw.ResponseWriter.Write(b)
+}
+
+func (dw *debugResponseWriter) Unwrap() http.ResponseWriter {
+	return dw.ResponseWriter
+}
@@ -0,0 +1,143 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// DigestAlgorithm is an algorithm used to compute the digest of a file, as
+// defined in RFC 3230.
+type DigestAlgorithm string
+
+const (
+	DigestMD5    DigestAlgorithm = "MD5"
+	DigestSHA256 DigestAlgorithm = "SHA-256"
+)
+
+var defaultDigestAlgorithms = []DigestAlgorithm{DigestMD5, DigestSHA256}
+
+func (alg DigestAlgorithm) newHash() hash.Hash {
+	switch alg {
+	case DigestMD5:
+		return md5.New()
+	case DigestSHA256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+// findDigestAlgorithm looks up an algorithm by name in algs. Algorithms not
+// supported by newHash are never found.
+func findDigestAlgorithm(algs []DigestAlgorithm, name string) (DigestAlgorithm, bool) {
+	for _, alg := range algs {
+		if strings.EqualFold(string(alg), name) && alg.newHash() != nil {
+			return alg, true
+		}
+	}
+	return "", false
+}
+
+type expectedDigest struct {
+	alg  DigestAlgorithm
+	hash hash.Hash
+	sum  []byte
+}
+
+// parseRequestDigests parses the Content-MD5 and Digest headers of a request.
+// Digests using an algorithm not listed in algs, or not supported, are
+// ignored.
+func parseRequestDigests(h http.Header, algs []DigestAlgorithm) ([]expectedDigest, error) {
+	var digests []expectedDigest
+	add := func(alg DigestAlgorithm, value string) error {
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return internal.HTTPErrorf(http.StatusBadRequest, "webdav: malformed %v digest: %v", alg, err)
+		}
+		digests = append(digests, expectedDigest{alg: alg, hash: alg.newHash(), sum: sum})
+		return nil
+	}
+
+	if v := h.Get("Content-MD5"); v != "" {
+		if alg, ok := findDigestAlgorithm(algs, string(DigestMD5)); ok {
+			if err := add(alg, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, v := range h.Values("Digest") {
+		for _, instance := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(instance), "=")
+			if !ok {
+				return nil, internal.HTTPErrorf(http.StatusBadRequest, "webdav: malformed Digest header")
+			}
+			if alg, ok := findDigestAlgorithm(algs, name); ok {
+				if err := add(alg, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return digests, nil
+}
+
+// digestVerifier wraps a request body and checks its digests once the end of
+// the body is reached. On mismatch, Read returns an error instead of io.EOF,
+// so that FileSystem implementations abort the write.
+type digestVerifier struct {
+	r       io.ReadCloser
+	digests []expectedDigest
+}
+
+func (dv *digestVerifier) Read(b []byte) (int, error) {
+	n, err := dv.r.Read(b)
+	for _, d := range dv.digests {
+		d.hash.Write(b[:n])
+	}
+	if err == io.EOF {
+		for _, d := range dv.digests {
+			if !bytes.Equal(d.hash.Sum(nil), d.sum) {
+				return n, internal.HTTPErrorf(http.StatusBadRequest, "webdav: %v digest mismatch", d.alg)
+			}
+		}
+	}
+	return n, err
+}
+
+func (dv *digestVerifier) Close() error {
+	return dv.r.Close()
+}
+
+// formatDigest computes the value of a Digest header for r.
+func formatDigest(r io.Reader, algs []DigestAlgorithm) (string, error) {
+	hashes := make([]hash.Hash, len(algs))
+	writers := make([]io.Writer, len(algs))
+	for i, alg := range algs {
+		hashes[i] = alg.newHash()
+		if hashes[i] == nil {
+			return "", fmt.Errorf("webdav: unsupported digest algorithm %q", alg)
+		}
+		writers[i] = hashes[i]
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return "", err
+	}
+
+	instances := make([]string, len(algs))
+	for i, alg := range algs {
+		instances[i] = string(alg) + "=" + base64.StdEncoding.EncodeToString(hashes[i].Sum(nil))
+	}
+	return strings.Join(instances, ","), nil
+}
@@ -0,0 +1,116 @@
+package webdav
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// DirListing is the data passed to the template used to render a directory
+// listing.
+type DirListing struct {
+	// Path is the path of the listed directory.
+	Path string
+	// Parent is the href of the parent directory, or empty for the root.
+	Parent  string
+	Entries []DirListingEntry
+}
+
+// DirListingEntry describes a single entry of a directory listing.
+type DirListingEntry struct {
+	Name     string
+	Href     string
+	Size     int64
+	ModTime  time.Time
+	IsDir    bool
+	MIMEType string
+}
+
+// DefaultDirListingTemplate is the template used to render directory listings
+// when Handler.DirListingTemplate is nil.
+var DefaultDirListingTemplate = template.Must(template.New("dirlisting").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<thead>
+<tr><th>Name</th><th>Size</th><th>Last modified</th></tr>
+</thead>
+<tbody>
+{{- if .Parent}}
+<tr><td><a href="{{.Parent}}">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+<tr><td><a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{if not .ModTime.IsZero}}{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+func (b *backend) serveDirListing(w http.ResponseWriter, r *http.Request, fi *FileInfo) error {
+	children, err := b.readDir(r.Context(), fi.Path, false)
+	if err != nil {
+		return err
+	}
+
+	// Hrefs include the prefix stripped from the request URI, if any
+	prefix := internal.RequestPathPrefix(r)
+
+	dirPath := path.Clean(fi.Path)
+	listing := DirListing{Path: fi.Path}
+	if dirPath != "/" {
+		parent := path.Dir(dirPath)
+		if parent != "/" {
+			parent += "/"
+		}
+		listing.Parent = (&url.URL{Path: prefix + parent}).String()
+	}
+	for _, child := range children {
+		childPath := path.Clean(child.Path)
+		if childPath == dirPath {
+			continue
+		}
+
+		href := childPath
+		if child.IsDir {
+			href += "/"
+		}
+		listing.Entries = append(listing.Entries, DirListingEntry{
+			Name:     path.Base(childPath),
+			Href:     (&url.URL{Path: prefix + href}).String(),
+			Size:     child.Size,
+			ModTime:  child.ModTime,
+			IsDir:    child.IsDir,
+			MIMEType: child.MIMEType,
+		})
+	}
+
+	tpl := b.DirListingTemplate
+	if tpl == nil {
+		tpl = DefaultDirListingTemplate
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &listing); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+	return nil
+}
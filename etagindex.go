@@ -0,0 +1,87 @@
+package webdav
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// etagIndex holds the ETags listed in the index file of a directory, see
+// LocalFileSystemOptions.ETagIndex.
+type etagIndex struct {
+	modTime time.Time
+	etags   map[string]string
+}
+
+// loadETagIndex reads the ETag index of a directory. It returns nil if the
+// directory has no index.
+func (fs *limitedLocalFileSystem) loadETagIndex(dir string) *etagIndex {
+	p, err := fs.localPath(path.Join(dir, fs.options.ETagIndex))
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+
+	index := &etagIndex{modTime: fi.ModTime(), etags: make(map[string]string)}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		etag, name, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		// Names may be preceded by a "*" or " " mode indicator, as in the
+		// output of sha256sum
+		name = strings.TrimLeft(name, " *")
+		index.etags[name] = etag
+	}
+	return index
+}
+
+// applyETagIndex replaces the ETags of files with the ones listed in the
+// index file of their directory, if any. Entries older than the file are
+// ignored, so that modified files fall back to the default ETag.
+func (fs *limitedLocalFileSystem) applyETagIndex(l []FileInfo) {
+	if fs.options.ETagIndex == "" {
+		return
+	}
+
+	indexes := make(map[string]*etagIndex)
+	for i := range l {
+		fi := &l[i]
+		if fi.IsDir {
+			continue
+		}
+		dir, name := path.Split(fi.Path)
+		index, ok := indexes[dir]
+		if !ok {
+			index = fs.loadETagIndex(dir)
+			indexes[dir] = index
+		}
+		if index == nil || fi.ModTime.After(index.modTime) {
+			continue
+		}
+		if etag, ok := index.etags[name]; ok {
+			fi.ETag = etag
+		}
+	}
+}
+
+// isETagIndex reports whether a file is an ETag index, which is hidden from
+// directory listings.
+func (fs *limitedLocalFileSystem) isETagIndex(fi *FileInfo) bool {
+	return fs.options.ETagIndex != "" && !fi.IsDir && path.Base(fi.Path) == fs.options.ETagIndex
+}
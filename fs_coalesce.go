@@ -0,0 +1,136 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// CoalescingFileSystem is a FileSystem sharing the results of identical
+// concurrent ReadDir calls, e.g. when many clients list the same directory at
+// once. Only one call reaches the underlying FileSystem, the other callers
+// wait for its result. This reduces the load on slow storage backends.
+//
+// Calls are only shared between requests of the same principal, see
+// PrincipalFromContext. The shared call keeps running as long as one of the
+// callers is waiting for it: a cancelled request doesn't abort it for the
+// others. The optional interfaces of the FileSystem, such as QuotaProvider,
+// aren't exposed.
+type CoalescingFileSystem struct {
+	FileSystem FileSystem
+
+	mu    sync.Mutex
+	calls map[readDirKey]*readDirCall
+}
+
+var _ FileSystem = (*CoalescingFileSystem)(nil)
+
+type readDirKey struct {
+	principal, name string
+	recursive       bool
+}
+
+type readDirCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	l   []FileInfo
+	err error
+}
+
+// detachedContext carries the values of a context, but not its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (fs *CoalescingFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return fs.FileSystem.Open(ctx, name)
+}
+
+func (fs *CoalescingFileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	return fs.FileSystem.Stat(ctx, name)
+}
+
+func (fs *CoalescingFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	principal, _ := PrincipalFromContext(ctx)
+	k := readDirKey{principal: principal, name: name, recursive: recursive}
+
+	fs.mu.Lock()
+	call, ok := fs.calls[k]
+	if !ok {
+		// The shared call isn't tied to the first request
+		sharedCtx, cancel := context.WithCancel(detachedContext{ctx})
+		call = &readDirCall{done: make(chan struct{}), cancel: cancel}
+		if fs.calls == nil {
+			fs.calls = make(map[readDirKey]*readDirCall)
+		}
+		fs.calls[k] = call
+
+		go func() {
+			call.l, call.err = fs.FileSystem.ReadDir(sharedCtx, name, recursive)
+			cancel()
+
+			fs.mu.Lock()
+			if fs.calls[k] == call {
+				delete(fs.calls, k)
+			}
+			fs.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	fs.mu.Unlock()
+
+	select {
+	case <-call.done:
+		// Callers may modify the returned slice
+		return append([]FileInfo(nil), call.l...), call.err
+	case <-ctx.Done():
+		fs.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Nobody is interested in the result anymore
+			call.cancel()
+			if fs.calls[k] == call {
+				delete(fs.calls, k)
+			}
+		}
+		fs.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (fs *CoalescingFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	return fs.FileSystem.Create(ctx, name, body, opts)
+}
+
+func (fs *CoalescingFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	return fs.FileSystem.RemoveAll(ctx, name, opts)
+}
+
+func (fs *CoalescingFileSystem) Mkdir(ctx context.Context, name string) error {
+	return fs.FileSystem.Mkdir(ctx, name)
+}
+
+func (fs *CoalescingFileSystem) Copy(ctx context.Context, name, dest string, options *CopyOptions) (bool, error) {
+	return fs.FileSystem.Copy(ctx, name, dest, options)
+}
+
+func (fs *CoalescingFileSystem) Move(ctx context.Context, name, dest string, options *MoveOptions) (bool, error) {
+	return fs.FileSystem.Move(ctx, name, dest, options)
+}
@@ -0,0 +1,97 @@
+package webdav
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type slowFileSystem struct {
+	LocalFileSystem
+	release chan struct{}
+	calls   atomic.Int32
+	ctxErr  atomic.Value
+}
+
+func (fs *slowFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	fs.calls.Add(1)
+	<-fs.release
+	if err := ctx.Err(); err != nil {
+		fs.ctxErr.Store(err)
+	}
+	return fs.LocalFileSystem.ReadDir(ctx, name, recursive)
+}
+
+func waitForReadDirWaiters(t *testing.T, fs *CoalescingFileSystem, name string, n int) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		fs.mu.Lock()
+		call := fs.calls[readDirKey{name: name}]
+		ok := call != nil && call.waiters == n
+		fs.mu.Unlock()
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %v callers", n)
+}
+
+func TestCoalescingFileSystem(t *testing.T) {
+	slow := &slowFileSystem{
+		LocalFileSystem: newTestFileSystem(t, map[string]string{"archive/a": "a", "archive/b": "b"}),
+		release:         make(chan struct{}),
+	}
+	fs := &CoalescingFileSystem{FileSystem: slow}
+
+	// The first caller gives up, the others must still get the result
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	cancelErr := make(chan error, 1)
+	go func() {
+		_, err := fs.ReadDir(cancelCtx, "/archive", false)
+		cancelErr <- err
+	}()
+	waitForReadDirWaiters(t, fs, "/archive", 1)
+
+	const n = 4
+	var wg sync.WaitGroup
+	results := make([][]FileInfo, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = fs.ReadDir(context.Background(), "/archive", false)
+		}(i)
+	}
+	waitForReadDirWaiters(t, fs, "/archive", n+1)
+
+	cancel()
+	if err := <-cancelErr; err != context.Canceled {
+		t.Errorf("ReadDir() with cancelled context = %v, want %v", err, context.Canceled)
+	}
+	close(slow.release)
+	wg.Wait()
+
+	if got := slow.calls.Load(); got != 1 {
+		t.Errorf("underlying ReadDir called %v times, want 1", got)
+	}
+	if err := slow.ctxErr.Load(); err != nil {
+		t.Errorf("shared ReadDir context cancelled: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Errorf("ReadDir() = %v", errs[i])
+		} else if len(results[i]) != 3 {
+			t.Errorf("ReadDir() returned %v entries, want 3", len(results[i]))
+		}
+	}
+
+	// Calls made after the shared one completed aren't coalesced
+	if _, err := fs.ReadDir(context.Background(), "/archive", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := slow.calls.Load(); got != 2 {
+		t.Errorf("underlying ReadDir called %v times, want 2", got)
+	}
+}
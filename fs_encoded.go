@@ -0,0 +1,190 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// PathEncoding maps the paths of the WebDAV namespace to the names used by a
+// storage backend, and back. It's used by EncodedFileSystem.
+type PathEncoding interface {
+	// EncodePath returns the storage name of a WebDAV path.
+	EncodePath(name string) string
+	// DecodePath returns the WebDAV path of a storage name. It returns an
+	// error if the name couldn't have been produced by EncodePath.
+	DecodePath(name string) (string, error)
+}
+
+// EscapePathEncoding is a PathEncoding replacing characters which aren't
+// allowed by the storage backend with their percent-encoded form, e.g. "%3F"
+// for "?". Path segments are encoded separately, slashes are preserved. The
+// '%' character and ASCII control characters are always escaped.
+type EscapePathEncoding struct {
+	// Reserved lists the characters to escape.
+	Reserved string
+	// Trailing lists the characters to escape at the end of path segments.
+	Trailing string
+	// FoldCase escapes upper-case ASCII letters, so that names only differing
+	// by case don't collide on case-insensitive storage backends.
+	FoldCase bool
+}
+
+// WindowsPathEncoding escapes the characters which aren't allowed in FAT and
+// NTFS file names.
+var WindowsPathEncoding = &EscapePathEncoding{
+	Reserved: `<>:"\|?*`,
+	Trailing: ". ",
+}
+
+var _ PathEncoding = (*EscapePathEncoding)(nil)
+
+func (enc *EscapePathEncoding) shouldEscape(c byte, last bool) bool {
+	switch {
+	case c == '%', c < 0x20, c == 0x7F:
+		return true
+	case enc.FoldCase && c >= 'A' && c <= 'Z':
+		return true
+	case last && strings.IndexByte(enc.Trailing, c) >= 0:
+		return true
+	}
+	return strings.IndexByte(enc.Reserved, c) >= 0
+}
+
+func (enc *EscapePathEncoding) EncodePath(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		last := i == len(name)-1 || name[i+1] == '/'
+		if c != '/' && enc.shouldEscape(c, last) {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func (enc *EscapePathEncoding) DecodePath(name string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(name) || !isHexDigit(name[i+1]) || !isHexDigit(name[i+2]) {
+			return "", fmt.Errorf("webdav: malformed escape sequence in %q", name)
+		}
+		b, _ := strconv.ParseUint(name[i+1:i+3], 16, 8)
+		if b == '/' {
+			return "", fmt.Errorf("webdav: escaped slash in %q", name)
+		}
+		sb.WriteByte(byte(b))
+		i += 2
+	}
+	return sb.String(), nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// EncodedFileSystem is a FileSystem encoding paths with a PathEncoding before
+// passing them to another FileSystem, e.g. to store files with arbitrary
+// names on a FAT file system or in an S3 bucket.
+//
+// Paths returned by the FileSystem are decoded, so that responses refer to
+// the original WebDAV paths. Members whose name can't be decoded are omitted
+// from ReadDir. The optional interfaces of the FileSystem, such as
+// QuotaProvider, aren't exposed.
+type EncodedFileSystem struct {
+	FileSystem FileSystem
+	Encoding   PathEncoding
+}
+
+var _ FileSystem = (*EncodedFileSystem)(nil)
+
+func (fs *EncodedFileSystem) decodeFileInfo(fi *FileInfo) (*FileInfo, error) {
+	p, err := fs.Encoding.DecodePath(fi.Path)
+	if err != nil {
+		return nil, internal.HTTPErrorf(http.StatusInternalServerError, "%v", err)
+	}
+	out := *fi
+	out.Path = p
+	return &out, nil
+}
+
+func (fs *EncodedFileSystem) decodeProgress(progress ProgressFunc) ProgressFunc {
+	if progress == nil {
+		return nil
+	}
+	return func(name string, n int) {
+		if p, err := fs.Encoding.DecodePath(name); err == nil {
+			name = p
+		}
+		progress(name, n)
+	}
+}
+
+func (fs *EncodedFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return fs.FileSystem.Open(ctx, fs.Encoding.EncodePath(name))
+}
+
+func (fs *EncodedFileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	fi, err := fs.FileSystem.Stat(ctx, fs.Encoding.EncodePath(name))
+	if err != nil {
+		return nil, err
+	}
+	return fs.decodeFileInfo(fi)
+}
+
+func (fs *EncodedFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	l, err := fs.FileSystem.ReadDir(ctx, fs.Encoding.EncodePath(name), recursive)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]FileInfo, 0, len(l))
+	for i := range l {
+		fi, err := fs.decodeFileInfo(&l[i])
+		if err != nil {
+			continue
+		}
+		out = append(out, *fi)
+	}
+	return out, nil
+}
+
+func (fs *EncodedFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	fi, created, err := fs.FileSystem.Create(ctx, fs.Encoding.EncodePath(name), body, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	fi, err = fs.decodeFileInfo(fi)
+	return fi, created, err
+}
+
+func (fs *EncodedFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	return fs.FileSystem.RemoveAll(ctx, fs.Encoding.EncodePath(name), opts)
+}
+
+func (fs *EncodedFileSystem) Mkdir(ctx context.Context, name string) error {
+	return fs.FileSystem.Mkdir(ctx, fs.Encoding.EncodePath(name))
+}
+
+func (fs *EncodedFileSystem) Copy(ctx context.Context, name, dest string, options *CopyOptions) (bool, error) {
+	opts := *options
+	opts.Progress = fs.decodeProgress(options.Progress)
+	return fs.FileSystem.Copy(ctx, fs.Encoding.EncodePath(name), fs.Encoding.EncodePath(dest), &opts)
+}
+
+func (fs *EncodedFileSystem) Move(ctx context.Context, name, dest string, options *MoveOptions) (bool, error) {
+	opts := *options
+	opts.Progress = fs.decodeProgress(options.Progress)
+	return fs.FileSystem.Move(ctx, fs.Encoding.EncodePath(name), fs.Encoding.EncodePath(dest), &opts)
+}
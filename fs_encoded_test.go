@@ -0,0 +1,65 @@
+package webdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEscapePathEncoding(t *testing.T) {
+	enc := &EscapePathEncoding{Reserved: `:?`, Trailing: ".", FoldCase: true}
+	for _, tc := range []struct {
+		name, encoded string
+	}{
+		{"/notes/a:b?.txt", "/notes/a%3Ab%3F.txt"},
+		{"/Dir./README", "/%44ir%2E/%52%45%41%44%4D%45"},
+		{"/100%/", "/100%25/"},
+	} {
+		if got := enc.EncodePath(tc.name); got != tc.encoded {
+			t.Errorf("EncodePath(%q) = %q, want %q", tc.name, got, tc.encoded)
+		}
+		if got, err := enc.DecodePath(tc.encoded); err != nil || got != tc.name {
+			t.Errorf("DecodePath(%q) = %q, %v, want %q", tc.encoded, got, err, tc.name)
+		}
+	}
+
+	for _, name := range []string{"/a%", "/a%zz", "/a%2Fb"} {
+		if _, err := enc.DecodePath(name); err == nil {
+			t.Errorf("DecodePath(%q) succeeded", name)
+		}
+	}
+}
+
+func TestEncodedFileSystem(t *testing.T) {
+	local := newTestFileSystem(t, map[string]string{"invalid%name": "x"})
+	h := &Handler{FileSystem: &EncodedFileSystem{FileSystem: local, Encoding: WindowsPathEncoding}}
+
+	res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodPut, "/what%3F.txt", strings.NewReader("hello")))
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if _, err := os.Stat(filepath.Join(string(local), "what%3F.txt")); err != nil {
+		t.Errorf("file not stored under its encoded name: %v", err)
+	}
+
+	res, body := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/what%3F.txt", nil))
+	if res.StatusCode != http.StatusOK || body != "hello" {
+		t.Errorf("GET: got %v %q, want %v %q", res.StatusCode, body, http.StatusOK, "hello")
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.Header.Set("Depth", "1")
+	res, body = serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	if !strings.Contains(body, ">/what%3F.txt</") {
+		t.Errorf("PROPFIND: decoded href missing from response:\n%v", body)
+	}
+	if strings.Contains(body, "invalid") {
+		t.Errorf("PROPFIND: undecodable name listed in response:\n%v", body)
+	}
+}
@@ -17,6 +17,10 @@ import (
 )
 
 // LocalFileSystem implements FileSystem for a local directory.
+//
+// Collections have an ETag, changing whenever a file under them is modified
+// through the same Handler. Modifications made otherwise are only noticed
+// for direct members.
 type LocalFileSystem string
 
 var _ FileSystem = LocalFileSystem("")
@@ -37,7 +41,7 @@ func (fs LocalFileSystem) externalPath(name string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return "/" + filepath.ToSlash(rel), nil
+	return path.Clean("/" + filepath.ToSlash(rel)), nil
 }
 
 func (fs LocalFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
@@ -79,7 +83,7 @@ func errFromOS(err error) error {
 	} else if errors.Is(err, os.ErrDeadlineExceeded) {
 		return NewHTTPError(http.StatusServiceUnavailable, err)
 	} else {
-		return err
+		return errInsufficientStorage(err)
 	}
 }
 
@@ -92,16 +96,36 @@ func (fs LocalFileSystem) Stat(ctx context.Context, name string) (*FileInfo, err
 	if err != nil {
 		return nil, errFromOS(err)
 	}
-	return fileInfoFromOS(name, fi), nil
+	return fs.fileInfo(ctx, name, fi), nil
+}
+
+// fileInfo converts an os.FileInfo. Directories get an ETag changing when
+// one of their descendants is modified through the Handler serving the
+// request.
+func (fs LocalFileSystem) fileInfo(ctx context.Context, name string, osFi os.FileInfo) *FileInfo {
+	fi := fileInfoFromOS(name, osFi)
+	if fi.IsDir {
+		fi.ETag = treeVersionsFromContext(ctx).etag(fs, name, fi)
+	}
+	return fi
 }
 
 func (fs LocalFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	return fs.readDir(ctx, name, recursive, nil)
+}
+
+func (fs LocalFileSystem) readDir(ctx context.Context, name string, recursive bool, options *LocalFileSystemOptions) ([]FileInfo, error) {
+	if options == nil {
+		options = new(LocalFileSystemOptions)
+	}
+
 	path, err := fs.localPath(name)
 	if err != nil {
 		return nil, err
 	}
 
 	var l []FileInfo
+	var limitErr error
 	err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
 		if err != nil && !errors.Is(err, os.ErrPermission) {
 			return err
@@ -109,20 +133,202 @@ func (fs LocalFileSystem) ReadDir(ctx context.Context, name string, recursive bo
 		if fi == nil {
 			return nil
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if options.MaxReadDirEntries > 0 && len(l) >= options.MaxReadDirEntries {
+			limitErr = internal.HTTPErrorf(http.StatusInsufficientStorage, "webdav: too many entries in %q", name)
+			return filepath.SkipAll
+		}
 
 		href, err := fs.externalPath(p)
 		if err != nil {
 			return err
 		}
 
-		l = append(l, *fileInfoFromOS(href, fi))
+		l = append(l, *fs.fileInfo(ctx, href, fi))
 
 		if !recursive && fi.IsDir() && path != p {
 			return filepath.SkipDir
 		}
+		if options.MaxReadDirDepth > 0 && fi.IsDir() && path != p {
+			rel, _ := filepath.Rel(path, p)
+			if depth := strings.Count(rel, string(filepath.Separator)) + 1; depth >= options.MaxReadDirDepth {
+				limitErr = internal.HTTPErrorf(http.StatusInsufficientStorage, "webdav: %q is nested too deeply", name)
+				return filepath.SkipDir
+			}
+		}
 		return nil
 	})
-	return l, errFromOS(err)
+	if err != nil {
+		return l, errFromOS(err)
+	}
+	return l, limitErr
+}
+
+// LocalFileSystemOptions contains options for NewLocalFileSystem.
+type LocalFileSystemOptions struct {
+	// MaxReadDirDepth limits how deep a recursive ReadDir descends into
+	// sub-directories. Zero means no limit.
+	MaxReadDirDepth int
+	// MaxReadDirEntries limits the number of entries returned by ReadDir.
+	// Zero means no limit.
+	MaxReadDirEntries int
+	// Normalize, if set, normalizes Unicode file names to a chosen form, e.g.
+	// with norm.NFC.String from golang.org/x/text/unicode/norm. Requested
+	// names are matched against stored names after normalizing both, new
+	// files are created with normalized names, and returned paths are
+	// normalized. This avoids mismatches between macOS, which uses NFD, and
+	// most other clients, which use NFC.
+	Normalize func(name string) string
+	// ETagIndex, if set, is the name of an index file listing precomputed
+	// ETags for the files of its directory, e.g. content hashes. Each line
+	// contains an ETag followed by a space and a file name, as in the output
+	// of sha256sum. ETags listed in an index older than the file they
+	// describe are ignored, and files which aren't listed fall back to the
+	// default ETag, derived from the size and the modification time. Index
+	// files are hidden from ReadDir.
+	ETagIndex string
+}
+
+// NewLocalFileSystem creates a FileSystem for a local directory, with limits
+// protecting the server against pathological recursive listings, and
+// optional Unicode normalization of file names.
+//
+// When a limit is reached, ReadDir returns the entries listed so far along
+// with an error carrying a 507 Insufficient Storage status code. Symbolic
+// links to directories are never followed, so cycles can't occur.
+func NewLocalFileSystem(dir string, options *LocalFileSystemOptions) FileSystem {
+	if options == nil {
+		options = new(LocalFileSystemOptions)
+	}
+	return &limitedLocalFileSystem{LocalFileSystem(dir), *options}
+}
+
+type limitedLocalFileSystem struct {
+	LocalFileSystem
+	options LocalFileSystemOptions
+}
+
+func (fs *limitedLocalFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	l, err := fs.readDir(ctx, fs.resolve(name), recursive, &fs.options)
+	fs.applyETagIndex(l)
+	out := l[:0]
+	for i := range l {
+		if fs.isETagIndex(&l[i]) {
+			continue
+		}
+		fs.normalizeFileInfo(&l[i])
+		out = append(out, l[i])
+	}
+	return out, err
+}
+
+// resolve returns the stored name of a file, matching the normalized form of
+// each path segment if Normalize is set. Segments which don't exist are
+// normalized.
+func (fs *limitedLocalFileSystem) resolve(name string) string {
+	normalize := fs.options.Normalize
+	if normalize == nil {
+		return name
+	}
+	if p, err := fs.localPath(name); err != nil {
+		return name
+	} else if _, err := os.Lstat(p); err == nil {
+		return name
+	}
+
+	cur := "/"
+	missing := false
+	for _, seg := range strings.Split(strings.Trim(path.Clean(name), "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		want := normalize(seg)
+		next := path.Join(cur, want)
+		if !missing {
+			missing = true
+			p, _ := fs.localPath(cur)
+			entries, _ := os.ReadDir(p)
+			for _, entry := range entries {
+				if normalize(entry.Name()) == want {
+					next = path.Join(cur, entry.Name())
+					missing = false
+					break
+				}
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+func (fs *limitedLocalFileSystem) normalizeFileInfo(fi *FileInfo) {
+	if fs.options.Normalize != nil {
+		fi.Path = fs.options.Normalize(fi.Path)
+	}
+}
+
+func (fs *limitedLocalFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return fs.LocalFileSystem.Open(ctx, fs.resolve(name))
+}
+
+func (fs *limitedLocalFileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	fi, err := fs.LocalFileSystem.Stat(ctx, fs.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	l := []FileInfo{*fi}
+	fs.applyETagIndex(l)
+	fi = &l[0]
+	fs.normalizeFileInfo(fi)
+	return fi, nil
+}
+
+func (fs *limitedLocalFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	if fs.options.ETagIndex != "" && (opts.IfMatch.IsSet() || opts.IfNoneMatch.IsSet()) {
+		// Conditions are checked against the ETags of the index
+		fi, _ := fs.Stat(ctx, name)
+		if err := checkConditionalMatches(fi, opts.IfMatch, opts.IfNoneMatch); err != nil {
+			body.Close()
+			return nil, false, err
+		}
+		opts = &CreateOptions{}
+	}
+
+	fi, created, err := fs.LocalFileSystem.Create(ctx, fs.resolve(name), body, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	fs.normalizeFileInfo(fi)
+	return fi, created, nil
+}
+
+func (fs *limitedLocalFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	if fs.options.ETagIndex != "" && (opts.IfMatch.IsSet() || opts.IfNoneMatch.IsSet()) {
+		fi, err := fs.Stat(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := checkConditionalMatches(fi, opts.IfMatch, opts.IfNoneMatch); err != nil {
+			return err
+		}
+		opts = &RemoveAllOptions{}
+	}
+	return fs.LocalFileSystem.RemoveAll(ctx, fs.resolve(name), opts)
+}
+
+func (fs *limitedLocalFileSystem) Mkdir(ctx context.Context, name string) error {
+	return fs.LocalFileSystem.Mkdir(ctx, fs.resolve(name))
+}
+
+func (fs *limitedLocalFileSystem) Copy(ctx context.Context, src, dst string, options *CopyOptions) (bool, error) {
+	return fs.LocalFileSystem.Copy(ctx, fs.resolve(src), fs.resolve(dst), options)
+}
+
+func (fs *limitedLocalFileSystem) Move(ctx context.Context, src, dst string, options *MoveOptions) (bool, error) {
+	return fs.LocalFileSystem.Move(ctx, fs.resolve(src), fs.resolve(dst), options)
 }
 
 func checkConditionalMatches(fi *FileInfo, ifMatch, ifNoneMatch ConditionalMatch) error {
@@ -140,7 +346,7 @@ func checkConditionalMatches(fi *FileInfo, ifMatch, ifNoneMatch ConditionalMatch
 	}
 
 	if ifNoneMatch.IsSet() {
-		if ok, err := ifNoneMatch.MatchETag(etag); err != nil {
+		if ok, err := ifNoneMatch.MatchETagWeak(etag); err != nil {
 			return NewHTTPError(http.StatusBadRequest, err)
 		} else if ok {
 			return NewHTTPError(http.StatusPreconditionFailed, fmt.Errorf("If-None-Match condition failed"))
@@ -162,20 +368,36 @@ func (fs LocalFileSystem) Create(ctx context.Context, name string, body io.ReadC
 		return nil, false, err
 	}
 
-	wc, err := os.Create(p)
+	defer treeVersionsFromContext(ctx).bump(fs, name)
+
+	// Write to a temporary file first, so that the previous contents are
+	// left untouched if the upload fails
+	wc, err := os.CreateTemp(filepath.Dir(p), ".webdav-*")
 	if err != nil {
 		return nil, false, errFromOS(err)
 	}
 	defer wc.Close()
 
 	if _, err := io.Copy(wc, body); err != nil {
-		os.Remove(p)
+		os.Remove(wc.Name())
 		return nil, false, err
 	}
 	if err := wc.Close(); err != nil {
-		os.Remove(p)
+		os.Remove(wc.Name())
 		return nil, false, err
 	}
+	perm := os.FileMode(0644)
+	if osFi, err := os.Stat(p); err == nil {
+		perm = osFi.Mode() & os.ModePerm
+	}
+	if err := os.Chmod(wc.Name(), perm); err != nil {
+		os.Remove(wc.Name())
+		return nil, false, errFromOS(err)
+	}
+	if err := os.Rename(wc.Name(), p); err != nil {
+		os.Remove(wc.Name())
+		return nil, false, errFromOS(err)
+	}
 
 	fi, err = fs.Stat(ctx, name)
 	if err != nil {
@@ -202,7 +424,13 @@ func (fs LocalFileSystem) RemoveAll(ctx context.Context, name string, opts *Remo
 		return err
 	}
 
-	return errFromOS(os.RemoveAll(p))
+	tv := treeVersionsFromContext(ctx)
+	defer tv.bump(fs, name)
+	if err := os.RemoveAll(p); err != nil {
+		return errFromOS(err)
+	}
+	tv.drop(fs, name)
+	return nil
 }
 
 func (fs LocalFileSystem) Mkdir(ctx context.Context, name string) error {
@@ -210,6 +438,7 @@ func (fs LocalFileSystem) Mkdir(ctx context.Context, name string) error {
 	if err != nil {
 		return err
 	}
+	defer treeVersionsFromContext(ctx).bump(fs, name)
 	if err := os.Mkdir(p, 0755); os.IsExist(err) {
 		return NewHTTPError(http.StatusMethodNotAllowed, err)
 	} else {
@@ -249,14 +478,14 @@ func (fs LocalFileSystem) Copy(ctx context.Context, src, dst string, options *Co
 		return false, err
 	}
 
+	defer treeVersionsFromContext(ctx).bump(fs, dst)
+
 	// TODO: "Note that an infinite-depth COPY of /A/ into /A/B/ could lead to
 	// infinite recursion if not handled correctly"
 
-	srcInfo, err := os.Stat(srcPath)
-	if err != nil {
+	if _, err := os.Stat(srcPath); err != nil {
 		return false, errFromOS(err)
 	}
-	srcPerm := srcInfo.Mode() & os.ModePerm
 
 	if _, err := os.Stat(dstPath); err != nil {
 		if !os.IsNotExist(err) {
@@ -272,27 +501,49 @@ func (fs LocalFileSystem) Copy(ctx context.Context, src, dst string, options *Co
 		}
 	}
 
+	var completed []string
 	err = filepath.Walk(srcPath, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcPath, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstPath, rel)
+		perm := fi.Mode() & os.ModePerm
 
 		if fi.IsDir() {
-			if err := os.Mkdir(dstPath, srcPerm); err != nil {
+			if err := os.Mkdir(target, perm); err != nil {
 				return errFromOS(err)
 			}
 		} else {
-			if err := copyRegularFile(srcPath, dstPath, srcPerm); err != nil {
+			if err := copyRegularFile(p, target, perm); err != nil {
 				return err
 			}
 		}
 
+		href, err := fs.externalPath(target)
+		if err != nil {
+			return err
+		}
+		completed = append(completed, href)
+		if options.Progress != nil {
+			options.Progress(href, len(completed))
+		}
+
 		if fi.IsDir() && options.NoRecursive {
 			return filepath.SkipDir
 		}
 		return nil
 	})
-	if err != nil {
+	if len(completed) > 0 && ctx.Err() != nil {
+		return false, &PartialError{Completed: completed, Err: ctx.Err()}
+	} else if err != nil {
 		return false, errFromOS(err)
 	}
 
@@ -309,6 +560,14 @@ func (fs LocalFileSystem) Move(ctx context.Context, src, dst string, options *Mo
 		return false, err
 	}
 
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	tv := treeVersionsFromContext(ctx)
+	defer tv.bump(fs, src)
+	defer tv.bump(fs, dst)
+
 	if _, err := os.Stat(dstPath); err != nil {
 		if !os.IsNotExist(err) {
 			return false, errFromOS(err)
@@ -321,11 +580,16 @@ func (fs LocalFileSystem) Move(ctx context.Context, src, dst string, options *Mo
 		if err := os.RemoveAll(dstPath); err != nil {
 			return false, errFromOS(err)
 		}
+		tv.drop(fs, dst)
 	}
 
 	if err := os.Rename(srcPath, dstPath); err != nil {
 		return false, errFromOS(err)
 	}
+	tv.rename(fs, src, dst)
+	if options.Progress != nil {
+		options.Progress(dst, 1)
+	}
 
 	return created, nil
 }
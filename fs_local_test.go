@@ -0,0 +1,272 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+func TestLocalFileSystemCopyRecursive(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"src/a":     "a",
+		"src/sub/b": "b",
+	})
+
+	var progress []string
+	opts := CopyOptions{
+		Progress: func(name string, n int) {
+			progress = append(progress, name)
+			if n != len(progress) {
+				t.Errorf("progress: got n = %v, want %v", n, len(progress))
+			}
+		},
+	}
+	created, err := fs.Copy(context.Background(), "/src", "/dst", &opts)
+	if err != nil {
+		t.Fatalf("Copy() = %v", err)
+	} else if !created {
+		t.Errorf("Copy() didn't report the destination as created")
+	}
+
+	for name, want := range map[string]string{"dst/a": "a", "dst/sub/b": "b"} {
+		data, err := os.ReadFile(filepath.Join(string(fs), name))
+		if err != nil {
+			t.Errorf("failed to read %v: %v", name, err)
+		} else if string(data) != want {
+			t.Errorf("%v: got %q, want %q", name, data, want)
+		}
+	}
+	if len(progress) != 4 {
+		t.Errorf("progress: got %v, want 4 members", progress)
+	}
+}
+
+func TestLocalFileSystemCopyCancel(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"src/a": "a",
+		"src/b": "b",
+		"src/c": "c",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := CopyOptions{
+		Progress: func(name string, n int) {
+			if n == 2 {
+				cancel()
+			}
+		},
+	}
+	_, err := fs.Copy(ctx, "/src", "/dst", &opts)
+
+	var partialErr *PartialError
+	if !errors.As(err, &partialErr) {
+		t.Fatalf("Copy() = %v, want a PartialError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Copy() = %v, want context.Canceled", err)
+	}
+	want := []string{"/dst", "/dst/a"}
+	if len(partialErr.Completed) != len(want) || partialErr.Completed[0] != want[0] || partialErr.Completed[1] != want[1] {
+		t.Errorf("Completed = %v, want %v", partialErr.Completed, want)
+	}
+}
+
+func TestLocalFileSystemReadDirLimits(t *testing.T) {
+	dir := string(newTestFileSystem(t, map[string]string{
+		"a/b/c/d": "",
+		"e":       "",
+	}))
+	if err := os.Symlink(dir, filepath.Join(dir, "a", "loop")); err != nil {
+		t.Skipf("failed to create symlink: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		options LocalFileSystemOptions
+		want    int
+		limited bool
+	}{
+		{"unlimited", LocalFileSystemOptions{}, 7, false},
+		{"depth", LocalFileSystemOptions{MaxReadDirDepth: 2}, 5, true},
+		{"entries", LocalFileSystemOptions{MaxReadDirEntries: 3}, 3, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := NewLocalFileSystem(dir, &tc.options)
+			l, err := fs.ReadDir(context.Background(), "/", true)
+			if tc.limited {
+				var httpErr *internal.HTTPError
+				if !errors.As(err, &httpErr) || httpErr.Code != http.StatusInsufficientStorage {
+					t.Errorf("ReadDir() = %v, want a 507 error", err)
+				}
+			} else if err != nil {
+				t.Errorf("ReadDir() = %v", err)
+			}
+			if len(l) != tc.want {
+				t.Errorf("ReadDir() returned %v entries, want %v", len(l), tc.want)
+			}
+		})
+	}
+}
+
+// normalizeNFC composes the decomposed form of "é", standing in for
+// norm.NFC.String.
+func normalizeNFC(name string) string {
+	return strings.ReplaceAll(name, "e\u0301", "\u00e9")
+}
+
+func TestLocalFileSystemNormalize(t *testing.T) {
+	const nfc, nfd = "caf\u00e9", "cafe\u0301"
+	dir := string(newTestFileSystem(t, map[string]string{nfd + "/menu.txt": "menu"}))
+	fs := NewLocalFileSystem(dir, &LocalFileSystemOptions{Normalize: normalizeNFC})
+	ctx := context.Background()
+
+	for _, name := range []string{"/" + nfc + "/menu.txt", "/" + nfd + "/menu.txt"} {
+		fi, err := fs.Stat(ctx, name)
+		if err != nil {
+			t.Fatalf("Stat(%q) = %v", name, err)
+		}
+		if want := "/" + nfc + "/menu.txt"; fi.Path != want {
+			t.Errorf("Stat(%q).Path = %q, want %q", name, fi.Path, want)
+		}
+	}
+
+	if _, _, err := fs.Create(ctx, "/"+nfc+"/"+nfd+".txt", io.NopCloser(strings.NewReader("")), &CreateOptions{}); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nfd, nfc+".txt")); err != nil {
+		t.Errorf("new file not created in the existing directory with a normalized name: %v", err)
+	}
+
+	l, err := fs.ReadDir(ctx, "/"+nfc, false)
+	if err != nil {
+		t.Fatalf("ReadDir() = %v", err)
+	}
+	for _, fi := range l {
+		if !strings.HasPrefix(fi.Path, "/"+nfc) {
+			t.Errorf("ReadDir() returned non-normalized path %q", fi.Path)
+		}
+	}
+}
+
+func TestLocalFileSystemETagIndex(t *testing.T) {
+	dir := string(newTestFileSystem(t, map[string]string{
+		"photos/a.jpg": "a",
+		"photos/b.jpg": "b",
+	}))
+	index := filepath.Join(dir, "photos", ".etags")
+	if err := os.WriteFile(index, []byte("# sha256sum\nhash-a  a.jpg\nhash-c *c.jpg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewLocalFileSystem(dir, &LocalFileSystemOptions{ETagIndex: ".etags"})
+	ctx := context.Background()
+
+	fi, err := fs.Stat(ctx, "/photos/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	} else if fi.ETag != "hash-a" {
+		t.Errorf("Stat().ETag = %q, want %q", fi.ETag, "hash-a")
+	}
+
+	l, err := fs.ReadDir(ctx, "/photos", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etags := make(map[string]string)
+	for _, fi := range l {
+		etags[fi.Path] = fi.ETag
+	}
+	if _, ok := etags["/photos/.etags"]; ok {
+		t.Errorf("ReadDir() listed the index file")
+	}
+	if etags["/photos/a.jpg"] != "hash-a" || etags["/photos/b.jpg"] == "" || etags["/photos/b.jpg"] == "hash-a" {
+		t.Errorf("ReadDir() returned ETags %v", etags)
+	}
+
+	// Modified files fall back to the default ETag
+	if _, _, err := fs.Create(ctx, "/photos/a.jpg", io.NopCloser(strings.NewReader("new")), &CreateOptions{IfMatch: `"hash-a"`}); err != nil {
+		t.Fatalf("Create() with the indexed ETag = %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(index, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat(ctx, "/photos/a.jpg"); err != nil {
+		t.Fatal(err)
+	} else if fi.ETag == "hash-a" {
+		t.Errorf("Stat() returned a stale ETag from the index")
+	}
+}
+
+func TestLocalFileSystemCollectionETag(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"a/b/file": "data",
+		"x/file":   "data",
+	})
+	tv := new(treeVersions)
+	ctx := contextWithTreeVersions(context.Background(), tv)
+
+	etags := func() map[string]string {
+		m := make(map[string]string)
+		for _, name := range []string{"/", "/a", "/a/b", "/x"} {
+			fi, err := fs.Stat(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			} else if fi.ETag == "" {
+				t.Fatalf("Stat(%q): missing ETag", name)
+			}
+			m[name] = fi.ETag
+		}
+		return m
+	}
+
+	before := etags()
+	if _, _, err := fs.Create(ctx, "/a/b/file", io.NopCloser(strings.NewReader("new")), &CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	after := etags()
+	for _, name := range []string{"/", "/a", "/a/b"} {
+		if before[name] == after[name] {
+			t.Errorf("ETag of %q unchanged after modifying a descendant", name)
+		}
+	}
+	if before["/x"] != after["/x"] {
+		t.Errorf("ETag of %q changed after modifying another collection", "/x")
+	}
+
+	l, err := fs.ReadDir(ctx, "/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range l {
+		if want, ok := after[fi.Path]; ok && fi.ETag != want {
+			t.Errorf("ReadDir(): got ETag %q for %q, want %q", fi.ETag, fi.Path, want)
+		}
+	}
+
+	// Only collections have counters, and they follow moved collections
+	if _, err := fs.Move(ctx, "/a", "/moved", &MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll(ctx, "/x", &RemoveAllOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for k := range tv.versions {
+		names = append(names, k.name)
+	}
+	sort.Strings(names)
+	if want := []string{"/", "/moved", "/moved/b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got counters for %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,340 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// MultiFileSystem is a FileSystem made of other FileSystems mounted at
+// different paths.
+//
+// Paths are passed to the mounted FileSystems with their mount point
+// stripped, and the paths they return are prefixed with it. Ancestors of
+// mount points which aren't part of any FileSystem are exposed as read-only
+// empty directories. COPY and MOVE requests across mount points are
+// performed by copying files one by one, then deleting the source for MOVE.
+type MultiFileSystem struct {
+	// Mounts maps mount points, e.g. "/photos", to FileSystems. A FileSystem
+	// can be mounted at "/", in which case it serves all paths which don't
+	// belong to another mount point.
+	Mounts map[string]FileSystem
+}
+
+var _ FileSystem = (*MultiFileSystem)(nil)
+
+// resolve finds the FileSystem responsible for name, and returns the path of
+// name inside of it.
+func (fs *MultiFileSystem) resolve(name string) (mount string, sub FileSystem, subName string, ok bool) {
+	name = path.Clean("/" + name)
+	for m, fsys := range fs.Mounts {
+		m = path.Clean("/" + m)
+		if m != "/" && name != m && !strings.HasPrefix(name, m+"/") {
+			continue
+		}
+		if ok && len(m) <= len(mount) {
+			continue
+		}
+		mount, sub, ok = m, fsys, true
+	}
+	if !ok {
+		return "", nil, "", false
+	}
+	if mount == "/" {
+		return mount, sub, name, true
+	}
+	subName = strings.TrimPrefix(name, mount)
+	if subName == "" {
+		subName = "/"
+	}
+	return mount, sub, subName, true
+}
+
+// mountsUnder returns the mount points strictly under name.
+func (fs *MultiFileSystem) mountsUnder(name string) []string {
+	name = path.Clean("/" + name)
+	var l []string
+	for m := range fs.Mounts {
+		m = path.Clean("/" + m)
+		if m != name && (name == "/" || strings.HasPrefix(m, name+"/")) {
+			l = append(l, m)
+		}
+	}
+	sort.Strings(l)
+	return l
+}
+
+func mountPath(mount, subName string) string {
+	if mount == "/" {
+		return subName
+	}
+	if subName == "/" {
+		return mount + "/"
+	}
+	return mount + subName
+}
+
+func syntheticDirInfo(name string) *FileInfo {
+	name = path.Clean("/" + name)
+	if name != "/" {
+		name += "/"
+	}
+	return &FileInfo{Path: name, IsDir: true}
+}
+
+func (fs *MultiFileSystem) errNotMounted(name string) error {
+	if len(fs.mountsUnder(name)) > 0 {
+		return internal.HTTPErrorf(http.StatusForbidden, "webdav: %q is read-only", name)
+	}
+	return NewHTTPError(http.StatusNotFound, os.ErrNotExist)
+}
+
+func (fs *MultiFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	_, sub, subName, ok := fs.resolve(name)
+	if !ok {
+		return nil, NewHTTPError(http.StatusNotFound, os.ErrNotExist)
+	}
+	return sub.Open(ctx, subName)
+}
+
+func (fs *MultiFileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	mount, sub, subName, ok := fs.resolve(name)
+	if ok {
+		fi, err := sub.Stat(ctx, subName)
+		if err == nil {
+			fi.Path = mountPath(mount, fi.Path)
+			return fi, nil
+		} else if !internal.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	if len(fs.mountsUnder(name)) > 0 {
+		return syntheticDirInfo(name), nil
+	}
+	return nil, NewHTTPError(http.StatusNotFound, os.ErrNotExist)
+}
+
+func (fs *MultiFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	var l []FileInfo
+	seen := make(map[string]bool)
+	add := func(fi FileInfo) {
+		p := path.Clean(fi.Path)
+		if !seen[p] {
+			seen[p] = true
+			l = append(l, fi)
+		}
+	}
+
+	mount, sub, subName, ok := fs.resolve(name)
+	if ok {
+		children, err := sub.ReadDir(ctx, subName, recursive)
+		if err != nil && !internal.IsNotFound(err) {
+			return nil, err
+		}
+		for _, child := range children {
+			child.Path = mountPath(mount, child.Path)
+			add(child)
+		}
+	}
+
+	mounts := fs.mountsUnder(name)
+	if len(l) == 0 {
+		if len(mounts) == 0 {
+			return nil, NewHTTPError(http.StatusNotFound, os.ErrNotExist)
+		}
+		add(*syntheticDirInfo(name))
+	}
+
+	base := path.Clean("/" + name)
+	for _, m := range mounts {
+		rel := strings.TrimPrefix(strings.TrimPrefix(m, base), "/")
+		if !recursive {
+			first, _, _ := strings.Cut(rel, "/")
+			if child, err := fs.Stat(ctx, path.Join(base, first)); err == nil {
+				add(*child)
+			} else if !internal.IsNotFound(err) {
+				return nil, err
+			}
+			continue
+		}
+
+		segments := strings.Split(rel, "/")
+		for i := range segments[:len(segments)-1] {
+			add(*syntheticDirInfo(path.Join(base, strings.Join(segments[:i+1], "/"))))
+		}
+		children, err := fs.ReadDir(ctx, m, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			add(child)
+		}
+	}
+
+	return l, nil
+}
+
+func (fs *MultiFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	mount, sub, subName, ok := fs.resolve(name)
+	if !ok {
+		return nil, false, fs.errNotMounted(name)
+	}
+	fi, created, err := sub.Create(ctx, subName, body, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	fi.Path = mountPath(mount, fi.Path)
+	return fi, created, nil
+}
+
+func (fs *MultiFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	_, sub, subName, ok := fs.resolve(name)
+	if !ok || len(fs.mountsUnder(name)) > 0 {
+		return internal.HTTPErrorf(http.StatusForbidden, "webdav: cannot remove mount point %q", name)
+	}
+	return sub.RemoveAll(ctx, subName, opts)
+}
+
+func (fs *MultiFileSystem) Mkdir(ctx context.Context, name string) error {
+	_, sub, subName, ok := fs.resolve(name)
+	if !ok {
+		if len(fs.mountsUnder(name)) > 0 {
+			return internal.HTTPErrorf(http.StatusMethodNotAllowed, "webdav: %q already exists", name)
+		}
+		return internal.HTTPErrorf(http.StatusConflict, "webdav: %q isn't part of any mount point", name)
+	}
+	return sub.Mkdir(ctx, subName)
+}
+
+// mountProgress converts the member paths reported by a mounted FileSystem
+// to external paths.
+func mountProgress(mount string, progress ProgressFunc) ProgressFunc {
+	if progress == nil {
+		return nil
+	}
+	return func(name string, n int) {
+		progress(mountPath(mount, name), n)
+	}
+}
+
+func (fs *MultiFileSystem) Copy(ctx context.Context, name, dest string, options *CopyOptions) (bool, error) {
+	srcMount, srcFS, srcName, ok := fs.resolve(name)
+	if !ok {
+		return false, fs.errNotMounted(name)
+	}
+	dstMount, dstFS, dstName, ok := fs.resolve(dest)
+	if !ok {
+		return false, fs.errNotMounted(dest)
+	}
+
+	if srcMount == dstMount {
+		opts := *options
+		opts.Progress = mountProgress(dstMount, options.Progress)
+		return srcFS.Copy(ctx, srcName, dstName, &opts)
+	}
+
+	return copyAcross(ctx, srcFS, srcName, dstFS, dstName, dstMount, !options.NoRecursive, options.NoOverwrite, options.Progress)
+}
+
+func (fs *MultiFileSystem) Move(ctx context.Context, name, dest string, options *MoveOptions) (bool, error) {
+	srcMount, srcFS, srcName, ok := fs.resolve(name)
+	if !ok || len(fs.mountsUnder(name)) > 0 {
+		return false, internal.HTTPErrorf(http.StatusForbidden, "webdav: cannot move mount point %q", name)
+	}
+	dstMount, dstFS, dstName, ok := fs.resolve(dest)
+	if !ok {
+		return false, fs.errNotMounted(dest)
+	}
+
+	if srcMount == dstMount {
+		opts := *options
+		opts.Progress = mountProgress(dstMount, options.Progress)
+		return srcFS.Move(ctx, srcName, dstName, &opts)
+	}
+
+	created, err := copyAcross(ctx, srcFS, srcName, dstFS, dstName, dstMount, true, options.NoOverwrite, options.Progress)
+	if err != nil {
+		return false, err
+	}
+	return created, srcFS.RemoveAll(ctx, srcName, &RemoveAllOptions{})
+}
+
+// copyAcross copies a file or directory from a FileSystem to another one.
+func copyAcross(ctx context.Context, srcFS FileSystem, name string, dstFS FileSystem, dest, dstMount string, recursive, noOverwrite bool, progress ProgressFunc) (created bool, err error) {
+	srcInfo, err := srcFS.Stat(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := dstFS.Stat(ctx, dest); err == nil {
+		if noOverwrite {
+			return false, NewHTTPError(http.StatusPreconditionFailed, os.ErrExist)
+		}
+		if err := dstFS.RemoveAll(ctx, dest, &RemoveAllOptions{}); err != nil {
+			return false, err
+		}
+	} else if internal.IsNotFound(err) {
+		created = true
+	} else {
+		return false, err
+	}
+
+	members := []FileInfo{*srcInfo}
+	if srcInfo.IsDir && recursive {
+		if members, err = srcFS.ReadDir(ctx, name, true); err != nil {
+			return false, err
+		}
+		// Make sure parents are created before their children
+		sort.Slice(members, func(i, j int) bool {
+			return strings.Count(path.Clean(members[i].Path), "/") < strings.Count(path.Clean(members[j].Path), "/")
+		})
+	}
+
+	base := path.Clean(srcInfo.Path)
+	var completed []string
+	for _, member := range members {
+		if err := ctx.Err(); err != nil {
+			if len(completed) > 0 {
+				return false, &PartialError{Completed: completed, Err: err}
+			}
+			return false, err
+		}
+
+		rel := strings.TrimPrefix(path.Clean(member.Path), base)
+		target := path.Join(dest, rel)
+		if member.IsDir {
+			err = dstFS.Mkdir(ctx, target)
+		} else {
+			err = copyFileAcross(ctx, srcFS, member.Path, dstFS, target)
+		}
+		if err != nil {
+			if len(completed) > 0 {
+				return false, &PartialError{Completed: completed, Err: err}
+			}
+			return false, err
+		}
+
+		completed = append(completed, mountPath(dstMount, target))
+		if progress != nil {
+			progress(mountPath(dstMount, target), len(completed))
+		}
+	}
+
+	return created, nil
+}
+
+func copyFileAcross(ctx context.Context, srcFS FileSystem, name string, dstFS FileSystem, dest string) error {
+	f, err := srcFS.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, err = dstFS.Create(ctx, dest, f, &CreateOptions{})
+	return err
+}
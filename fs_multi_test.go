@@ -0,0 +1,83 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMultiFileSystem(t *testing.T) {
+	photos := newTestFileSystem(t, map[string]string{
+		"a.jpg":     "a",
+		"dir/b.jpg": "b",
+	})
+	archive := newTestFileSystem(t, map[string]string{
+		"c.tar": "c",
+	})
+	fs := &MultiFileSystem{Mounts: map[string]FileSystem{
+		"/photos":      photos,
+		"/archive/old": archive,
+	}}
+	ctx := context.Background()
+
+	readDir := func(name string, recursive bool) string {
+		l, err := fs.ReadDir(ctx, name, recursive)
+		if err != nil {
+			t.Fatalf("ReadDir(%q) = %v", name, err)
+		}
+		var paths []string
+		for _, fi := range l {
+			paths = append(paths, fi.Path)
+		}
+		sort.Strings(paths)
+		return strings.Join(paths, " ")
+	}
+
+	if got, want := readDir("/", false), "/ /archive/ /photos/"; got != want {
+		t.Errorf("ReadDir(/) = %v, want %v", got, want)
+	}
+	if got, want := readDir("/", true), "/ /archive/ /archive/old/ /archive/old/c.tar /photos/ /photos/a.jpg /photos/dir /photos/dir/b.jpg"; got != want {
+		t.Errorf("ReadDir(/, recursive) = %v, want %v", got, want)
+	}
+
+	if fi, err := fs.Stat(ctx, "/photos/dir/b.jpg"); err != nil || fi.Path != "/photos/dir/b.jpg" {
+		t.Errorf("Stat() = %+v, %v", fi, err)
+	}
+	if fi, err := fs.Stat(ctx, "/archive"); err != nil || !fi.IsDir {
+		t.Errorf("Stat(/archive) = %+v, %v", fi, err)
+	}
+	if _, err := fs.Stat(ctx, "/missing"); err == nil {
+		t.Errorf("Stat(/missing) succeeded")
+	}
+	if _, _, err := fs.Create(ctx, "/archive/x", io.NopCloser(strings.NewReader("")), &CreateOptions{}); err == nil {
+		t.Errorf("Create() in synthetic directory succeeded")
+	}
+
+	var progress []string
+	created, err := fs.Copy(ctx, "/photos/dir", "/archive/old/dir", &CopyOptions{
+		Progress: func(name string, n int) { progress = append(progress, name) },
+	})
+	if err != nil || !created {
+		t.Fatalf("Copy() = %v, %v", created, err)
+	}
+	if got, want := strings.Join(progress, " "), "/archive/old/dir /archive/old/dir/b.jpg"; got != want {
+		t.Errorf("Copy() progress = %v, want %v", got, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(string(archive), "dir", "b.jpg")); err != nil || string(data) != "b" {
+		t.Errorf("Copy(): got %q, %v", data, err)
+	}
+
+	if _, err := fs.Move(ctx, "/photos/a.jpg", "/archive/old/a.jpg", &MoveOptions{}); err != nil {
+		t.Fatalf("Move() = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(string(photos), "a.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Move(): source still exists")
+	}
+	if _, err := os.Stat(filepath.Join(string(archive), "a.jpg")); err != nil {
+		t.Errorf("Move(): %v", err)
+	}
+}
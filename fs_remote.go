@@ -0,0 +1,276 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// RemoteFileSystem implements FileSystem by proxying requests to a remote
+// WebDAV server. It can be used to re-export a WebDAV server, e.g. to
+// translate authentication.
+//
+// ETags and modification times of the remote server are preserved, and
+// ranged reads are forwarded upstream. Errors returned by the remote server
+// are reported with the same status code, except for authentication and
+// server errors which are reported as 502 Bad Gateway.
+type RemoteFileSystem struct {
+	Client *Client
+}
+
+var _ FileSystem = (*RemoteFileSystem)(nil)
+
+// remotePath converts an absolute path to a path relative to the client
+// endpoint.
+func (fs *RemoteFileSystem) remotePath(name string) string {
+	return strings.TrimPrefix(name, "/")
+}
+
+// externalPath converts a path returned by the remote server to an absolute
+// path served by this FileSystem.
+func (fs *RemoteFileSystem) externalPath(p string) string {
+	base := strings.TrimSuffix(fs.Client.ic.ResolveHref("").Path, "/")
+	p = strings.TrimPrefix(p, base)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+func remoteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var httpErr *internal.HTTPError
+	if !errors.As(err, &httpErr) {
+		return NewHTTPError(http.StatusBadGateway, err)
+	}
+	switch code := httpErr.Code; {
+	case code == http.StatusUnauthorized, code == http.StatusProxyAuthRequired, code/100 == 5:
+		return NewHTTPError(http.StatusBadGateway, err)
+	default:
+		return err
+	}
+}
+
+func (fs *RemoteFileSystem) do(req *http.Request) (*http.Response, error) {
+	resp, err := fs.Client.ic.Do(req)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	return resp, nil
+}
+
+func (fs *RemoteFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir {
+		return nil, internal.HTTPErrorf(http.StatusMethodNotAllowed, "webdav: %q is a directory", name)
+	}
+	return &remoteFileReader{ctx: ctx, fs: fs, name: name, size: fi.Size, etag: fi.ETag}, nil
+}
+
+func (fs *RemoteFileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	fi, err := fs.Client.Stat(ctx, fs.remotePath(name))
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	fi.Path = fs.externalPath(fi.Path)
+	return fi, nil
+}
+
+func (fs *RemoteFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	l, err := fs.Client.ReadDir(ctx, fs.remotePath(name), recursive)
+	if err != nil {
+		return nil, remoteError(err)
+	}
+	for i := range l {
+		l[i].Path = fs.externalPath(l[i].Path)
+	}
+	return l, nil
+}
+
+func (fs *RemoteFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	defer body.Close()
+
+	req, err := fs.Client.ic.NewRequest(http.MethodPut, fs.remotePath(name), body)
+	if err != nil {
+		return nil, false, err
+	}
+	if opts.IfMatch.IsSet() {
+		req.Header.Set("If-Match", string(opts.IfMatch))
+	}
+	if opts.IfNoneMatch.IsSet() {
+		req.Header.Set("If-None-Match", string(opts.IfNoneMatch))
+	}
+
+	resp, err := fs.do(req.WithContext(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	resp.Body.Close()
+
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+	return fi, resp.StatusCode == http.StatusCreated, nil
+}
+
+func (fs *RemoteFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	req, err := fs.Client.ic.NewRequest(http.MethodDelete, fs.remotePath(name), nil)
+	if err != nil {
+		return err
+	}
+	if opts.IfMatch.IsSet() {
+		req.Header.Set("If-Match", string(opts.IfMatch))
+	}
+	if opts.IfNoneMatch.IsSet() {
+		req.Header.Set("If-None-Match", string(opts.IfNoneMatch))
+	}
+
+	resp, err := fs.do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusMultiStatus {
+		return internal.HTTPErrorf(http.StatusBadGateway, "webdav: remote server failed to delete some members of %q", name)
+	}
+	return nil
+}
+
+func (fs *RemoteFileSystem) Mkdir(ctx context.Context, name string) error {
+	return remoteError(fs.Client.Mkdir(ctx, fs.remotePath(name)))
+}
+
+func (fs *RemoteFileSystem) copyMove(ctx context.Context, method, name, dest string, depth internal.Depth, noOverwrite bool) (created bool, err error) {
+	req, err := fs.Client.ic.NewRequest(method, fs.remotePath(name), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Destination", fs.Client.ic.ResolveHref(fs.remotePath(dest)).String())
+	req.Header.Set("Overwrite", internal.FormatOverwrite(!noOverwrite))
+	req.Header.Set("Depth", depth.String())
+
+	resp, err := fs.do(req.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusMultiStatus {
+		return false, internal.HTTPErrorf(http.StatusBadGateway, "webdav: remote server failed to %v some members of %q", strings.ToLower(method), name)
+	}
+	return resp.StatusCode == http.StatusCreated, nil
+}
+
+func (fs *RemoteFileSystem) Copy(ctx context.Context, name, dest string, options *CopyOptions) (bool, error) {
+	depth := internal.DepthInfinity
+	if options.NoRecursive {
+		depth = internal.DepthZero
+	}
+	created, err := fs.copyMove(ctx, "COPY", name, dest, depth, options.NoOverwrite)
+	if err == nil && options.Progress != nil {
+		options.Progress(path.Clean(dest), 1)
+	}
+	return created, err
+}
+
+func (fs *RemoteFileSystem) Move(ctx context.Context, name, dest string, options *MoveOptions) (bool, error) {
+	created, err := fs.copyMove(ctx, "MOVE", name, dest, internal.DepthInfinity, options.NoOverwrite)
+	if err == nil && options.Progress != nil {
+		options.Progress(path.Clean(dest), 1)
+	}
+	return created, err
+}
+
+// remoteFileReader reads a remote file lazily, issuing ranged requests when
+// seeking. Requests are conditional on the ETag of the file, so that changes
+// made while reading are detected.
+type remoteFileReader struct {
+	ctx    context.Context
+	fs     *RemoteFileSystem
+	name   string
+	size   int64
+	etag   string
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *remoteFileReader) open() error {
+	req, err := r.fs.Client.ic.NewRequest(http.MethodGet, r.fs.remotePath(r.name), nil)
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", r.offset))
+	}
+	if r.etag != "" {
+		req.Header.Set("If-Match", internal.ETag(r.etag).String())
+	}
+
+	resp, err := r.fs.do(req.WithContext(r.ctx))
+	if err != nil {
+		return err
+	}
+	if r.offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		// The remote server doesn't support ranges, skip to the offset
+		if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	}
+	r.body = resp.Body
+	return nil
+}
+
+func (r *remoteFileReader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.body.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *remoteFileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("webdav: invalid seek whence %v", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("webdav: negative seek offset")
+	}
+
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *remoteFileReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
@@ -0,0 +1,60 @@
+package webdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-webdav/internal/xmltest"
+)
+
+func TestRemoteFileSystem(t *testing.T) {
+	upstreamFS := newTestFileSystem(t, map[string]string{
+		"dir/file.txt": "0123456789",
+	})
+	upstream := httptest.NewServer(StripPrefix("/remote", &Handler{FileSystem: upstreamFS}))
+	defer upstream.Close()
+
+	client, err := NewClient(upstream.Client(), upstream.URL+"/remote/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{FileSystem: &RemoteFileSystem{Client: client}}
+
+	req := httptest.NewRequest("PROPFIND", "/dir/", nil)
+	req.Header.Set("Depth", "1")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/dir/file.txt</href>`)
+
+	upstreamInfo, err := upstreamFS.Stat(req.Context(), "/dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/dir/file.txt", nil)
+	req.Header.Set("Range", "bytes=4-6")
+	res, body = serveTestRequest(h, req)
+	if res.StatusCode != http.StatusPartialContent || body != "456" {
+		t.Errorf("GET range: got status %v, body %q", res.StatusCode, body)
+	}
+	if got, want := res.Header.Get("ETag"), `"`+upstreamInfo.ETag+`"`; got != want {
+		t.Errorf("GET: got ETag %v, want %v", got, want)
+	}
+
+	res, _ = serveTestRequest(h, httptest.NewRequest(http.MethodPut, "/dir/new.txt", strings.NewReader("new")))
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("PUT: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if data, err := os.ReadFile(filepath.Join(string(upstreamFS), "dir", "new.txt")); err != nil || string(data) != "new" {
+		t.Errorf("PUT: upstream file contains %q, %v", data, err)
+	}
+
+	if res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/missing", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET missing: got status %v, want %v", res.StatusCode, http.StatusNotFound)
+	}
+}
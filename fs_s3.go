@@ -0,0 +1,482 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Object describes an object stored in an S3 bucket.
+type S3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// ETag is the S3 ETag of the object, with or without surrounding quotes.
+	ETag        string
+	ContentType string
+}
+
+// S3ListResult is a page of results of an S3 ListObjectsV2 request.
+type S3ListResult struct {
+	Objects        []S3Object
+	CommonPrefixes []string
+	// NextContinuationToken is empty if this is the last page.
+	NextContinuationToken string
+}
+
+// S3Client is the subset of the S3 API used by S3FileSystem. It can be
+// implemented on top of any S3 SDK, bound to a single bucket.
+//
+// HeadObject and GetObject must return an error matching fs.ErrNotExist if
+// the object doesn't exist.
+type S3Client interface {
+	HeadObject(ctx context.Context, key string) (*S3Object, error)
+	// GetObject fetches the contents of an object, starting at offset. If
+	// length is negative, the object is read until the end.
+	GetObject(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// ListObjects lists the objects whose key starts with prefix. If
+	// delimiter is non-empty, keys containing delimiter after the prefix are
+	// rolled up into common prefixes.
+	ListObjects(ctx context.Context, prefix, delimiter, continuationToken string) (*S3ListResult, error)
+	// PutObject uploads an object. Implementations should switch to a
+	// multipart upload for large bodies.
+	PutObject(ctx context.Context, key string, body io.Reader, contentType string) (*S3Object, error)
+	// CopyObject performs a server-side copy of an object.
+	CopyObject(ctx context.Context, srcKey, dstKey string) (*S3Object, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// S3FileSystem implements FileSystem on top of S3-compatible object storage.
+//
+// Collections are represented by zero-byte marker objects whose key ends with
+// a slash. Collections without a marker are inferred from the keys of their
+// members.
+type S3FileSystem struct {
+	Client S3Client
+	// Prefix is prepended to object keys. It is typically empty or ends
+	// with a slash.
+	Prefix string
+}
+
+var _ FileSystem = (*S3FileSystem)(nil)
+
+func (fs *S3FileSystem) fileKey(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return fs.Prefix + name
+}
+
+func (fs *S3FileSystem) dirKey(name string) string {
+	key := fs.fileKey(name)
+	if key != "" && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	return key
+}
+
+func (fs *S3FileSystem) externalPath(key string) string {
+	return "/" + strings.TrimPrefix(key, fs.Prefix)
+}
+
+func (fs *S3FileSystem) fileInfo(obj *S3Object) *FileInfo {
+	p := fs.externalPath(obj.Key)
+	mimeType := obj.ContentType
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(path.Ext(p))
+	}
+	return &FileInfo{
+		Path:     p,
+		Size:     obj.Size,
+		ModTime:  obj.LastModified,
+		MIMEType: mimeType,
+		ETag:     strings.Trim(obj.ETag, `"`),
+	}
+}
+
+func (fs *S3FileSystem) dirInfo(key string) *FileInfo {
+	return &FileInfo{
+		Path:  fs.externalPath(key),
+		IsDir: true,
+	}
+}
+
+func s3Error(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return NewHTTPError(http.StatusNotFound, err)
+	}
+	return err
+}
+
+// walk calls fn for each page of objects under prefix.
+func (fs *S3FileSystem) walk(ctx context.Context, prefix, delimiter string, fn func(*S3ListResult) error) error {
+	var token string
+	for {
+		res, err := fs.Client.ListObjects(ctx, prefix, delimiter, token)
+		if err != nil {
+			return err
+		}
+		if err := fn(res); err != nil {
+			return err
+		}
+		if res.NextContinuationToken == "" {
+			return nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+func (fs *S3FileSystem) dirExists(ctx context.Context, name string) (bool, error) {
+	key := fs.dirKey(name)
+	if key == fs.Prefix {
+		return true, nil
+	}
+	res, err := fs.Client.ListObjects(ctx, key, "/", "")
+	if err != nil {
+		return false, err
+	}
+	return len(res.Objects) > 0 || len(res.CommonPrefixes) > 0, nil
+}
+
+func (fs *S3FileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := fs.Client.HeadObject(ctx, fs.fileKey(name))
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return &s3ObjectReader{ctx: ctx, client: fs.Client, key: obj.Key, size: obj.Size}, nil
+}
+
+func (fs *S3FileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	if key := fs.fileKey(name); key != fs.Prefix && !strings.HasSuffix(name, "/") {
+		obj, err := fs.Client.HeadObject(ctx, key)
+		if err == nil {
+			return fs.fileInfo(obj), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if ok, err := fs.dirExists(ctx, name); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, NewHTTPError(http.StatusNotFound, os.ErrNotExist)
+	}
+	return fs.dirInfo(fs.dirKey(name)), nil
+}
+
+func (fs *S3FileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir {
+		return []FileInfo{*fi}, nil
+	}
+
+	prefix := fs.dirKey(name)
+	delimiter := "/"
+	if recursive {
+		delimiter = ""
+	}
+
+	dirs := map[string]bool{prefix: true}
+	l := []FileInfo{*fs.dirInfo(prefix)}
+	addDir := func(key string) {
+		if !dirs[key] {
+			dirs[key] = true
+			l = append(l, *fs.dirInfo(key))
+		}
+	}
+	err = fs.walk(ctx, prefix, delimiter, func(res *S3ListResult) error {
+		for _, p := range res.CommonPrefixes {
+			addDir(p)
+		}
+		for i := range res.Objects {
+			obj := &res.Objects[i]
+			// Infer intermediate collections which don't have a marker
+			rel := strings.TrimPrefix(obj.Key, prefix)
+			for i := 0; ; {
+				j := strings.IndexByte(rel[i:], '/')
+				if j < 0 {
+					break
+				}
+				i += j + 1
+				addDir(prefix + rel[:i])
+			}
+			if !strings.HasSuffix(obj.Key, "/") {
+				l = append(l, *fs.fileInfo(obj))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	children := l[1:]
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path < children[j].Path
+	})
+	return l, nil
+}
+
+func (fs *S3FileSystem) checkParent(ctx context.Context, name string) error {
+	parent := path.Dir(path.Clean("/" + name))
+	if ok, err := fs.dirExists(ctx, parent); err != nil {
+		return err
+	} else if !ok {
+		return NewHTTPError(http.StatusConflict, fmt.Errorf("webdav: parent collection %q doesn't exist", parent))
+	}
+	return nil
+}
+
+func (fs *S3FileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (fi *FileInfo, created bool, err error) {
+	fi, err = fs.Stat(ctx, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+	if fi != nil && fi.IsDir {
+		return nil, false, NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("webdav: %q is a collection", name))
+	}
+	created = fi == nil
+
+	if err := checkConditionalMatches(fi, opts.IfMatch, opts.IfNoneMatch); err != nil {
+		return nil, false, err
+	}
+	if err := fs.checkParent(ctx, name); err != nil {
+		return nil, false, err
+	}
+
+	key := fs.fileKey(name)
+	obj, err := fs.Client.PutObject(ctx, key, body, mime.TypeByExtension(path.Ext(key)))
+	if err != nil {
+		return nil, false, err
+	}
+	if obj.Key == "" {
+		obj.Key = key
+	}
+	return fs.fileInfo(obj), created, nil
+}
+
+// listKeys returns the keys of all objects affected by an operation on fi: the
+// object itself for a file, or all objects under the collection prefix
+// (including its marker, if any) for a collection.
+func (fs *S3FileSystem) listKeys(ctx context.Context, fi *FileInfo) ([]string, error) {
+	if !fi.IsDir {
+		return []string{fs.fileKey(fi.Path)}, nil
+	}
+
+	var keys []string
+	err := fs.walk(ctx, fs.dirKey(fi.Path), "", func(res *S3ListResult) error {
+		for _, obj := range res.Objects {
+			keys = append(keys, obj.Key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (fs *S3FileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	fi, err := fs.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := checkConditionalMatches(fi, opts.IfMatch, opts.IfNoneMatch); err != nil {
+		return err
+	}
+	return fs.removeAll(ctx, fi)
+}
+
+func (fs *S3FileSystem) removeAll(ctx context.Context, fi *FileInfo) error {
+	keys, err := fs.listKeys(ctx, fi)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := fs.Client.DeleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *S3FileSystem) Mkdir(ctx context.Context, name string) error {
+	if _, err := fs.Stat(ctx, name); err == nil {
+		return NewHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("webdav: %q already exists", name))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := fs.checkParent(ctx, name); err != nil {
+		return err
+	}
+
+	_, err := fs.Client.PutObject(ctx, fs.dirKey(name), strings.NewReader(""), "")
+	return err
+}
+
+// prepareDest checks whether the destination of a COPY or MOVE exists, and
+// removes it if overwriting is allowed.
+func (fs *S3FileSystem) prepareDest(ctx context.Context, dst string, noOverwrite bool) (created bool, err error) {
+	dstInfo, err := fs.Stat(ctx, dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, fs.checkParent(ctx, dst)
+	} else if err != nil {
+		return false, err
+	}
+
+	if noOverwrite {
+		return false, NewHTTPError(http.StatusPreconditionFailed, os.ErrExist)
+	}
+	return false, fs.removeAll(ctx, dstInfo)
+}
+
+func (fs *S3FileSystem) copy(ctx context.Context, srcInfo *FileInfo, dst string, recursive bool, progress ProgressFunc) error {
+	if !srcInfo.IsDir {
+		_, err := fs.Client.CopyObject(ctx, fs.fileKey(srcInfo.Path), fs.fileKey(dst))
+		if err == nil && progress != nil {
+			progress(path.Clean("/"+dst), 1)
+		}
+		return err
+	}
+
+	srcPrefix := fs.dirKey(srcInfo.Path)
+	dstPrefix := fs.dirKey(dst)
+
+	var completed []string
+	done := func(key string) {
+		p := fs.externalPath(key)
+		completed = append(completed, p)
+		if progress != nil {
+			progress(p, len(completed))
+		}
+	}
+
+	if _, err := fs.Client.PutObject(ctx, dstPrefix, strings.NewReader(""), ""); err != nil {
+		return err
+	}
+	done(dstPrefix)
+	if !recursive {
+		return nil
+	}
+
+	keys, err := fs.listKeys(ctx, srcInfo)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key == srcPrefix {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return &PartialError{Completed: completed, Err: err}
+		}
+
+		dstKey := dstPrefix + strings.TrimPrefix(key, srcPrefix)
+		if _, err := fs.Client.CopyObject(ctx, key, dstKey); err != nil {
+			return err
+		}
+		done(dstKey)
+	}
+	return nil
+}
+
+func (fs *S3FileSystem) Copy(ctx context.Context, src, dst string, options *CopyOptions) (created bool, err error) {
+	srcInfo, err := fs.Stat(ctx, src)
+	if err != nil {
+		return false, err
+	}
+	created, err = fs.prepareDest(ctx, dst, options.NoOverwrite)
+	if err != nil {
+		return false, err
+	}
+
+	if err := fs.copy(ctx, srcInfo, dst, !options.NoRecursive, options.Progress); err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// Move is implemented as a server-side copy followed by a removal of the
+// source, since S3 has no rename operation.
+func (fs *S3FileSystem) Move(ctx context.Context, src, dst string, options *MoveOptions) (created bool, err error) {
+	srcInfo, err := fs.Stat(ctx, src)
+	if err != nil {
+		return false, err
+	}
+	created, err = fs.prepareDest(ctx, dst, options.NoOverwrite)
+	if err != nil {
+		return false, err
+	}
+
+	if err := fs.copy(ctx, srcInfo, dst, true, options.Progress); err != nil {
+		return false, err
+	}
+	if err := fs.removeAll(ctx, srcInfo); err != nil {
+		return false, err
+	}
+	return created, nil
+}
+
+// s3ObjectReader is an io.ReadSeeker for an S3 object. A ranged GetObject
+// request is issued on the first read after each seek, so that
+// http.ServeContent can serve range requests without downloading the whole
+// object.
+type s3ObjectReader struct {
+	ctx    context.Context
+	client S3Client
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3ObjectReader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.client.GetObject(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, s3Error(err)
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("webdav: invalid seek whence %v", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("webdav: negative seek offset")
+	}
+
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *s3ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
@@ -0,0 +1,182 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memS3Client is an in-memory S3Client.
+type memS3Client struct {
+	objects map[string][]byte
+	gets    []string
+}
+
+func (c *memS3Client) object(key string) *S3Object {
+	data := c.objects[key]
+	return &S3Object{
+		Key:          key,
+		Size:         int64(len(data)),
+		LastModified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ETag:         fmt.Sprintf(`"%x"`, len(data)),
+	}
+}
+
+func (c *memS3Client) HeadObject(ctx context.Context, key string) (*S3Object, error) {
+	if _, ok := c.objects[key]; !ok {
+		return nil, os.ErrNotExist
+	}
+	return c.object(key), nil
+}
+
+func (c *memS3Client) GetObject(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	data, ok := c.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	c.gets = append(c.gets, fmt.Sprintf("%v@%v", key, offset))
+	data = data[offset:]
+	if length >= 0 {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *memS3Client) ListObjects(ctx context.Context, prefix, delimiter, token string) (*S3ListResult, error) {
+	var keys []string
+	for key := range c.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var res S3ListResult
+	prefixes := make(map[string]bool)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rel := strings.TrimPrefix(key, prefix)
+		if i := strings.Index(rel, delimiter); delimiter != "" && i >= 0 {
+			p := prefix + rel[:i+len(delimiter)]
+			if !prefixes[p] {
+				prefixes[p] = true
+				res.CommonPrefixes = append(res.CommonPrefixes, p)
+			}
+			continue
+		}
+		res.Objects = append(res.Objects, *c.object(key))
+	}
+	return &res, nil
+}
+
+func (c *memS3Client) PutObject(ctx context.Context, key string, body io.Reader, contentType string) (*S3Object, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	c.objects[key] = data
+	return c.object(key), nil
+}
+
+func (c *memS3Client) CopyObject(ctx context.Context, srcKey, dstKey string) (*S3Object, error) {
+	data, ok := c.objects[srcKey]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	c.objects[dstKey] = data
+	return c.object(dstKey), nil
+}
+
+func (c *memS3Client) DeleteObject(ctx context.Context, key string) error {
+	delete(c.objects, key)
+	return nil
+}
+
+func TestS3FileSystem(t *testing.T) {
+	client := &memS3Client{objects: map[string][]byte{
+		"root/a.txt":       []byte("Hello world"),
+		"root/dir/b.txt":   []byte("b"),
+		"root/dir/sub/c":   []byte("c"),
+		"root/marker/":     nil,
+		"outside/ignored/": nil,
+	}}
+	fs := &S3FileSystem{Client: client, Prefix: "root/"}
+	ctx := context.Background()
+
+	fi, err := fs.Stat(ctx, "/a.txt")
+	if err != nil {
+		t.Fatalf("Stat() = %v", err)
+	} else if fi.IsDir || fi.Size != 11 || fi.ETag != "b" || fi.MIMEType != "text/plain; charset=utf-8" {
+		t.Errorf("Stat() = %+v", fi)
+	}
+	if fi, err := fs.Stat(ctx, "/dir"); err != nil || !fi.IsDir {
+		t.Errorf("Stat(/dir) = %+v, %v", fi, err)
+	}
+	if _, err := fs.Stat(ctx, "/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(/missing) = %v, want not found", err)
+	}
+
+	var paths []string
+	l, err := fs.ReadDir(ctx, "/", true)
+	if err != nil {
+		t.Fatalf("ReadDir() = %v", err)
+	}
+	for _, fi := range l {
+		paths = append(paths, fi.Path)
+	}
+	want := "/ /a.txt /dir/ /dir/b.txt /dir/sub/ /dir/sub/c /marker/"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("ReadDir(recursive) = %v, want %v", got, want)
+	}
+
+	if _, _, err := fs.Create(ctx, "/nodir/x", io.NopCloser(strings.NewReader("")), &CreateOptions{}); err == nil {
+		t.Errorf("Create() in missing collection succeeded")
+	}
+	if err := fs.Mkdir(ctx, "/new"); err != nil {
+		t.Fatalf("Mkdir() = %v", err)
+	}
+	if _, ok := client.objects["root/new/"]; !ok {
+		t.Errorf("Mkdir() didn't create a marker object")
+	}
+
+	if _, err := fs.Move(ctx, "/dir", "/new/moved", &MoveOptions{}); err != nil {
+		t.Fatalf("Move() = %v", err)
+	}
+	for _, key := range []string{"root/new/moved/b.txt", "root/new/moved/sub/c"} {
+		if _, ok := client.objects[key]; !ok {
+			t.Errorf("Move(): %v missing", key)
+		}
+	}
+	if _, ok := client.objects["root/dir/b.txt"]; ok {
+		t.Errorf("Move(): source not removed")
+	}
+}
+
+func TestS3FileSystemRange(t *testing.T) {
+	client := &memS3Client{objects: map[string][]byte{
+		"file.txt": []byte("0123456789"),
+	}}
+	h := &Handler{FileSystem: &S3FileSystem{Client: client}}
+
+	req := httptest.NewRequest(http.MethodGet, "/file.txt", nil)
+	req.Header.Set("Range", "bytes=4-6")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusPartialContent)
+	}
+	if body != "456" {
+		t.Errorf("got body %q, want %q", body, "456")
+	}
+	if len(client.gets) != 1 || client.gets[0] != "file.txt@4" {
+		t.Errorf("got GetObject calls %v, want a single ranged request", client.gets)
+	}
+}
@@ -0,0 +1,98 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// PerUserFileSystem is a FileSystem serving each user their own FileSystem,
+// e.g. to give each user a separate root directory. It's called with the
+// principal of the request, see PrincipalFromContext, and typically used
+// behind Authenticate.
+//
+// Requests without a principal fail with 401 Unauthorized. If the function
+// returns nil, requests fail with 403 Forbidden. The optional interfaces of
+// per-user FileSystems, such as QuotaProvider, aren't exposed.
+type PerUserFileSystem func(principal string) FileSystem
+
+var _ FileSystem = PerUserFileSystem(nil)
+
+func (f PerUserFileSystem) fileSystem(ctx context.Context) (FileSystem, error) {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return nil, internal.HTTPErrorf(http.StatusUnauthorized, "webdav: authentication required")
+	}
+	fs := f(principal)
+	if fs == nil {
+		return nil, internal.HTTPErrorf(http.StatusForbidden, "webdav: no filesystem for principal %q", principal)
+	}
+	return fs, nil
+}
+
+func (f PerUserFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Open(ctx, name)
+}
+
+func (f PerUserFileSystem) Stat(ctx context.Context, name string) (*FileInfo, error) {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(ctx, name)
+}
+
+func (f PerUserFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(ctx, name, recursive)
+}
+
+func (f PerUserFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		body.Close()
+		return nil, false, err
+	}
+	return fs.Create(ctx, name, body, opts)
+}
+
+func (f PerUserFileSystem) RemoveAll(ctx context.Context, name string, opts *RemoveAllOptions) error {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return err
+	}
+	return fs.RemoveAll(ctx, name, opts)
+}
+
+func (f PerUserFileSystem) Mkdir(ctx context.Context, name string) error {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return err
+	}
+	return fs.Mkdir(ctx, name)
+}
+
+func (f PerUserFileSystem) Copy(ctx context.Context, name, dest string, options *CopyOptions) (bool, error) {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return false, err
+	}
+	return fs.Copy(ctx, name, dest, options)
+}
+
+func (f PerUserFileSystem) Move(ctx context.Context, name, dest string, options *MoveOptions) (bool, error) {
+	fs, err := f.fileSystem(ctx)
+	if err != nil {
+		return false, err
+	}
+	return fs.Move(ctx, name, dest, options)
+}
@@ -0,0 +1,47 @@
+package webdav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPerUserFileSystem(t *testing.T) {
+	roots := map[string]FileSystem{
+		"alice": newTestFileSystem(t, map[string]string{"photo.jpg": "alice"}),
+		"bob":   newTestFileSystem(t, map[string]string{"photo.jpg": "bob"}),
+	}
+	h := &Handler{FileSystem: PerUserFileSystem(func(principal string) FileSystem {
+		return roots[principal]
+	})}
+
+	serve := func(principal string, req *http.Request) (*http.Response, string) {
+		if principal != "" {
+			req = req.WithContext(ContextWithPrincipal(req.Context(), principal))
+		}
+		return serveTestRequest(h, req)
+	}
+
+	for _, principal := range []string{"alice", "bob"} {
+		res, body := serve(principal, httptest.NewRequest(http.MethodGet, "/photo.jpg", nil))
+		if res.StatusCode != http.StatusOK || body != principal {
+			t.Errorf("GET as %v: got %v %q, want %v %q", principal, res.StatusCode, body, http.StatusOK, principal)
+		}
+	}
+
+	res, _ := serve("alice", httptest.NewRequest(http.MethodPut, "/new.jpg", strings.NewReader("new")))
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT as alice: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if res, _ := serve("bob", httptest.NewRequest(http.MethodGet, "/new.jpg", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET as bob: got status %v, want %v", res.StatusCode, http.StatusNotFound)
+	}
+
+	if res, _ := serve("", httptest.NewRequest(http.MethodGet, "/photo.jpg", nil)); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without principal: got status %v, want %v", res.StatusCode, http.StatusUnauthorized)
+	}
+	if res, _ := serve("eve", httptest.NewRequest(http.MethodGet, "/photo.jpg", nil)); res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET as unknown user: got status %v, want %v", res.StatusCode, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,52 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func fuzzHandler(f *testing.F, method string, seeds ...string) {
+	fs := &propertyFileSystem{
+		LocalFileSystem: LocalFileSystem(f.TempDir()),
+		props:           make(map[string]map[xml.Name]string),
+	}
+	if _, _, err := fs.Create(context.Background(), "/a.txt", io.NopCloser(strings.NewReader("a")), &CreateOptions{}); err != nil {
+		f.Fatal(err)
+	}
+	h := &Handler{FileSystem: fs}
+
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		req := httptest.NewRequest(method, "/a.txt", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "0")
+		res, _ := serveTestRequest(h, req)
+		if res.StatusCode >= 500 {
+			t.Errorf("got status %v", res.StatusCode)
+		}
+	})
+}
+
+func FuzzPropFind(f *testing.F) {
+	fuzzHandler(f, "PROPFIND",
+		`<propfind xmlns="DAV:"><allprop/></propfind>`,
+		`<propfind xmlns="DAV:"><propname/></propfind>`,
+		`<propfind xmlns="DAV:"><prop><getetag/><resourcetype/><x xmlns="urn:x"/></prop></propfind>`,
+		`<propfind xmlns="DAV:"><allprop/><include><owner/></include></propfind>`,
+	)
+}
+
+func FuzzPropPatch(f *testing.F) {
+	fuzzHandler(f, "PROPPATCH",
+		`<propertyupdate xmlns="DAV:"><set><prop><displayname>a</displayname></prop></set></propertyupdate>`,
+		`<propertyupdate xmlns="DAV:"><remove><prop><x xmlns="urn:x"/></prop></remove></propertyupdate>`,
+		`<propertyupdate xmlns="DAV:"><set><prop><getcontenttype>text/plain</getcontenttype><x xmlns="urn:x"><y/></x></prop></set></propertyupdate>`,
+	)
+}
@@ -0,0 +1,173 @@
+package webdav
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyOptions configures the replay of responses to retried requests
+// by Idempotent.
+//
+// Clients which can't tell whether a request has been processed, e.g.
+// because the connection dropped before the response was received, can retry
+// it with the same idempotency key. The key is chosen by the client and
+// scoped to the authenticated principal, see PrincipalFromContext.
+type IdempotencyOptions struct {
+	// Header is the name of the header carrying idempotency keys. If empty,
+	// "Idempotency-Key" is used.
+	Header string
+	// TTL is the duration responses are remembered for. If zero, one minute
+	// is used.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[idempotencyKey]*idempotencyEntry
+	swept   time.Time
+}
+
+type idempotencyKey struct {
+	principal, key string
+}
+
+type idempotencyEntry struct {
+	method, path string
+	expires      time.Time
+	done         bool
+
+	code   int
+	header http.Header
+	body   []byte
+}
+
+// Idempotent returns a handler remembering the responses to PUT and POST
+// requests carrying an idempotency key, before invoking h. Retries with the
+// same key get the original response, without reaching h. This avoids e.g.
+// creating a second member when a POST request to an add-member URL is
+// retried.
+//
+// Server errors aren't remembered, so that the request can be retried. If
+// the original request is still being processed, retries fail with 409
+// Conflict. Reusing a key for another request fails with 422 Unprocessable
+// Entity.
+func Idempotent(opts *IdempotencyOptions, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(opts.header())
+		if key == "" || (r.Method != http.MethodPut && r.Method != http.MethodPost) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		principal, _ := PrincipalFromContext(r.Context())
+		k := idempotencyKey{principal: principal, key: key}
+		entry, ok := opts.acquire(k, r)
+		if !ok {
+			switch {
+			case entry.method != r.Method || entry.path != r.URL.Path:
+				http.Error(w, "webdav: idempotency key reused for another request", http.StatusUnprocessableEntity)
+			case !entry.done:
+				http.Error(w, "webdav: original request still in progress", http.StatusConflict)
+			default:
+				for name, values := range entry.header {
+					w.Header()[name] = values
+				}
+				w.WriteHeader(entry.code)
+				w.Write(entry.body)
+			}
+			return
+		}
+
+		rw := &idempotencyResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(rw, r)
+		opts.release(k, entry, rw)
+	})
+}
+
+func (opts *IdempotencyOptions) header() string {
+	if opts.Header == "" {
+		return "Idempotency-Key"
+	}
+	return opts.Header
+}
+
+func (opts *IdempotencyOptions) ttl() time.Duration {
+	if opts.TTL == 0 {
+		return time.Minute
+	}
+	return opts.TTL
+}
+
+// acquire returns the entry for a key. If there is none, a new one is
+// created and true is returned: the request must be processed.
+func (opts *IdempotencyOptions) acquire(k idempotencyKey, r *http.Request) (*idempotencyEntry, bool) {
+	opts.mu.Lock()
+	defer opts.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(opts.swept) > opts.ttl() {
+		for k, entry := range opts.entries {
+			if entry.done && now.After(entry.expires) {
+				delete(opts.entries, k)
+			}
+		}
+		opts.swept = now
+	}
+
+	if entry, ok := opts.entries[k]; ok && (!entry.done || now.Before(entry.expires)) {
+		return entry, false
+	}
+
+	if opts.entries == nil {
+		opts.entries = make(map[idempotencyKey]*idempotencyEntry)
+	}
+	entry := &idempotencyEntry{method: r.Method, path: r.URL.Path}
+	opts.entries[k] = entry
+	return entry, true
+}
+
+// release records the response to a processed request.
+func (opts *IdempotencyOptions) release(k idempotencyKey, entry *idempotencyEntry, rw *idempotencyResponseWriter) {
+	opts.mu.Lock()
+	defer opts.mu.Unlock()
+
+	code := rw.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if code >= 500 {
+		delete(opts.entries, k)
+		return
+	}
+
+	entry.done = true
+	entry.expires = time.Now().Add(opts.ttl())
+	entry.code = code
+	entry.header = rw.Header().Clone()
+	entry.body = rw.body.Bytes()
+}
+
+type idempotencyResponseWriter struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rw *idempotencyResponseWriter) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *idempotencyResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
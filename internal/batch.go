@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// BatchNamespace is the XML namespace of the extensions implemented by this
+// module.
+const BatchNamespace = "https://github.com/emersion/go-webdav"
+
+var BatchDeleteName = xml.Name{Space: BatchNamespace, Local: "batch-delete"}
+
+// BatchDelete is the body of a batch-delete REPORT request, which deletes
+// multiple members of a collection at once. The response is a 207
+// Multi-Status with the status of each href.
+type BatchDelete struct {
+	XMLName xml.Name `xml:"https://github.com/emersion/go-webdav batch-delete"`
+	Hrefs   []Href   `xml:"DAV: href"`
+}
+
+// maxReportPeekSize is the maximum number of bytes read by peekReportName
+// to find the root element of a REPORT request body.
+const maxReportPeekSize = 64 * 1024
+
+// peekReportName returns the name of the root element of a REPORT request
+// body, and restores the body so that it can be decoded again. Only the bytes
+// preceding the root element are buffered, up to maxReportPeekSize.
+func peekReportName(r *http.Request) (xml.Name, error) {
+	var buf bytes.Buffer
+	dec := xml.NewDecoder(io.LimitReader(io.TeeReader(r.Body, &buf), maxReportPeekSize))
+	defer func() {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&buf, r.Body), r.Body}
+	}()
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && buf.Len() >= maxReportPeekSize {
+			return xml.Name{}, HTTPErrorf(http.StatusRequestEntityTooLarge, "webdav: REPORT request root element not found in the first %v bytes", maxReportPeekSize)
+		} else if err != nil {
+			return xml.Name{}, &HTTPError{http.StatusBadRequest, err}
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+func (h *Handler) handleBatchDelete(w http.ResponseWriter, r *http.Request, deleter Deleter) error {
+	var req BatchDelete
+	if err := DecodeXMLRequest(r, &req); err != nil {
+		return err
+	}
+
+	// Hrefs include the prefix stripped from the request URI, if any. It's
+	// added back to the hrefs of the response by StripPrefix.
+	prefix := RequestPathPrefix(r)
+	dir := strings.TrimSuffix(path.Clean(r.URL.Path), "/") + "/"
+
+	var resps []Response
+	for _, href := range req.Hrefs {
+		name := path.Clean("/" + strings.TrimPrefix(href.Path, prefix))
+		if !strings.HasPrefix(name, dir) {
+			err := HTTPErrorf(http.StatusForbidden, "webdav: %q isn't a member of %q", href.Path, r.URL.Path)
+			resps = append(resps, *NewErrorResponse(name, err))
+			continue
+		}
+
+		// Conditional headers apply to the collection, not to its members
+		dr := r.Clone(r.Context())
+		dr.Method = http.MethodDelete
+		dr.URL.Path, dr.URL.RawPath = name, ""
+		dr.Body, dr.ContentLength = http.NoBody, 0
+		dr.Header.Del("If-Match")
+		dr.Header.Del("If-None-Match")
+		dr.Header.Del("Content-Type")
+
+		if h.Authorize != nil {
+			if err := h.Authorize(dr, http.MethodDelete, name); err != nil {
+				resps = append(resps, *NewErrorResponse(name, err))
+				continue
+			}
+		}
+
+		if err := deleter.Delete(dr); err != nil {
+			resps = append(resps, *NewErrorResponse(name, err))
+			continue
+		}
+		resp := NewOKResponse(name)
+		resp.Status.Code = http.StatusNoContent
+		resps = append(resps, *resp)
+	}
+
+	return ServeMultiStatus(w, NewMultiStatus(resps...))
+}
@@ -83,6 +83,23 @@ func DiscoverContextURL(ctx context.Context, service, domain string) (string, er
 	return u.String(), nil
 }
 
+// DiscoveryEndpoints returns the URLs to query in turn to find the current
+// user principal of a CardDAV/CalDAV server, as described in RFC 6764 section
+// 6. If serverURL has a path, it's used as the context path. Otherwise, the
+// well-known URL of the service is tried first, then serverURL itself.
+func DiscoveryEndpoints(serverURL, service string) ([]string, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path != "" && u.Path != "/" {
+		return []string{serverURL}, nil
+	}
+	wellKnown := *u
+	wellKnown.Path = "/.well-known/" + service
+	return []string{wellKnown.String(), serverURL}, nil
+}
+
 // HTTPClient performs HTTP requests. It's implemented by *http.Client.
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -148,7 +165,7 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 	if resp.StatusCode/100 != 2 {
-		defer resp.Body.Close()
+		defer DiscardBody(resp.Body)
 
 		contentType := resp.Header.Get("Content-Type")
 		if contentType == "" {
@@ -168,7 +185,6 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 			lr := io.LimitedReader{R: resp.Body, N: 1024}
 			var buf bytes.Buffer
 			io.Copy(&buf, &lr)
-			resp.Body.Close()
 			if s := strings.TrimSpace(buf.String()); s != "" {
 				if lr.N == 0 {
 					s += " […]"
@@ -181,12 +197,23 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+// maxDiscardBodySize is the maximum number of bytes read by DiscardBody.
+const maxDiscardBodySize = 256 * 1024
+
+// DiscardBody reads the rest of a response body and closes it, so that the
+// underlying connection can be reused by the HTTP client. Bodies larger than
+// maxDiscardBodySize are closed without being fully read.
+func DiscardBody(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, maxDiscardBodySize)
+	body.Close()
+}
+
 func (c *Client) DoMultiStatus(req *http.Request) (*MultiStatus, error) {
 	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	defer DiscardBody(resp.Body)
 
 	if resp.StatusCode != http.StatusMultiStatus {
 		return nil, fmt.Errorf("HTTP multi-status request failed: %v", resp.Status)
@@ -254,7 +281,7 @@ func (c *Client) Options(ctx context.Context, path string) (classes map[string]b
 	if err != nil {
 		return nil, nil, err
 	}
-	resp.Body.Close()
+	DiscardBody(resp.Body)
 
 	classes = parseCommaSeparatedSet(resp.Header["Dav"], false)
 	if !classes["1"] {
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Collations supported by text-match filters, defined in RFC 4790 and
+// RFC 5051.
+const (
+	CollationOctet          = "i;octet"
+	CollationASCIICasemap   = "i;ascii-casemap"
+	CollationUnicodeCasemap = "i;unicode-casemap"
+)
+
+// DefaultCollation is used by text-match filters without a collation
+// attribute.
+const DefaultCollation = CollationASCIICasemap
+
+// Collations lists the collations implemented by FoldCollation.
+var Collations = []string{CollationASCIICasemap, CollationOctet, CollationUnicodeCasemap}
+
+// IsSupportedCollation checks whether FoldCollation implements a collation.
+// The empty collation refers to DefaultCollation.
+func IsSupportedCollation(collation string) bool {
+	if collation == "" {
+		return true
+	}
+	for _, c := range Collations {
+		if c == collation {
+			return true
+		}
+	}
+	return false
+}
+
+// FoldCollation returns the form of s compared by a collation: two strings
+// are equal for the collation if their folded forms are equal, and substring
+// matches can be performed on folded forms.
+//
+// i;ascii-casemap folds ASCII letters only. i;unicode-casemap folds all
+// letters with their title case, but doesn't decompose characters: strings
+// using composed and decomposed forms of accented letters don't match.
+// Unsupported collations are treated as i;octet.
+func FoldCollation(collation, s string) string {
+	switch collation {
+	case "", CollationASCIICasemap:
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' {
+				return r - 'a' + 'A'
+			}
+			return r
+		}, s)
+	case CollationUnicodeCasemap:
+		return strings.Map(func(r rune) rune {
+			return unicode.ToTitle(unicode.ToLower(r))
+		}, s)
+	default:
+		return s
+	}
+}
@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrContentTooLarge is returned by ContentLimitReader when a limit is
+// exceeded.
+var ErrContentTooLarge = errors.New("webdav: content too large")
+
+// ContentLimitReader limits the size and the number of content lines of an
+// iCalendar or vCard object, as defined in RFC 5545 section 3.1 and RFC 6350
+// section 3.2. Folded lines are counted once. BEGIN and END lines are
+// counted too, so that nested components are limited as well.
+//
+// Limits are checked as the object is read, so that oversized objects are
+// rejected before being fully buffered.
+type ContentLimitReader struct {
+	r        io.Reader
+	maxSize  int64
+	maxLines int
+
+	size     int64
+	lines    int
+	midLine  bool
+	exceeded bool
+}
+
+// NewContentLimitReader creates a new ContentLimitReader. A zero limit means
+// no limit.
+func NewContentLimitReader(r io.Reader, maxSize int64, maxLines int) *ContentLimitReader {
+	return &ContentLimitReader{r: r, maxSize: maxSize, maxLines: maxLines}
+}
+
+func (lr *ContentLimitReader) Read(b []byte) (int, error) {
+	if lr.exceeded {
+		return 0, ErrContentTooLarge
+	}
+
+	n, err := lr.r.Read(b)
+	lr.size += int64(n)
+	for _, c := range b[:n] {
+		if !lr.midLine && c != ' ' && c != '\t' {
+			lr.lines++
+		}
+		lr.midLine = c != '\n'
+	}
+
+	if (lr.maxSize > 0 && lr.size > lr.maxSize) || (lr.maxLines > 0 && lr.lines > lr.maxLines) {
+		lr.exceeded = true
+		return 0, ErrContentTooLarge
+	}
+	return n, err
+}
+
+// Exceeded reports whether a limit has been exceeded.
+func (lr *ContentLimitReader) Exceeded() bool {
+	return lr.exceeded
+}
+
+// maxObjectNameUIDLen is the length above which UIDs are hashed to build
+// object names.
+const maxObjectNameUIDLen = 128
+
+// ObjectName returns the name of an iCalendar or vCard object resource
+// derived from its UID, e.g. "<UID>.ics". UIDs which are too long or contain
+// characters which may not be safe in a path segment are replaced with their
+// SHA-256 hash, so that the name is stable.
+func ObjectName(uid, ext string) string {
+	safe := uid != "" && len(uid) <= maxObjectNameUIDLen && uid[0] != '.'
+	for _, c := range uid {
+		if !isObjectNameChar(c) {
+			safe = false
+			break
+		}
+	}
+	if !safe {
+		sum := sha256.Sum256([]byte(uid))
+		uid = hex.EncodeToString(sum[:])
+	}
+	return uid + ext
+}
+
+func isObjectNameChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.ContainsRune("-_.@+", c)
+}
+
+// ContentError is a syntax error in an iCalendar or vCard object.
+type ContentError struct {
+	// Line is the number of the physical line where the content line
+	// starts, beginning at 1. It's zero if unknown.
+	Line int
+	// Component is the name of the innermost component, e.g. "VEVENT". It's
+	// empty outside of components.
+	Component string
+	Err       error
+}
+
+func (err *ContentError) Error() string {
+	switch {
+	case err.Line > 0 && err.Component != "":
+		return fmt.Sprintf("line %v, in %v: %v", err.Line, err.Component, err.Err)
+	case err.Line > 0:
+		return fmt.Sprintf("line %v: %v", err.Line, err.Err)
+	default:
+		return err.Err.Error()
+	}
+}
+
+func (err *ContentError) Unwrap() error {
+	return err.Err
+}
+
+// CheckContentSyntax checks the syntax of a single iCalendar or vCard object,
+// as defined in RFC 5545 section 3.1 and RFC 6350 section 3.3. Each content
+// line must have a name and a value, quoted parameter values must be
+// terminated, BEGIN and END lines must match, and nothing but empty lines may
+// follow the object.
+//
+// The first error is returned as a *ContentError.
+func CheckContentSyntax(data []byte) error {
+	var (
+		stack   []string
+		ended   bool
+		lineNum int
+	)
+	newErr := func(start int, format string, v ...interface{}) error {
+		var comp string
+		if len(stack) > 0 {
+			comp = stack[len(stack)-1]
+		}
+		return &ContentError{Line: start, Component: comp, Err: fmt.Errorf(format, v...)}
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	var line string
+	start := 0
+	checkLine := func() error {
+		if line == "" {
+			return nil
+		}
+		if ended {
+			return newErr(start, "unexpected content after the end of the object")
+		}
+		name, value, err := splitContentLine(line)
+		if err != nil {
+			return newErr(start, "%v", err)
+		}
+		switch {
+		case len(stack) == 0 && !strings.EqualFold(name, "BEGIN"):
+			return newErr(start, "expected BEGIN, got %q", name)
+		case strings.EqualFold(name, "BEGIN"):
+			if value == "" {
+				return newErr(start, "missing component name in BEGIN")
+			}
+			stack = append(stack, strings.ToUpper(value))
+		case strings.EqualFold(name, "END"):
+			if want := stack[len(stack)-1]; !strings.EqualFold(value, want) {
+				return newErr(start, "expected END:%v, got END:%v", want, value)
+			}
+			stack = stack[:len(stack)-1]
+			ended = len(stack) == 0
+		}
+		return nil
+	}
+
+	for sc.Scan() {
+		lineNum++
+		l := strings.TrimSuffix(sc.Text(), "\r")
+		if len(l) > 0 && (l[0] == ' ' || l[0] == '\t') && line != "" {
+			line += l[1:]
+			continue
+		}
+		if err := checkLine(); err != nil {
+			return err
+		}
+		line, start = l, lineNum
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if err := checkLine(); err != nil {
+		return err
+	}
+
+	if !ended {
+		if len(stack) == 0 {
+			return &ContentError{Err: errors.New("empty object")}
+		}
+		return newErr(lineNum, "missing END:%v", stack[len(stack)-1])
+	}
+	return nil
+}
+
+// splitContentLine returns the name and the value of an unfolded content line.
+func splitContentLine(line string) (name, value string, err error) {
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return "", "", errors.New("malformed content line: missing colon")
+	}
+	name = line[:i]
+	if name == "" {
+		return "", "", errors.New("malformed content line: empty property name")
+	}
+	for _, c := range name {
+		if !isContentNameChar(c) {
+			return "", "", fmt.Errorf("malformed content line: invalid character %q in property name", c)
+		}
+	}
+
+	// Skip parameters, whose quoted values may contain colons
+	quoted := false
+	for ; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == ':' && !quoted:
+			return name, line[i+1:], nil
+		}
+	}
+	if quoted {
+		return "", "", errors.New("malformed content line: unterminated quoted parameter value")
+	}
+	return "", "", errors.New("malformed content line: missing colon")
+}
+
+func isContentNameChar(c rune) bool {
+	// Dots separate vCard groups from property names
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return c == '-' || c == '.'
+}
+
+// ContentErrorName is the name of the element describing a ContentError in
+// DAV:error response bodies.
+var ContentErrorName = xml.Name{Space: BatchNamespace, Local: "content-error"}
+
+// contentError is the representation of a ContentError in DAV:error response
+// bodies.
+type contentError struct {
+	XMLName   xml.Name `xml:"https://github.com/emersion/go-webdav content-error"`
+	Line      int      `xml:"line,attr,omitempty"`
+	Component string   `xml:"component,attr,omitempty"`
+	Message   string   `xml:",chardata"`
+}
+
+// NewContentHTTPError returns an error reported to clients with the
+// precondition and a description of err, including its position if err is a
+// *ContentError.
+func NewContentHTTPError(code int, precondition xml.Name, err error) error {
+	elt := contentError{Message: err.Error()}
+	var contentErr *ContentError
+	if errors.As(err, &contentErr) {
+		elt = contentError{
+			Line:      contentErr.Line,
+			Component: contentErr.Component,
+			Message:   contentErr.Err.Error(),
+		}
+	}
+
+	raw, encErr := EncodeRawXMLElement(&elt)
+	if encErr != nil {
+		return &HTTPError{http.StatusInternalServerError, encErr}
+	}
+	return &HTTPError{
+		Code: code,
+		Err: &Error{
+			Raw: []RawXMLValue{*NewRawXMLElement(precondition, nil, nil), *raw},
+		},
+	}
+}
@@ -13,6 +13,10 @@ import (
 
 const Namespace = "DAV:"
 
+// CalendarServerNamespace is the namespace of properties defined by Apple's
+// CalendarServer.
+const CalendarServerNamespace = "http://calendarserver.org/ns/"
+
 var (
 	ResourceTypeName     = xml.Name{Namespace, "resourcetype"}
 	DisplayNameName      = xml.Name{Namespace, "displayname"}
@@ -21,11 +25,21 @@ var (
 	GetLastModifiedName  = xml.Name{Namespace, "getlastmodified"}
 	GetETagName          = xml.Name{Namespace, "getetag"}
 
+	HrefName       = xml.Name{Namespace, "href"}
 	CollectionName = xml.Name{Namespace, "collection"}
 	PrincipalName  = xml.Name{Namespace, "principal"}
 
 	CurrentUserPrincipalName    = xml.Name{Namespace, "current-user-principal"}
 	CurrentUserPrivilegeSetName = xml.Name{Namespace, "current-user-privilege-set"}
+	OwnerName                   = xml.Name{Namespace, "owner"}
+	GroupName                   = xml.Name{Namespace, "group"}
+
+	SupportedReportSetName = xml.Name{Namespace, "supported-report-set"}
+	AddMemberName          = xml.Name{Namespace, "add-member"}
+
+	PrincipalPropertySearchName = xml.Name{Namespace, "principal-property-search"}
+
+	GetCTagName = xml.Name{CalendarServerNamespace, "getctag"}
 )
 
 type Status struct {
@@ -124,11 +138,7 @@ func NewOKResponse(path string) *Response {
 }
 
 func NewErrorResponse(path string, err error) *Response {
-	code := http.StatusInternalServerError
-	var httpErr *HTTPError
-	if errors.As(err, &httpErr) {
-		code = httpErr.Code
-	}
+	code := StatusFromError(err)
 
 	var errElt *Error
 	errors.As(err, &errElt)
@@ -239,6 +249,26 @@ func (resp *Response) EncodeProp(code int, v interface{}) error {
 	return nil
 }
 
+// removeNotFoundPropStats drops the propstats with a 404 Not Found status. A
+// response needs either a status or at least one propstat, so an empty 200 OK
+// propstat is kept if nothing else is left.
+func (resp *Response) removeNotFoundPropStats() {
+	if len(resp.PropStats) == 0 {
+		return
+	}
+
+	propStats := resp.PropStats[:0]
+	for _, propstat := range resp.PropStats {
+		if propstat.Status.Code != http.StatusNotFound {
+			propStats = append(propStats, propstat)
+		}
+	}
+	if len(propStats) == 0 && resp.Status == nil {
+		propStats = append(propStats, PropStat{Status: Status{Code: http.StatusOK}})
+	}
+	resp.PropStats = propStats
+}
+
 // https://tools.ietf.org/html/rfc4918#section-14.9
 type Location struct {
 	XMLName xml.Name `xml:"DAV: location"`
@@ -305,6 +335,19 @@ type PropFind struct {
 	PropName *struct{} `xml:"propname,omitempty"`
 }
 
+// Includes reports whether a property is listed in the DAV:include element.
+func (pf *PropFind) Includes(name xml.Name) bool {
+	if pf.Include == nil {
+		return false
+	}
+	for _, raw := range pf.Include.Raw {
+		if n, ok := raw.XMLName(); ok && n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func xmlNamesToRaw(names []xml.Name) []RawXMLValue {
 	l := make([]RawXMLValue, len(names))
 	for i, name := range names {
@@ -342,6 +385,32 @@ func (t *ResourceType) Is(name xml.Name) bool {
 	return false
 }
 
+// https://tools.ietf.org/html/rfc3253#section-3.1.5
+type SupportedReportSet struct {
+	XMLName         xml.Name          `xml:"DAV: supported-report-set"`
+	SupportedReport []SupportedReport `xml:"supported-report"`
+}
+
+type SupportedReport struct {
+	XMLName xml.Name     `xml:"DAV: supported-report"`
+	Report  ReportDetail `xml:"report"`
+}
+
+type ReportDetail struct {
+	XMLName xml.Name      `xml:"DAV: report"`
+	Raw     []RawXMLValue `xml:",any"`
+}
+
+func NewSupportedReportSet(names ...xml.Name) *SupportedReportSet {
+	set := &SupportedReportSet{SupportedReport: make([]SupportedReport, 0, len(names))}
+	for _, name := range names {
+		set.SupportedReport = append(set.SupportedReport, SupportedReport{
+			Report: ReportDetail{Raw: xmlNamesToRaw([]xml.Name{name})},
+		})
+	}
+	return set
+}
+
 // https://tools.ietf.org/html/rfc4918#section-15.4
 type GetContentLength struct {
 	XMLName xml.Name `xml:"DAV: getcontentlength"`
@@ -382,12 +451,24 @@ type GetETag struct {
 	ETag    ETag     `xml:",chardata"`
 }
 
+// https://github.com/apple/ccs-calendarserver/blob/master/doc/Extensions/caldav-ctag.txt
+type GetCTag struct {
+	XMLName xml.Name `xml:"http://calendarserver.org/ns/ getctag"`
+	CTag    string   `xml:",chardata"`
+}
+
+// ETag is the opaque value of an entity-tag, without quotes.
 type ETag string
 
+// UnmarshalText parses an entity-tag. It's tolerant of servers sending weak
+// or unquoted entity-tags: the W/ prefix and quotes are removed.
 func (etag *ETag) UnmarshalText(b []byte) error {
-	s, err := strconv.Unquote(string(b))
-	if err != nil {
-		return fmt.Errorf("webdav: failed to unquote ETag: %v", err)
+	s := strings.TrimPrefix(strings.TrimSpace(string(b)), "W/")
+	if strings.HasPrefix(s, `"`) {
+		if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+			return fmt.Errorf("webdav: malformed ETag %q", string(b))
+		}
+		s = s[1 : len(s)-1]
 	}
 	*etag = ETag(s)
 	return nil
@@ -397,8 +478,36 @@ func (etag ETag) MarshalText() ([]byte, error) {
 	return []byte(etag.String()), nil
 }
 
+// String formats the ETag as a quoted strong entity-tag, as sent in the
+// ETag header and in the getetag property.
 func (etag ETag) String() string {
-	return fmt.Sprintf("%q", string(etag))
+	return `"` + NormalizeETag(string(etag)) + `"`
+}
+
+// NormalizeETag returns the opaque value of an entity-tag as sent to
+// clients. Quotes added by backends are removed, and characters which aren't
+// allowed in entity-tags, such as spaces, are percent-encoded, as defined in
+// RFC 7232 section 2.3.
+func NormalizeETag(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		s = s[1 : len(s)-1]
+	}
+	if !strings.ContainsFunc(s, isInvalidETagChar) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; isInvalidETagChar(rune(c)) {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func isInvalidETagChar(c rune) bool {
+	return c <= ' ' || c == '"' || c == 0x7F
 }
 
 // https://tools.ietf.org/html/rfc4918#section-14.5
@@ -425,6 +534,40 @@ type CurrentUserPrincipal struct {
 	Unauthenticated *struct{} `xml:"unauthenticated,omitempty"`
 }
 
+// https://tools.ietf.org/html/rfc3744#section-5.1
+type Owner struct {
+	XMLName xml.Name `xml:"DAV: owner"`
+	Href    *Href    `xml:"href,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-5.2
+type Group struct {
+	XMLName xml.Name `xml:"DAV: group"`
+	Href    *Href    `xml:"href,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc5995#section-3.2.1
+type AddMember struct {
+	XMLName xml.Name `xml:"DAV: add-member"`
+	Href    Href     `xml:"href"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-9.4
+type PrincipalPropertySearch struct {
+	XMLName                       xml.Name         `xml:"DAV: principal-property-search"`
+	Test                          string           `xml:"test,attr,omitempty"`
+	PropertySearch                []PropertySearch `xml:"property-search"`
+	Prop                          *Prop            `xml:"prop,omitempty"`
+	ApplyToPrincipalCollectionSet *struct{}        `xml:"apply-to-principal-collection-set,omitempty"`
+}
+
+// https://tools.ietf.org/html/rfc3744#section-9.4
+type PropertySearch struct {
+	XMLName xml.Name `xml:"DAV: property-search"`
+	Prop    Prop     `xml:"prop"`
+	Match   string   `xml:"match"`
+}
+
 // https://tools.ietf.org/html/rfc4918#section-14.19
 type PropertyUpdate struct {
 	XMLName xml.Name `xml:"DAV: propertyupdate"`
@@ -43,6 +43,41 @@ func TestResponse_Err_error(t *testing.T) {
 	}
 }
 
+func TestETag(t *testing.T) {
+	for _, tc := range []struct {
+		etag, want string
+	}{
+		{"1", `"1"`},
+		{`"1"`, `"1"`},
+		{"a b", `"a%20b"`},
+		{`a"b`, `"a%22b"`},
+	} {
+		if got := ETag(tc.etag).String(); got != tc.want {
+			t.Errorf("ETag(%q).String() = %q, want %q", tc.etag, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		text, want string
+	}{
+		{`"1"`, "1"},
+		{`W/"1"`, "1"},
+		{`1`, "1"},
+		{` "1" `, "1"},
+	} {
+		var etag ETag
+		if err := etag.UnmarshalText([]byte(tc.text)); err != nil {
+			t.Errorf("ETag.UnmarshalText(%q) = %v", tc.text, err)
+		} else if string(etag) != tc.want {
+			t.Errorf("ETag.UnmarshalText(%q) = %q, want %q", tc.text, etag, tc.want)
+		}
+	}
+	var etag ETag
+	if err := etag.UnmarshalText([]byte(`"1`)); err == nil {
+		t.Errorf("ETag.UnmarshalText(%q): expected an error", `"1`)
+	}
+}
+
 func TestTimeRoundTrip(t *testing.T) {
 	now := Time(time.Now().UTC())
 	want, err := now.MarshalText()
@@ -2,10 +2,14 @@
 package internal
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"net/url"
+	"strings"
+	"syscall"
 )
 
 // Depth indicates whether a request applies to the resource's members. It's
@@ -36,6 +40,44 @@ func ParseDepth(s string) (Depth, error) {
 	return 0, fmt.Errorf("webdav: invalid Depth value")
 }
 
+// DefaultDepth returns the depth of a request without a Depth header. It's
+// infinity for PROPFIND, COPY, MOVE, DELETE and LOCK requests, as defined in
+// RFC 4918, and zero for other methods, including REPORT as defined in
+// RFC 3253 section 3.6.
+func DefaultDepth(method string) Depth {
+	switch method {
+	case "PROPFIND", "COPY", "MOVE", http.MethodDelete, "LOCK":
+		return DepthInfinity
+	}
+	return DepthZero
+}
+
+// ParseRequestDepth parses the Depth header of a request, falling back to
+// DefaultDepth if it's missing. Invalid values and values not allowed for the
+// method, e.g. "1" for COPY, are rejected with 400 Bad Request.
+func ParseRequestDepth(r *http.Request) (Depth, error) {
+	s := r.Header.Get("Depth")
+	if s == "" {
+		return DefaultDepth(r.Method), nil
+	}
+	depth, err := ParseDepth(s)
+	if err != nil {
+		return 0, &HTTPError{http.StatusBadRequest, err}
+	}
+
+	switch r.Method {
+	case "COPY", "LOCK":
+		if depth == DepthOne {
+			return 0, HTTPErrorf(http.StatusBadRequest, `webdav: "Depth: 1" is not supported in %v request`, r.Method)
+		}
+	case "MOVE":
+		if depth != DepthInfinity {
+			return 0, HTTPErrorf(http.StatusBadRequest, `webdav: only "Depth: infinity" is accepted in %v request`, r.Method)
+		}
+	}
+	return depth, nil
+}
+
 // String formats the depth.
 func (d Depth) String() string {
 	switch d {
@@ -57,7 +99,39 @@ func ParseOverwrite(s string) (bool, error) {
 	case "F":
 		return false, nil
 	}
-	return false, fmt.Errorf("webdav: invalid Overwrite value")
+	return false, fmt.Errorf("webdav: invalid Overwrite value %q", s)
+}
+
+// ParseRequestOverwrite parses the Overwrite header of a request, defaulting
+// to true if it's missing, as defined in RFC 4918 section 10.6. Invalid
+// values are rejected with 400 Bad Request.
+func ParseRequestOverwrite(r *http.Request) (bool, error) {
+	s := r.Header.Get("Overwrite")
+	if s == "" {
+		return true, nil
+	}
+	overwrite, err := ParseOverwrite(s)
+	if err != nil {
+		return false, &HTTPError{http.StatusBadRequest, err}
+	}
+	return overwrite, nil
+}
+
+// RequestPathPrefix returns the prefix stripped from the path of the request
+// URI before serving a request, e.g. by webdav.StripPrefix. Hrefs sent to the
+// client must include it.
+func RequestPathPrefix(r *http.Request) string {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+	if r.URL.Path == "/" && !strings.HasSuffix(u.Path, "/") {
+		// The prefix itself was requested, e.g. "/dav" for "/dav/"
+		return u.Path
+	} else if !strings.HasSuffix(u.Path, r.URL.Path) {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, r.URL.Path)
 }
 
 // FormatOverwrite formats an Overwrite header.
@@ -74,23 +148,48 @@ type HTTPError struct {
 	Err  error
 }
 
+// ErrPreconditionFailed matches HTTPErrors with a 412 Precondition Failed
+// status code.
+var ErrPreconditionFailed = errors.New("webdav: precondition failed")
+
 func HTTPErrorFromError(err error) *HTTPError {
 	if err == nil {
 		return nil
 	}
-	if httpErr, ok := err.(*HTTPError); ok {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
 		return httpErr
 	} else {
-		return &HTTPError{http.StatusInternalServerError, err}
+		return &HTTPError{StatusFromError(err), err}
 	}
 }
 
-func IsNotFound(err error) bool {
+// StatusFromError returns the HTTP status code for an error. The code of an
+// HTTPError takes precedence. Common errors returned by the standard library
+// are mapped to a matching status, and other errors to 500 Internal Server
+// Error.
+func StatusFromError(err error) int {
 	var httpErr *HTTPError
-	if errors.As(err, &httpErr) {
-		return httpErr.Code == http.StatusNotFound
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.Code
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
 	}
-	return false
+}
+
+func IsNotFound(err error) bool {
+	return err != nil && StatusFromError(err) == http.StatusNotFound
 }
 
 func HTTPErrorf(code int, format string, a ...interface{}) *HTTPError {
@@ -110,6 +209,10 @@ func (err *HTTPError) Unwrap() error {
 	return err.Err
 }
 
+func (err *HTTPError) Is(target error) bool {
+	return target == ErrPreconditionFailed && err.Code == http.StatusPreconditionFailed
+}
+
 type HrefError struct {
 	Href url.URL
 	Err  error
@@ -122,3 +225,19 @@ func (err *HrefError) Error() string {
 func (err *HrefError) Unwrap() error {
 	return err.Err
 }
+
+// MultiStatusError is an error which is reported to the client with a 207
+// Multi-Status response, e.g. when an operation on a collection has only been
+// partially applied.
+type MultiStatusError struct {
+	MultiStatus *MultiStatus
+	Err         error
+}
+
+func (err *MultiStatusError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *MultiStatusError) Unwrap() error {
+	return err.Err
+}
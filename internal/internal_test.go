@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestStatusFromError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{HTTPErrorf(http.StatusConflict, "conflict"), http.StatusConflict},
+		{fmt.Errorf("wrapped: %w", HTTPErrorf(http.StatusTeapot, "teapot")), http.StatusTeapot},
+		{&fs.PathError{Op: "stat", Path: "/x", Err: fs.ErrNotExist}, http.StatusNotFound},
+		{os.ErrPermission, http.StatusForbidden},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{&fs.PathError{Op: "write", Path: "/x", Err: syscall.ENOSPC}, http.StatusInsufficientStorage},
+		{fmt.Errorf("unknown"), http.StatusInternalServerError},
+	} {
+		if got := StatusFromError(tc.err); got != tc.want {
+			t.Errorf("StatusFromError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCheckContentSyntax(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		data      string
+		line      int
+		component string
+	}{
+		{"valid", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY;X-P=\"a:b\":Folded\r\n  line\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n\r\n", 0, ""},
+		{"missing-colon", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n", 3, "VEVENT"},
+		{"folded", "BEGIN:VCARD\r\nFN:Alice\r\n Smith\r\nNOTE;X-P=\"unterminated:\r\nEND:VCARD\r\n", 4, "VCARD"},
+		{"mismatched-end", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VTODO\r\nEND:VCALENDAR\r\n", 3, "VEVENT"},
+		{"missing-end", "BEGIN:VCARD\nFN:Alice\n", 2, "VCARD"},
+		{"trailing", "BEGIN:VCARD\nEND:VCARD\nFN:Alice\n", 3, ""},
+		{"missing-begin", "FN:Alice\n", 1, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckContentSyntax([]byte(tc.data))
+			if tc.line == 0 {
+				if err != nil {
+					t.Fatalf("CheckContentSyntax() = %v", err)
+				}
+				return
+			}
+			contentErr, ok := err.(*ContentError)
+			if !ok {
+				t.Fatalf("CheckContentSyntax() = %v, want a *ContentError", err)
+			}
+			if contentErr.Line != tc.line || contentErr.Component != tc.component {
+				t.Errorf("got error at line %v in %q, want line %v in %q", contentErr.Line, contentErr.Component, tc.line, tc.component)
+			}
+		})
+	}
+}
+
+func TestParseRequestDepth(t *testing.T) {
+	for _, tc := range []struct {
+		method, depth string
+		want          Depth
+		status        int
+	}{
+		{"PROPFIND", "", DepthInfinity, 0},
+		{"PROPFIND", "1", DepthOne, 0},
+		{"REPORT", "", DepthZero, 0},
+		{"COPY", "", DepthInfinity, 0},
+		{"COPY", "0", DepthZero, 0},
+		{"COPY", "1", 0, http.StatusBadRequest},
+		{"MOVE", "", DepthInfinity, 0},
+		{"MOVE", "0", 0, http.StatusBadRequest},
+		{http.MethodDelete, "", DepthInfinity, 0},
+		{http.MethodDelete, "0", DepthZero, 0},
+		{"PROPFIND", "2", 0, http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest(tc.method, "/", nil)
+		if tc.depth != "" {
+			req.Header.Set("Depth", tc.depth)
+		}
+		depth, err := ParseRequestDepth(req)
+		if tc.status != 0 {
+			if got := StatusFromError(err); got != tc.status {
+				t.Errorf("%v with Depth %q: got status %v, want %v", tc.method, tc.depth, got, tc.status)
+			}
+		} else if err != nil || depth != tc.want {
+			t.Errorf("%v with Depth %q: got %v, %v, want %v", tc.method, tc.depth, depth, err, tc.want)
+		}
+	}
+}
+
+func TestParseRequestOverwrite(t *testing.T) {
+	for _, tc := range []struct {
+		overwrite string
+		want      bool
+		status    int
+	}{
+		{"", true, 0},
+		{"T", true, 0},
+		{"F", false, 0},
+		{"yes", false, http.StatusBadRequest},
+		{"t", false, http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest("COPY", "/", nil)
+		if tc.overwrite != "" {
+			req.Header.Set("Overwrite", tc.overwrite)
+		}
+		overwrite, err := ParseRequestOverwrite(req)
+		if tc.status != 0 {
+			if got := StatusFromError(err); got != tc.status {
+				t.Errorf("Overwrite %q: got status %v, want %v", tc.overwrite, got, tc.status)
+			}
+		} else if err != nil || overwrite != tc.want {
+			t.Errorf("Overwrite %q: got %v, %v, want %v", tc.overwrite, overwrite, err, tc.want)
+		}
+	}
+}
+
+func TestFoldCollation(t *testing.T) {
+	for _, tc := range []struct {
+		collation, a, b string
+		equal           bool
+	}{
+		{"", "Alice", "ALICE", true},
+		{CollationASCIICasemap, "Alice", "ALICE", true},
+		{CollationASCIICasemap, "été", "ÉTÉ", false},
+		{CollationUnicodeCasemap, "été", "ÉTÉ", true},
+		{CollationOctet, "Alice", "ALICE", false},
+		{CollationOctet, "Alice", "Alice", true},
+	} {
+		equal := FoldCollation(tc.collation, tc.a) == FoldCollation(tc.collation, tc.b)
+		if equal != tc.equal {
+			t.Errorf("FoldCollation(%q): got %q == %q: %v, want %v", tc.collation, tc.a, tc.b, equal, tc.equal)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// DefaultNamespacePrefixes maps XML namespaces to the prefixes used in
+// responses. Some clients only parse responses using these conventional
+// prefixes.
+var DefaultNamespacePrefixes = map[string]string{
+	Namespace:                        "D",
+	"urn:ietf:params:xml:ns:caldav":  "C",
+	"urn:ietf:params:xml:ns:carddav": "CARD",
+}
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// XMLEncoder writes XML responses.
+type XMLEncoder struct {
+	w        io.Writer
+	prefixes map[string]string
+}
+
+// prefix returns the prefix of a namespace, or an empty string if elements of
+// this namespace should use a default namespace declaration.
+func (enc *XMLEncoder) prefix(ns string) string {
+	if p, ok := enc.prefixes[ns]; ok {
+		return p
+	}
+	return DefaultNamespacePrefixes[ns]
+}
+
+// Encode writes the XML encoding of v.
+func (enc *XMLEncoder) Encode(v interface{}) error {
+	// encoding/xml doesn't support namespace prefixes, so we re-encode its
+	// output
+	var buf bytes.Buffer
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+
+	var toks []xml.Token
+	declared := make(map[string]string)
+	dec := xml.NewDecoder(&buf)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		tok = xml.CopyToken(tok)
+		toks = append(toks, tok)
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if p := enc.prefix(start.Name.Space); p != "" {
+			declared[start.Name.Space] = p
+		}
+		for _, attr := range start.Attr {
+			ns := attr.Name.Space
+			if ns == "" || ns == xmlNamespace || isNamespaceAttr(attr) {
+				continue
+			}
+			if _, ok := declared[ns]; ok {
+				continue
+			}
+			p := enc.prefix(ns)
+			if p == "" {
+				p = fmt.Sprintf("ns%v", len(declared))
+			}
+			declared[ns] = p
+		}
+	}
+
+	out := xml.NewEncoder(enc.w)
+	var names []xml.Name
+	defaults := []string{""}
+	for _, tok := range toks {
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			def := defaults[len(defaults)-1]
+			start := xml.StartElement{Name: xml.Name{Local: tok.Name.Local}}
+			if p, ok := declared[tok.Name.Space]; ok {
+				start.Name.Local = p + ":" + tok.Name.Local
+			} else if tok.Name.Space != def {
+				def = tok.Name.Space
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: def})
+			}
+			if len(names) == 0 {
+				start.Attr = append(start.Attr, namespaceDecls(declared)...)
+			}
+			for _, attr := range tok.Attr {
+				switch {
+				case isNamespaceAttr(attr):
+					continue
+				case attr.Name.Space == xmlNamespace:
+					attr.Name = xml.Name{Local: "xml:" + attr.Name.Local}
+				case attr.Name.Space != "":
+					attr.Name = xml.Name{Local: declared[attr.Name.Space] + ":" + attr.Name.Local}
+				}
+				start.Attr = append(start.Attr, attr)
+			}
+
+			if err := out.EncodeToken(start); err != nil {
+				return err
+			}
+			names = append(names, start.Name)
+			defaults = append(defaults, def)
+		case xml.EndElement:
+			name := names[len(names)-1]
+			names = names[:len(names)-1]
+			defaults = defaults[:len(defaults)-1]
+			if err := out.EncodeToken(xml.EndElement{Name: name}); err != nil {
+				return err
+			}
+		default:
+			if err := out.EncodeToken(tok); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Flush()
+}
+
+func isNamespaceAttr(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+}
+
+func namespaceDecls(declared map[string]string) []xml.Attr {
+	attrs := make([]xml.Attr, 0, len(declared))
+	for ns, p := range declared {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "xmlns:" + p}, Value: ns})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+	return attrs
+}
+
+// prefixResponseWriter carries the namespace prefixes of a Handler to
+// ServeXML.
+type prefixResponseWriter struct {
+	http.ResponseWriter
+	prefixes map[string]string
+}
+
+func (w *prefixResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -12,16 +12,17 @@ import (
 )
 
 func ServeError(w http.ResponseWriter, err error) {
-	code := http.StatusInternalServerError
-	var httpErr *HTTPError
-	if errors.As(err, &httpErr) {
-		code = httpErr.Code
+	var msErr *MultiStatusError
+	if errors.As(err, &msErr) {
+		ServeMultiStatus(w, msErr.MultiStatus)
+		return
 	}
 
+	code := StatusFromError(err)
+
 	var errElt *Error
 	if errors.As(err, &errElt) {
-		w.WriteHeader(code)
-		ServeXML(w).Encode(errElt)
+		ServeXML(w, code).Encode(errElt)
 		return
 	}
 
@@ -34,50 +35,250 @@ func isContentXML(h http.Header) bool {
 }
 
 func DecodeXMLRequest(r *http.Request, v interface{}) error {
+	return DecodeXMLRequestWithLimits(r, v, nil)
+}
+
+// XMLElementLimit limits the elements of an XML request body, see
+// DecodeXMLRequestWithLimits.
+type XMLElementLimit struct {
+	Name xml.Name
+	// Parent, if set, restricts the limit to elements which are children of
+	// a Parent element.
+	Parent xml.Name
+	// MaxCount limits the number of elements. Zero means no limit.
+	MaxCount int
+	// MaxDepth limits the nesting depth of elements, e.g. an element nested
+	// in another one with the same name has a depth of 2. Zero means no
+	// limit.
+	MaxDepth int
+	// Err is returned when a limit is exceeded.
+	Err error
+}
+
+// DecodeXMLRequestWithLimits is like DecodeXMLRequest, but the limits are
+// enforced while the body is decoded, so that requests exceeding them are
+// rejected before being parsed completely.
+func DecodeXMLRequestWithLimits(r *http.Request, v interface{}, limits []XMLElementLimit) error {
 	if !isContentXML(r.Header) {
 		return HTTPErrorf(http.StatusBadRequest, "webdav: expected application/xml request")
 	}
 
-	if err := xml.NewDecoder(r.Body).Decode(v); err != nil {
+	dec := xml.NewDecoder(r.Body)
+	if len(limits) > 0 {
+		dec = xml.NewTokenDecoder(&limitTokenReader{
+			tr:     dec,
+			limits: limits,
+			counts: make([]int, len(limits)),
+			depths: make([]int, len(limits)),
+		})
+	}
+	if err := dec.Decode(v); err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			return err
+		}
 		return &HTTPError{http.StatusBadRequest, err}
 	}
 	return nil
 }
 
+// limitTokenReader enforces XMLElementLimits on the tokens of a reader.
+type limitTokenReader struct {
+	tr     xml.TokenReader
+	limits []XMLElementLimit
+	stack  []xml.Name
+	counts []int
+	depths []int
+}
+
+func (lr *limitTokenReader) parent() xml.Name {
+	if len(lr.stack) == 0 {
+		return xml.Name{}
+	}
+	return lr.stack[len(lr.stack)-1]
+}
+
+func (lr *limitTokenReader) matches(l *XMLElementLimit, name xml.Name) bool {
+	return name == l.Name && (l.Parent == xml.Name{} || l.Parent == lr.parent())
+}
+
+func (lr *limitTokenReader) Token() (xml.Token, error) {
+	tok, err := lr.tr.Token()
+	if err != nil {
+		return tok, err
+	}
+
+	switch tok := tok.(type) {
+	case xml.StartElement:
+		for i := range lr.limits {
+			l := &lr.limits[i]
+			if !lr.matches(l, tok.Name) {
+				continue
+			}
+			lr.counts[i]++
+			lr.depths[i]++
+			if (l.MaxCount > 0 && lr.counts[i] > l.MaxCount) || (l.MaxDepth > 0 && lr.depths[i] > l.MaxDepth) {
+				return nil, l.Err
+			}
+		}
+		lr.stack = append(lr.stack, tok.Name)
+	case xml.EndElement:
+		// The underlying decoder rejects unbalanced end elements
+		lr.stack = lr.stack[:len(lr.stack)-1]
+		for i := range lr.limits {
+			if lr.matches(&lr.limits[i], tok.Name) {
+				lr.depths[i]--
+			}
+		}
+	}
+	return tok, nil
+}
+
 func IsRequestBodyEmpty(r *http.Request) bool {
 	_, err := r.Body.Read(nil)
 	return err == io.EOF
 }
 
-func ServeXML(w http.ResponseWriter) *xml.Encoder {
+func ServeXML(w http.ResponseWriter, code int) *XMLEncoder {
 	w.Header().Add("Content-Type", "application/xml; charset=\"utf-8\"")
+	w.WriteHeader(code)
 	w.Write([]byte(xml.Header))
-	return xml.NewEncoder(w)
+	enc := &XMLEncoder{w: w}
+	if pw, ok := w.(*prefixResponseWriter); ok {
+		enc.prefixes = pw.prefixes
+	}
+	return enc
 }
 
 func ServeMultiStatus(w http.ResponseWriter, ms *MultiStatus) error {
 	// TODO: streaming
-	w.WriteHeader(http.StatusMultiStatus)
-	return ServeXML(w).Encode(ms)
+	return ServeXML(w, http.StatusMultiStatus).Encode(ms)
+}
+
+// PreferMinimal checks whether the client asked for a minimal response via the
+// "Prefer: return=minimal" header defined in RFC 7240 and RFC 8144.
+func PreferMinimal(h http.Header) bool {
+	for _, v := range h.Values("Prefer") {
+		for _, pref := range strings.Split(v, ",") {
+			if i := strings.IndexByte(pref, ';'); i >= 0 {
+				pref = pref[:i]
+			}
+			k, v, _ := strings.Cut(pref, "=")
+			k = strings.TrimSpace(k)
+			v = strings.Trim(strings.TrimSpace(v), `"`)
+			if strings.EqualFold(k, "return") && strings.EqualFold(v, "minimal") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
+// isBrief checks for the legacy "Brief: t" header sent by Microsoft clients,
+// which predates "Prefer: return=minimal".
+func isBrief(h http.Header) bool {
+	return strings.EqualFold(strings.TrimSpace(h.Get("Brief")), "t")
+}
+
+// ServePropFindMultiStatus is like ServeMultiStatus, but omits the 404 Not
+// Found propstats from the response if the client asked for a minimal
+// response, either via "Prefer: return=minimal" or "Brief: t".
+func ServePropFindMultiStatus(w http.ResponseWriter, r *http.Request, ms *MultiStatus) error {
+	preferMinimal := PreferMinimal(r.Header)
+	if preferMinimal || isBrief(r.Header) {
+		for i := range ms.Responses {
+			ms.Responses[i].removeNotFoundPropStats()
+		}
+	}
+	if preferMinimal {
+		w.Header().Set("Preference-Applied", "return=minimal")
+	}
+	return ServeMultiStatus(w, ms)
+}
+
+// Backend is the core interface implemented by WebDAV backends. Other methods
+// are optional: requests for methods whose interface isn't implemented are
+// rejected with 405 Method Not Allowed.
 type Backend interface {
 	Options(r *http.Request) (caps []string, allow []string, err error)
 	HeadGet(w http.ResponseWriter, r *http.Request) error
 	PropFind(r *http.Request, pf *PropFind, depth Depth) (*MultiStatus, error)
+}
+
+// PropPatcher is an optional interface a Backend can implement to handle
+// PROPPATCH requests.
+type PropPatcher interface {
 	PropPatch(r *http.Request, pu *PropertyUpdate) (*Response, error)
+}
+
+// Putter is an optional interface a Backend can implement to handle PUT
+// requests.
+type Putter interface {
 	Put(w http.ResponseWriter, r *http.Request) error
+}
+
+// Poster is an optional interface a Backend can implement to handle POST
+// requests, e.g. to add members to collections as defined in RFC 5995.
+type Poster interface {
+	Post(w http.ResponseWriter, r *http.Request) error
+}
+
+// Deleter is an optional interface a Backend can implement to handle DELETE
+// requests. Deleters also handle batch-delete REPORT requests, by calling
+// Delete once per member.
+type Deleter interface {
 	Delete(r *http.Request) error
+}
+
+// Mkcoller is an optional interface a Backend can implement to handle MKCOL
+// requests.
+type Mkcoller interface {
 	Mkcol(r *http.Request) error
-	Copy(r *http.Request, dest *Href, recursive, overwrite bool) (created bool, err error)
-	Move(r *http.Request, dest *Href, overwrite bool) (created bool, err error)
+}
+
+// Copier is an optional interface a Backend can implement to handle COPY
+// requests.
+type Copier interface {
+	Copy(w http.ResponseWriter, r *http.Request, dest *Href, recursive, overwrite bool) (created bool, err error)
+}
+
+// Mover is an optional interface a Backend can implement to handle MOVE
+// requests.
+type Mover interface {
+	Move(w http.ResponseWriter, r *http.Request, dest *Href, overwrite bool) (created bool, err error)
+}
+
+// Reporter is an optional interface a Backend can implement to handle REPORT
+// requests, defined in RFC 3253 section 3.6.
+type Reporter interface {
+	// SupportedReports returns the names of the reports supported by the
+	// resource at path. They are advertised in the Allow header of OPTIONS
+	// responses, and backends should include them in the
+	// DAV:supported-report-set property.
+	SupportedReports(path string) []xml.Name
+	// Report handles a REPORT request. The depth defaults to zero if the
+	// request has no Depth header, as defined in RFC 3253 section 3.6.
+	Report(w http.ResponseWriter, r *http.Request, depth Depth) error
 }
 
 type Handler struct {
 	Backend Backend
+	// NamespacePrefixes overrides DefaultNamespacePrefixes. An empty prefix
+	// disables the prefix of a namespace.
+	NamespacePrefixes map[string]string
+	// Authorize, if set, is called before each member of a batch-delete
+	// REPORT is deleted, with the DELETE method and the member's path.
+	// Members it rejects are reported with the error in the response.
+	Authorize func(r *http.Request, method, path string) error
 }
 
+var errMethodNotAllowed = HTTPErrorf(http.StatusMethodNotAllowed, "webdav: unsupported method")
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.NamespacePrefixes != nil {
+		w = &prefixResponseWriter{w, h.NamespacePrefixes}
+	}
+
 	var err error
 	if h.Backend == nil {
 		err = fmt.Errorf("webdav: no backend available")
@@ -88,26 +289,46 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodGet, http.MethodHead:
 			err = h.Backend.HeadGet(w, r)
 		case http.MethodPut:
-			err = h.Backend.Put(w, r)
+			if putter, ok := h.Backend.(Putter); ok {
+				err = putter.Put(w, r)
+			} else {
+				err = errMethodNotAllowed
+			}
 		case http.MethodDelete:
-			// TODO: send a multistatus in case of partial failure
-			err = h.Backend.Delete(r)
-			if err == nil {
-				w.WriteHeader(http.StatusNoContent)
+			if deleter, ok := h.Backend.(Deleter); !ok {
+				err = errMethodNotAllowed
+			} else if _, err = ParseRequestDepth(r); err == nil {
+				// TODO: send a multistatus in case of partial failure
+				err = deleter.Delete(r)
+				if err == nil {
+					w.WriteHeader(http.StatusNoContent)
+				}
 			}
 		case "PROPFIND":
 			err = h.handlePropfind(w, r)
 		case "PROPPATCH":
 			err = h.handleProppatch(w, r)
+		case http.MethodPost:
+			if poster, ok := h.Backend.(Poster); ok {
+				err = poster.Post(w, r)
+			} else {
+				err = errMethodNotAllowed
+			}
 		case "MKCOL":
-			err = h.Backend.Mkcol(r)
-			if err == nil {
-				w.WriteHeader(http.StatusCreated)
+			if mkcoller, ok := h.Backend.(Mkcoller); ok {
+				err = mkcoller.Mkcol(r)
+				if err == nil {
+					w.WriteHeader(http.StatusCreated)
+				}
+			} else {
+				err = errMethodNotAllowed
 			}
 		case "COPY", "MOVE":
 			err = h.handleCopyMove(w, r)
+		case "REPORT":
+			err = h.handleReport(w, r)
 		default:
-			err = HTTPErrorf(http.StatusMethodNotAllowed, "webdav: unsupported method")
+			err = errMethodNotAllowed
 		}
 	}
 
@@ -123,12 +344,25 @@ func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) error {
 	}
 	caps = append([]string{"1", "3"}, caps...)
 
+	if !containsString(allow, "REPORT") && h.supportsReport(r.URL.Path, allow) {
+		allow = append(allow, "REPORT")
+	}
+
 	w.Header().Add("DAV", strings.Join(caps, ", "))
 	w.Header().Add("Allow", strings.Join(allow, ", "))
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) error {
 	var propfind PropFind
 	if IsRequestBodyEmpty(r) {
@@ -143,13 +377,9 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) error {
 		return HTTPErrorf(http.StatusBadRequest, "webdav: unsupported request body")
 	}
 
-	depth := DepthInfinity
-	if s := r.Header.Get("Depth"); s != "" {
-		var err error
-		depth, err = ParseDepth(s)
-		if err != nil {
-			return &HTTPError{http.StatusBadRequest, err}
-		}
+	depth, err := ParseRequestDepth(r)
+	if err != nil {
+		return err
 	}
 
 	ms, err := h.Backend.PropFind(r, &propfind, depth)
@@ -157,7 +387,7 @@ func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	return ServeMultiStatus(w, ms)
+	return ServePropFindMultiStatus(w, r, ms)
 }
 
 type PropFindFunc func(raw *RawXMLValue) (interface{}, error)
@@ -168,6 +398,20 @@ func PropFindValue(value interface{}) PropFindFunc {
 	}
 }
 
+// allPropExcluded lists the properties which are only returned for allprop
+// requests if the client asks for them with a DAV:include element, as
+// defined in RFC 4918 section 9.1.
+var allPropExcluded = []xml.Name{SupportedReportSetName, OwnerName, GroupName}
+
+func isAllPropExcluded(name xml.Name) bool {
+	for _, n := range allPropExcluded {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func NewPropFindResponse(path string, propfind *PropFind, props map[xml.Name]PropFindFunc) (*Response, error) {
 	resp := &Response{Hrefs: []Href{Href{Path: path}}}
 
@@ -183,8 +427,11 @@ func NewPropFindResponse(path string, propfind *PropFind, props map[xml.Name]Pro
 			}
 		}
 	} else if propfind.AllProp != nil {
-		// TODO: add support for propfind.Include
 		for xmlName, f := range props {
+			if isAllPropExcluded(xmlName) && !propfind.Includes(xmlName) {
+				continue
+			}
+
 			emptyVal := NewRawXMLElement(xmlName, nil, nil)
 
 			val, err := f(emptyVal)
@@ -235,13 +482,52 @@ func NewPropFindResponse(path string, propfind *PropFind, props map[xml.Name]Pro
 	return resp, nil
 }
 
+// supportsReport checks whether REPORT requests are accepted for the resource
+// at path. Batch-delete reports are supported if DELETE is allowed.
+func (h *Handler) supportsReport(path string, allow []string) bool {
+	if _, ok := h.Backend.(Deleter); ok && containsString(allow, http.MethodDelete) {
+		return true
+	}
+	reporter, ok := h.Backend.(Reporter)
+	return ok && len(reporter.SupportedReports(path)) > 0
+}
+
+func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request) error {
+	if deleter, ok := h.Backend.(Deleter); ok {
+		name, err := peekReportName(r)
+		if err != nil {
+			return err
+		}
+		if name == BatchDeleteName {
+			return h.handleBatchDelete(w, r, deleter)
+		}
+	}
+
+	reporter, ok := h.Backend.(Reporter)
+	if !ok {
+		return errMethodNotAllowed
+	}
+
+	depth, err := ParseRequestDepth(r)
+	if err != nil {
+		return err
+	}
+
+	return reporter.Report(w, r, depth)
+}
+
 func (h *Handler) handleProppatch(w http.ResponseWriter, r *http.Request) error {
+	propPatcher, ok := h.Backend.(PropPatcher)
+	if !ok {
+		return errMethodNotAllowed
+	}
+
 	var update PropertyUpdate
 	if err := DecodeXMLRequest(r, &update); err != nil {
 		return err
 	}
 
-	resp, err := h.Backend.PropPatch(r, &update)
+	resp, err := propPatcher.PropPatch(r, &update)
 	if err != nil {
 		return err
 	}
@@ -263,45 +549,32 @@ func parseDestination(h http.Header) (*Href, error) {
 }
 
 func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) error {
+	copier, canCopy := h.Backend.(Copier)
+	mover, canMove := h.Backend.(Mover)
+	if (r.Method == "COPY" && !canCopy) || (r.Method == "MOVE" && !canMove) {
+		return errMethodNotAllowed
+	}
+
 	dest, err := parseDestination(r.Header)
 	if err != nil {
 		return err
 	}
 
-	overwrite := true
-	if s := r.Header.Get("Overwrite"); s != "" {
-		overwrite, err = ParseOverwrite(s)
-		if err != nil {
-			return err
-		}
+	overwrite, err := ParseRequestOverwrite(r)
+	if err != nil {
+		return err
 	}
 
-	depth := DepthInfinity
-	if s := r.Header.Get("Depth"); s != "" {
-		depth, err = ParseDepth(s)
-		if err != nil {
-			return err
-		}
+	depth, err := ParseRequestDepth(r)
+	if err != nil {
+		return err
 	}
 
 	var created bool
 	if r.Method == "COPY" {
-		var recursive bool
-		switch depth {
-		case DepthZero:
-			recursive = false
-		case DepthOne:
-			return HTTPErrorf(http.StatusBadRequest, `webdav: "Depth: 1" is not supported in COPY request`)
-		case DepthInfinity:
-			recursive = true
-		}
-
-		created, err = h.Backend.Copy(r, dest, recursive, overwrite)
+		created, err = copier.Copy(w, r, dest, depth == DepthInfinity, overwrite)
 	} else {
-		if depth != DepthInfinity {
-			return HTTPErrorf(http.StatusBadRequest, `webdav: only "Depth: infinity" is accepted in MOVE request`)
-		}
-		created, err = h.Backend.Move(r, dest, overwrite)
+		created, err = mover.Move(w, r, dest, overwrite)
 	}
 	if err != nil {
 		return err
@@ -314,3 +587,39 @@ func (h *Handler) handleCopyMove(w http.ResponseWriter, r *http.Request) error {
 	}
 	return nil
 }
+
+// FailPropPatchDependencies marks successful property updates as failed if
+// another update in the same request has failed, since PROPPATCH must be
+// applied atomically. It reports whether an update has failed.
+func FailPropPatchDependencies(resp *Response) bool {
+	failed := false
+	for _, propstat := range resp.PropStats {
+		if propstat.Status.Code/100 != 2 {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+	for i := range resp.PropStats {
+		if resp.PropStats[i].Status.Code/100 == 2 {
+			resp.PropStats[i].Status = Status{Code: http.StatusFailedDependency}
+		}
+	}
+	return true
+}
+
+var NumberOfMatchesWithinLimitsName = xml.Name{Space: "DAV:", Local: "number-of-matches-within-limits"}
+
+// NewNumberOfMatchesError creates an error with a 507 Insufficient Storage
+// status code, indicating that a request exceeds the number of results the
+// server is willing to return, as defined in RFC 5323 section 5.17.
+func NewNumberOfMatchesError() error {
+	return &HTTPError{
+		Code: http.StatusInsufficientStorage,
+		Err: &Error{
+			Raw: []RawXMLValue{*NewRawXMLElement(NumberOfMatchesWithinLimitsName, nil, nil)},
+		},
+	}
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readOnlyBackend only implements the core Backend interface.
+type readOnlyBackend struct{}
+
+func (readOnlyBackend) Options(r *http.Request) (caps []string, allow []string, err error) {
+	return nil, []string{http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND"}, nil
+}
+
+func (readOnlyBackend) HeadGet(w http.ResponseWriter, r *http.Request) error {
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (readOnlyBackend) PropFind(r *http.Request, pf *PropFind, depth Depth) (*MultiStatus, error) {
+	return NewMultiStatus(*NewOKResponse(r.URL.Path)), nil
+}
+
+func TestHandlerOptionalMethods(t *testing.T) {
+	h := Handler{Backend: readOnlyBackend{}}
+	for _, tc := range []struct {
+		method string
+		want   int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{"PROPFIND", http.StatusMultiStatus},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+		{"PROPPATCH", http.StatusMethodNotAllowed},
+		{"MKCOL", http.StatusMethodNotAllowed},
+		{"COPY", http.StatusMethodNotAllowed},
+		{"MOVE", http.StatusMethodNotAllowed},
+		{"REPORT", http.StatusMethodNotAllowed},
+	} {
+		req := httptest.NewRequest(tc.method, "/file", nil)
+		req.Header.Set("Destination", "/dest")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%v: got status %v, want %v", tc.method, w.Code, tc.want)
+		}
+	}
+}
+
+func TestNewPropFindResponseInclude(t *testing.T) {
+	props := func() map[xml.Name]PropFindFunc {
+		return map[xml.Name]PropFindFunc{
+			DisplayNameName:        PropFindValue(&DisplayName{Name: "test"}),
+			SupportedReportSetName: PropFindValue(NewSupportedReportSet()),
+		}
+	}
+
+	for _, tc := range []struct {
+		include *Include
+		want    bool
+	}{
+		{nil, false},
+		{&Include{Raw: xmlNamesToRaw([]xml.Name{SupportedReportSetName})}, true},
+	} {
+		propfind := &PropFind{AllProp: &struct{}{}, Include: tc.include}
+		resp, err := NewPropFindResponse("/", propfind, props())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := xml.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), "displayname") {
+			t.Errorf("include %v: missing displayname in %s", tc.include != nil, b)
+		}
+		if got := strings.Contains(string(b), "supported-report-set"); got != tc.want {
+			t.Errorf("include %v: got supported-report-set %v, want %v", tc.include != nil, got, tc.want)
+		}
+	}
+}
+
+// multiStatusBackend replies to PROPFIND requests with a fixed response.
+type multiStatusBackend struct {
+	readOnlyBackend
+	ms *MultiStatus
+}
+
+func (b *multiStatusBackend) PropFind(r *http.Request, pf *PropFind, depth Depth) (*MultiStatus, error) {
+	return b.ms, nil
+}
+
+func TestServeXMLNamespacePrefixes(t *testing.T) {
+	resp := NewOKResponse("/cal/")
+	val := NewRawXMLElement(xml.Name{Space: "urn:ietf:params:xml:ns:caldav", Local: "calendar-description"}, nil, nil)
+	if err := resp.EncodeProp(http.StatusOK, val); err != nil {
+		t.Fatal(err)
+	}
+	val = NewRawXMLElement(xml.Name{Space: "http://apple.com/ns/ical/", Local: "calendar-color"}, nil, nil)
+	if err := resp.EncodeProp(http.StatusOK, val); err != nil {
+		t.Fatal(err)
+	}
+	ms := NewMultiStatus(*resp)
+
+	for _, tc := range []struct {
+		name     string
+		prefixes map[string]string
+		want     []string
+	}{
+		{
+			name: "default",
+			want: []string{
+				`<D:multistatus xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:D="DAV:">`,
+				`<D:href>/cal/</D:href>`,
+				`<C:calendar-description></C:calendar-description>`,
+				`<calendar-color xmlns="http://apple.com/ns/ical/"></calendar-color>`,
+				`</D:multistatus>`,
+			},
+		},
+		{
+			name:     "override",
+			prefixes: map[string]string{Namespace: "d", "http://apple.com/ns/ical/": "ICAL", "urn:ietf:params:xml:ns:caldav": ""},
+			want: []string{
+				`<d:multistatus xmlns:ICAL="http://apple.com/ns/ical/" xmlns:d="DAV:">`,
+				`<calendar-description xmlns="urn:ietf:params:xml:ns:caldav"></calendar-description>`,
+				`<ICAL:calendar-color></ICAL:calendar-color>`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := Handler{Backend: &multiStatusBackend{ms: ms}, NamespacePrefixes: tc.prefixes}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/cal/", nil))
+			body := w.Body.String()
+			for _, s := range tc.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("response doesn't contain %q:\n%v", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestPeekReportName(t *testing.T) {
+	body := `<?xml version="1.0"?><multiget xmlns="DAV:">` + strings.Repeat("<href>/a</href>", 1000) + `</multiget>`
+	req := httptest.NewRequest("REPORT", "/", strings.NewReader(body))
+	name, err := peekReportName(req)
+	if err != nil {
+		t.Fatalf("peekReportName() = %v", err)
+	} else if want := (xml.Name{Space: "DAV:", Local: "multiget"}); name != want {
+		t.Errorf("peekReportName() = %v, want %v", name, want)
+	}
+	if b, err := io.ReadAll(req.Body); err != nil {
+		t.Fatalf("failed to read restored body: %v", err)
+	} else if string(b) != body {
+		t.Errorf("restored body differs from the original one")
+	}
+
+	prolog := "<!--" + strings.Repeat("x", maxReportPeekSize) + "-->"
+	req = httptest.NewRequest("REPORT", "/", strings.NewReader(prolog+`<multiget xmlns="DAV:"/>`))
+	if _, err := peekReportName(req); err == nil {
+		t.Errorf("peekReportName() with a long prolog succeeded")
+	}
+}
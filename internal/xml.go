@@ -25,6 +25,11 @@ func NewRawXMLElement(name xml.Name, attr []xml.Attr, children []RawXMLValue) *R
 	return &RawXMLValue{tok: xml.StartElement{name, attr}, children: children}
 }
 
+// NewRawXMLText creates a new RawXMLValue for an element containing text.
+func NewRawXMLText(name xml.Name, text string) *RawXMLValue {
+	return NewRawXMLElement(name, nil, []RawXMLValue{{tok: xml.CharData(text)}})
+}
+
 // EncodeRawXMLElement encodes a value into a new RawXMLValue. The XML value
 // can only be used for marshalling.
 func EncodeRawXMLElement(v interface{}) (*RawXMLValue, error) {
@@ -0,0 +1,155 @@
+// Package xmltest provides helpers to compare XML documents in tests,
+// regardless of namespace prefixes, attribute and element order, and
+// whitespace.
+package xmltest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type node struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	children []*node
+}
+
+func parse(data []byte) ([]*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	root := &node{}
+	stack := []*node{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		cur := stack[len(stack)-1]
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: tok.Name}
+			for _, attr := range tok.Attr {
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				n.attrs = append(n.attrs, attr)
+			}
+			sort.Slice(n.attrs, func(i, j int) bool {
+				a, b := n.attrs[i].Name, n.attrs[j].Name
+				return a.Space+" "+a.Local < b.Space+" "+b.Local
+			})
+			cur.children = append(cur.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			cur.text += string(tok)
+		}
+	}
+	return root.children, nil
+}
+
+func (n *node) format(sb *strings.Builder, depth int) {
+	children := make([]string, len(n.children))
+	for i, child := range n.children {
+		var csb strings.Builder
+		child.format(&csb, depth+1)
+		children[i] = csb.String()
+	}
+	sort.Strings(children)
+
+	sb.WriteString(strings.Repeat("  ", depth))
+	fmt.Fprintf(sb, "{%v}%v", n.name.Space, n.name.Local)
+	for _, attr := range n.attrs {
+		fmt.Fprintf(sb, " {%v}%v=%q", attr.Name.Space, attr.Name.Local, attr.Value)
+	}
+	if text := strings.TrimSpace(n.text); text != "" {
+		fmt.Fprintf(sb, " %q", text)
+	}
+	sb.WriteString("\n")
+	for _, child := range children {
+		sb.WriteString(child)
+	}
+}
+
+func (n *node) String() string {
+	var sb strings.Builder
+	n.format(&sb, 0)
+	return sb.String()
+}
+
+func (n *node) walk(fn func(*node) bool) bool {
+	if fn(n) {
+		return true
+	}
+	for _, child := range n.children {
+		if child.walk(fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Canonicalize parses an XML document and formats it in a canonical form:
+// namespace prefixes are resolved, attributes and child elements are sorted,
+// and whitespace around text is trimmed. Two documents are equivalent if
+// their canonical forms are equal.
+func Canonicalize(data []byte) (string, error) {
+	nodes, err := parse(data)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, n := range nodes {
+		n.format(&sb, 0)
+	}
+	return sb.String(), nil
+}
+
+// AssertEqual checks that two XML documents are equivalent.
+func AssertEqual(t testing.TB, got, want []byte) {
+	t.Helper()
+
+	g, err := Canonicalize(got)
+	if err != nil {
+		t.Fatalf("failed to parse XML: %v\n%s", err, got)
+	}
+	w, err := Canonicalize(want)
+	if err != nil {
+		t.Fatalf("failed to parse expected XML: %v\n%s", err, want)
+	}
+	if g != w {
+		t.Errorf("XML mismatch:\ngot:\n%v\nwant:\n%v", g, w)
+	}
+}
+
+// AssertContains checks that an XML document contains an element equivalent
+// to fragment.
+func AssertContains(t testing.TB, doc []byte, fragment string) {
+	t.Helper()
+
+	nodes, err := parse(doc)
+	if err != nil {
+		t.Fatalf("failed to parse XML: %v\n%s", err, doc)
+	}
+	want, err := parse([]byte(fragment))
+	if err != nil || len(want) != 1 {
+		t.Fatalf("invalid XML fragment %q: %v", fragment, err)
+	}
+
+	s := want[0].String()
+	for _, n := range nodes {
+		if n.walk(func(n *node) bool { return n.String() == s }) {
+			return
+		}
+	}
+	t.Errorf("XML element not found:\n%v\nin document:\n%s", s, doc)
+}
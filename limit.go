@@ -0,0 +1,90 @@
+package webdav
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// defaultRetryAfter is the default delay suggested to clients whose request
+// was rejected because too many requests were in progress.
+const defaultRetryAfter = time.Second
+
+// requestLimiter limits the number of requests processed concurrently.
+type requestLimiter struct {
+	once      sync.Once
+	all       chan struct{}
+	expensive chan struct{}
+}
+
+func isExpensiveMethod(method string) bool {
+	switch method {
+	case "PROPFIND", "REPORT":
+		return true
+	default:
+		return false
+	}
+}
+
+func tryAcquire(sem chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// acquire reserves a slot for a request. If no slot is available, it returns
+// false. Otherwise, the returned function must be called once the request
+// has been processed.
+func (h *Handler) acquire(r *http.Request) (func(), bool) {
+	l := &h.limiter
+	l.once.Do(func() {
+		if h.MaxConcurrentRequests > 0 {
+			l.all = make(chan struct{}, h.MaxConcurrentRequests)
+		}
+		if h.MaxConcurrentExpensiveRequests > 0 {
+			l.expensive = make(chan struct{}, h.MaxConcurrentExpensiveRequests)
+		}
+	})
+
+	var expensive chan struct{}
+	if isExpensiveMethod(r.Method) {
+		expensive = l.expensive
+	}
+
+	if !tryAcquire(l.all) {
+		return nil, false
+	}
+	if !tryAcquire(expensive) {
+		release(l.all)
+		return nil, false
+	}
+	return func() {
+		release(expensive)
+		release(l.all)
+	}, true
+}
+
+func (h *Handler) serveTooManyRequests(w http.ResponseWriter) {
+	retryAfter := h.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	internal.ServeError(w, internal.HTTPErrorf(http.StatusServiceUnavailable, "webdav: too many concurrent requests"))
+}
@@ -0,0 +1,51 @@
+package webdav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// MemberCreator is an optional interface a FileSystem can implement to let
+// clients add members to directories without choosing their name, as defined
+// in RFC 5995. Clients POST the contents of the new file to the directory,
+// and the server replies with its URL in the Location header.
+//
+// Directories advertise this capability with the DAV:add-member property.
+type MemberCreator interface {
+	// CreateMember creates a new file in the collection, with a name chosen
+	// by the FileSystem. It returns the information of the new file.
+	CreateMember(ctx context.Context, collection string, body io.ReadCloser) (*FileInfo, error)
+}
+
+func (b *backend) Post(w http.ResponseWriter, r *http.Request) error {
+	mc, ok := b.FileSystem.(MemberCreator)
+	if !ok {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "webdav: POST not supported")
+	}
+
+	fi, err := b.stat(r.Context(), r.URL.Path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir {
+		return internal.HTTPErrorf(http.StatusMethodNotAllowed, "webdav: POST requests must target a collection")
+	}
+
+	body, err := b.putBody(r)
+	if err != nil {
+		return err
+	}
+	fi, err = mc.CreateMember(r.Context(), r.URL.Path, body)
+	if err != nil {
+		return errInsufficientStorage(err)
+	}
+
+	w.Header().Set("Location", (&url.URL{Path: fi.Path}).String())
+	b.writeFileHeaders(w, fi)
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
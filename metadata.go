@@ -0,0 +1,69 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// MetadataProvider is an optional interface a FileSystem can implement to
+// expose metadata of files as read-only properties, e.g. the dimensions of
+// images or the camera used to take them, so that clients don't need to
+// download the files. The properties are stored in a namespace chosen by the
+// FileSystem.
+//
+// Metadata properties aren't returned for allprop requests, unless they're
+// listed in a DAV:include element.
+type MetadataProvider interface {
+	// MetadataNames returns the names of the metadata properties of a file.
+	// It's called for each file of a PROPFIND response and should be cheap.
+	MetadataNames(fi *FileInfo) []xml.Name
+	// Metadata returns the values of the metadata properties of a file, e.g.
+	// read from its EXIF data or from an adjacent file. It's only called if
+	// one of the properties is requested. Missing properties are reported as
+	// not found.
+	Metadata(ctx context.Context, fi *FileInfo) (map[xml.Name]string, error)
+}
+
+// metadataProps adds the metadata properties of a file to props, if the
+// FileSystem implements MetadataProvider. The provider is only called if one
+// of the properties is requested.
+func (b *backend) metadataProps(ctx context.Context, propfind *internal.PropFind, fi *FileInfo, props map[xml.Name]internal.PropFindFunc) {
+	mp, ok := b.FileSystem.(MetadataProvider)
+	if !ok {
+		return
+	}
+
+	var (
+		values map[xml.Name]string
+		err    error
+		done   bool
+	)
+	metadata := func() (map[xml.Name]string, error) {
+		if !done {
+			values, err = mp.Metadata(ctx, fi)
+			done = true
+		}
+		return values, err
+	}
+
+	for _, name := range mp.MetadataNames(fi) {
+		if propfind.AllProp != nil && !propfind.Includes(name) {
+			continue
+		}
+		name := name
+		props[name] = func(*internal.RawXMLValue) (interface{}, error) {
+			values, err := metadata()
+			if err != nil {
+				return nil, err
+			}
+			v, ok := values[name]
+			if !ok {
+				return nil, internal.HTTPErrorf(http.StatusNotFound, "webdav: metadata property not found")
+			}
+			return internal.NewRawXMLText(name, v), nil
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// OwnershipProvider is an optional interface a FileSystem can implement to
+// report the owner and group of files, as defined in RFC 3744 section 5.1 and
+// 5.2. They are exposed in the DAV:owner and DAV:group properties.
+//
+// If the FileSystem doesn't implement OwnershipProvider, these properties are
+// reported as not found.
+type OwnershipProvider interface {
+	// Ownership returns the principal URLs of the owner and group of a file.
+	// An empty string means that the file has no owner or group.
+	Ownership(ctx context.Context, name string) (owner, group string, err error)
+}
+
+// ownershipProps adds the DAV:owner and DAV:group properties to props, if the
+// FileSystem implements OwnershipProvider. The provider is only called if one
+// of the properties is requested.
+func (b *backend) ownershipProps(ctx context.Context, fi *FileInfo, props map[xml.Name]internal.PropFindFunc) {
+	op, ok := b.FileSystem.(OwnershipProvider)
+	if !ok {
+		return
+	}
+
+	var (
+		owner, group string
+		err          error
+		done         bool
+	)
+	ownership := func() (string, string, error) {
+		if !done {
+			owner, group, err = op.Ownership(ctx, fi.Path)
+			done = true
+		}
+		return owner, group, err
+	}
+
+	props[internal.OwnerName] = func(*internal.RawXMLValue) (interface{}, error) {
+		owner, _, err := ownership()
+		if err != nil {
+			return nil, err
+		}
+		return &internal.Owner{Href: principalHref(owner)}, nil
+	}
+	props[internal.GroupName] = func(*internal.RawXMLValue) (interface{}, error) {
+		_, group, err := ownership()
+		if err != nil {
+			return nil, err
+		}
+		return &internal.Group{Href: principalHref(group)}, nil
+	}
+}
+
+func principalHref(p string) *internal.Href {
+	if p == "" {
+		return nil
+	}
+	return &internal.Href{Path: p}
+}
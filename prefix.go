@@ -0,0 +1,172 @@
+package webdav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// StripPrefix returns a handler serving WebDAV requests under a URL path
+// prefix. The prefix is removed from the request path and from the
+// Destination header before invoking h, and added back to the hrefs of
+// multistatus responses, of directory listings and to the Location header.
+// Requests outside of the prefix are answered with a 404 Not Found error.
+func StripPrefix(prefix string, h http.Handler) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return h
+	}
+	escapedPrefix := (&url.URL{Path: prefix}).EscapedPath()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := trimPathPrefix(r.URL.Path, prefix)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		rp, ok := trimPathPrefix(r.URL.RawPath, prefix)
+		if r.URL.RawPath != "" && !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = p
+		r2.URL.RawPath = rp
+
+		if dest := r.Header.Get("Destination"); dest != "" {
+			u, err := url.Parse(dest)
+			if err != nil {
+				internal.ServeError(w, internal.HTTPErrorf(http.StatusBadRequest, "webdav: malformed Destination header: %v", err))
+				return
+			}
+			destPath, ok := trimPathPrefix(u.Path, prefix)
+			if !ok {
+				internal.ServeError(w, internal.HTTPErrorf(http.StatusBadGateway, "webdav: Destination outside of %q", prefix))
+				return
+			}
+			u.Path = destPath
+			u.RawPath = ""
+			r2.Header.Set("Destination", u.String())
+		}
+
+		pw := prefixResponseWriter{ResponseWriter: w, prefix: escapedPrefix}
+		h.ServeHTTP(&pw, r2)
+		pw.finish()
+	})
+}
+
+func trimPathPrefix(p, prefix string) (string, bool) {
+	if p == prefix {
+		return "/", true
+	}
+	if !strings.HasPrefix(p, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(p, prefix), true
+}
+
+// prefixResponseWriter adds an escaped prefix to the hrefs of the response.
+// Multistatus responses are buffered so that their hrefs can be rewritten.
+type prefixResponseWriter struct {
+	http.ResponseWriter
+	prefix      string
+	code        int
+	wroteHeader bool
+	buf         *bytes.Buffer
+}
+
+func (pw *prefixResponseWriter) WriteHeader(code int) {
+	if pw.wroteHeader {
+		return
+	}
+	pw.wroteHeader = true
+
+	if loc := pw.Header().Get("Location"); strings.HasPrefix(loc, "/") {
+		pw.Header().Set("Location", pw.prefix+loc)
+	}
+
+	if code == http.StatusMultiStatus {
+		pw.code = code
+		pw.buf = new(bytes.Buffer)
+		pw.Header().Del("Content-Length")
+		return
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *prefixResponseWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.buf != nil {
+		return pw.buf.Write(b)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *prefixResponseWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+func (pw *prefixResponseWriter) finish() {
+	if pw.buf == nil {
+		return
+	}
+	data := addHrefPrefix(pw.buf.Bytes(), pw.prefix)
+	pw.ResponseWriter.WriteHeader(pw.code)
+	pw.ResponseWriter.Write(data)
+}
+
+// addHrefPrefix adds an escaped prefix to all absolute paths in DAV:href
+// elements of an XML document. If the document cannot be parsed, it's
+// returned unchanged.
+func addHrefPrefix(data []byte, prefix string) []byte {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(prefix))
+
+	var offsets []int64
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inHref := false
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return data
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			inHref = tok.Name == xml.Name{Space: "DAV:", Local: "href"}
+		case xml.EndElement:
+			inHref = false
+		case xml.CharData:
+			if !inHref {
+				break
+			}
+			trimmed := bytes.TrimLeft(tok, " \t\r\n")
+			if bytes.HasPrefix(trimmed, []byte("/")) {
+				offsets = append(offsets, start+int64(len(tok)-len(trimmed)))
+			}
+			inHref = false
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + len(offsets)*escaped.Len())
+	var last int64
+	for _, off := range offsets {
+		buf.Write(data[last:off])
+		buf.Write(escaped.Bytes())
+		last = off
+	}
+	buf.Write(data[last:])
+	return buf.Bytes()
+}
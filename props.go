@@ -0,0 +1,71 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"mime"
+	"net/http"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// PropertyStore is an optional interface a FileSystem can implement to
+// persist properties set with PROPPATCH requests.
+//
+// Only the DAV:getcontenttype property can be set for now. It overrides the
+// MIME type returned by Stat and ReadDir, for PROPFIND and GET requests.
+type PropertyStore interface {
+	// Properties returns the properties stored for a file. Files without
+	// stored properties should return an empty map rather than an error.
+	Properties(ctx context.Context, name string) (map[xml.Name]string, error)
+	// PatchProperties sets and removes properties of a file. The update
+	// must be applied atomically.
+	PatchProperties(ctx context.Context, name string, set map[xml.Name]string, remove []xml.Name) error
+}
+
+// applyProperties overrides live properties of fi with the ones stored in the
+// PropertyStore, if any.
+func (b *backend) applyProperties(ctx context.Context, fi *FileInfo) error {
+	store, ok := b.FileSystem.(PropertyStore)
+	if !ok || fi.IsDir {
+		return nil
+	}
+	props, err := store.Properties(ctx, fi.Path)
+	if err != nil {
+		return err
+	}
+	if t, ok := props[internal.GetContentTypeName]; ok {
+		fi.MIMEType = t
+	}
+	return nil
+}
+
+// propPatchSet validates a property set by a PROPPATCH request, and returns
+// the status of the update and the value to store.
+func (b *backend) propPatchSet(fi *FileInfo, raw *internal.RawXMLValue) (int, string, error) {
+	if _, ok := b.FileSystem.(PropertyStore); !ok || fi.IsDir {
+		return http.StatusForbidden, "", nil
+	}
+	name, _ := raw.XMLName()
+	if name != internal.GetContentTypeName {
+		return http.StatusForbidden, "", nil
+	}
+
+	var prop internal.GetContentType
+	if err := raw.Decode(&prop); err != nil {
+		return 0, "", err
+	}
+	if _, _, err := mime.ParseMediaType(prop.Type); err != nil {
+		return http.StatusConflict, "", nil
+	}
+	return http.StatusOK, prop.Type, nil
+}
+
+// propPatchRemove validates a property removed by a PROPPATCH request, and
+// returns the status of the update.
+func (b *backend) propPatchRemove(fi *FileInfo, name xml.Name) int {
+	if _, ok := b.FileSystem.(PropertyStore); !ok || fi.IsDir || name != internal.GetContentTypeName {
+		return http.StatusForbidden
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,93 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Quota describes the storage available to a resource, as defined in RFC 4331.
+type Quota struct {
+	// Available is the number of bytes which can still be stored, or a
+	// negative value if unlimited.
+	Available int64
+	// Used is the number of bytes used.
+	Used int64
+}
+
+// QuotaProvider is an optional interface a FileSystem can implement to check
+// quotas before a PUT request body is accepted. Requests whose Content-Length
+// exceeds the available space are rejected with 507 Insufficient Storage.
+// Bodies of unknown length are checked while they're streamed to the
+// FileSystem: Create fails once they exceed the available space. A nil Quota
+// means the storage is unlimited.
+type QuotaProvider interface {
+	Quota(ctx context.Context, name string) (*Quota, error)
+}
+
+var (
+	quotaNotExceededName    = xml.Name{Space: "DAV:", Local: "quota-not-exceeded"}
+	sufficientDiskSpaceName = xml.Name{Space: "DAV:", Local: "sufficient-disk-space"}
+)
+
+func newInsufficientStorageError(precondition xml.Name) error {
+	return &internal.HTTPError{
+		Code: http.StatusInsufficientStorage,
+		Err: &internal.Error{
+			Raw: []internal.RawXMLValue{*internal.NewRawXMLElement(precondition, nil, nil)},
+		},
+	}
+}
+
+// errInsufficientStorage converts disk full and quota exceeded errors to a 507
+// Insufficient Storage HTTP error. Other errors are returned unchanged.
+func errInsufficientStorage(err error) error {
+	if errors.Is(err, syscall.EDQUOT) {
+		return newInsufficientStorageError(quotaNotExceededName)
+	} else if errors.Is(err, syscall.ENOSPC) {
+		return newInsufficientStorageError(sufficientDiskSpaceName)
+	}
+	return err
+}
+
+// quotaBody rejects a PUT request if its body wouldn't fit in the quota. If
+// the size of the body is unknown, e.g. because it's sent with chunked
+// transfer encoding, the returned body fails once it exceeds the quota.
+func quotaBody(r *http.Request, fs FileSystem) (io.ReadCloser, error) {
+	qp, ok := fs.(QuotaProvider)
+	if !ok {
+		return r.Body, nil
+	}
+	quota, err := qp.Quota(r.Context(), r.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+	if quota == nil || quota.Available < 0 {
+		return r.Body, nil
+	} else if r.ContentLength > quota.Available {
+		return nil, newInsufficientStorageError(quotaNotExceededName)
+	} else if r.ContentLength >= 0 {
+		return r.Body, nil
+	}
+	return &quotaReadCloser{ReadCloser: r.Body, available: quota.Available}, nil
+}
+
+type quotaReadCloser struct {
+	io.ReadCloser
+	available int64
+}
+
+func (rc *quotaReadCloser) Read(b []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(b)
+	rc.available -= int64(n)
+	if rc.available < 0 {
+		return n, fmt.Errorf("webdav: request body exceeds quota: %w", syscall.EDQUOT)
+	}
+	return n, err
+}
@@ -0,0 +1,131 @@
+package webdav
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-webdav/internal/xmltest"
+)
+
+// A trace is a recorded HTTP exchange stored in testdata/traces. The file
+// contains a raw HTTP request, followed by a line containing only
+// traceSeparator, followed by the expected raw HTTP response. Lines may end
+// with either LF or CRLF, and Content-Length headers may be omitted. Only the
+// headers present in the expected response are compared. XML bodies are
+// compared after canonicalization.
+const traceSeparator = "--- response"
+
+// traceTime is the modification time of all files in the trace file tree, so
+// that Last-Modified headers and ETags are stable.
+var traceTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+var traceFiles = map[string]string{
+	"hello.txt":          "Hello world!\n",
+	"docs/report.pdf":    "%PDF-1.4\n",
+	"docs/notes/todo.md": "- write tests\n",
+}
+
+func newTraceFileSystem(t *testing.T) LocalFileSystem {
+	fs := newTestFileSystem(t, traceFiles)
+	err := filepath.Walk(string(fs), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(p, traceTime, traceTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Directory modification times change when their children are created,
+	// so fix them up last
+	for _, dir := range []string{"docs/notes", "docs", ""} {
+		if err := os.Chtimes(filepath.Join(string(fs), dir), traceTime, traceTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fs
+}
+
+// splitMessage splits a raw HTTP message into its head, normalized to CRLF
+// line endings, and its body.
+func splitMessage(s string) (head string, body []byte) {
+	s = strings.TrimLeft(s, "\r\n")
+	h, b, _ := strings.Cut(strings.ReplaceAll(s, "\r\n", "\n"), "\n\n")
+	head = strings.ReplaceAll(h, "\n", "\r\n") + "\r\n\r\n"
+	return head, []byte(b)
+}
+
+func readTrace(name string) (*http.Request, *http.Response, []byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rawReq, rawResp, ok := strings.Cut(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"+traceSeparator+"\n")
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("missing %q separator", traceSeparator)
+	}
+
+	head, body := splitMessage(rawReq)
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(head)))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse request: %v", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.RequestURI = ""
+
+	head, wantBody := splitMessage(rawResp)
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(head)), req)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	return req, resp, bytes.TrimSpace(wantBody), nil
+}
+
+func TestReplayTraces(t *testing.T) {
+	traces, err := filepath.Glob("testdata/traces/*.trace")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(traces) == 0 {
+		t.Fatal("no traces found")
+	}
+
+	for _, name := range traces {
+		t.Run(strings.TrimSuffix(filepath.Base(name), ".trace"), func(t *testing.T) {
+			req, want, wantBody, err := readTrace(name)
+			if err != nil {
+				t.Fatalf("failed to read trace: %v", err)
+			}
+
+			h := &Handler{FileSystem: newTraceFileSystem(t)}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			got := w.Result()
+			gotBody := bytes.TrimSpace(w.Body.Bytes())
+
+			if got.StatusCode != want.StatusCode {
+				t.Errorf("got status %v, want %v", got.StatusCode, want.StatusCode)
+			}
+			for k := range want.Header {
+				if g, w := got.Header.Get(k), want.Header.Get(k); g != w {
+					t.Errorf("header %v: got %q, want %q", k, g, w)
+				}
+			}
+
+			if strings.Contains(want.Header.Get("Content-Type"), "xml") {
+				xmltest.AssertEqual(t, gotBody, wantBody)
+			} else if !bytes.Equal(gotBody, wantBody) {
+				t.Errorf("body mismatch:\ngot:\n%s\nwant:\n%s", gotBody, wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+)
+
+// PrincipalSearcher is an optional interface CalDAV and CardDAV backends can
+// implement to handle principal-property-search REPORT requests, defined in
+// RFC 3744 section 9.4. Clients use them to look up users, e.g. to invite
+// attendees to an event.
+type PrincipalSearcher interface {
+	SearchPrincipals(ctx context.Context, query *PrincipalSearchQuery) ([]Principal, error)
+}
+
+// PrincipalSearchQuery is a principal-property-search query.
+type PrincipalSearchQuery struct {
+	// Matches lists the conditions principals must match.
+	Matches []PrincipalPropMatch
+	// AnyOf indicates that principals only need to match one of the
+	// conditions, instead of all of them.
+	AnyOf bool
+}
+
+// PrincipalPropMatch matches principals with one of the properties in Props,
+// such as DAV:displayname, containing Text. Text is compared
+// case-insensitively.
+type PrincipalPropMatch struct {
+	Props []xml.Name
+	Text  string
+}
+
+// Principal is a principal returned by a search.
+type Principal struct {
+	Path        string
+	DisplayName string
+	// Addresses lists the calendar user addresses of the principal, e.g.
+	// "mailto:alice@example.org". CalDAV servers report them in the
+	// CALDAV:calendar-user-address-set property.
+	Addresses []string
+}
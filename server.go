@@ -3,11 +3,17 @@ package webdav
 import (
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
 	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/emersion/go-webdav/internal"
 )
@@ -28,6 +34,128 @@ type FileSystem interface {
 // server.
 type Handler struct {
 	FileSystem FileSystem
+
+	// DirListingTemplate is used to render the HTML page returned for GET
+	// requests on collections. It is executed with a *DirListing. If nil,
+	// DefaultDirListingTemplate is used.
+	DirListingTemplate *template.Template
+
+	// CopyMoveProgress, if set, is called while a COPY or MOVE request is
+	// being processed, after each member of the source has been handled. See
+	// ProgressFunc.
+	CopyMoveProgress func(r *http.Request, name string, n int)
+
+	// DigestAlgorithms lists the algorithms used to verify the Content-MD5
+	// and Digest headers of PUT requests. Digests using other algorithms, or
+	// algorithms not implemented by this package, are ignored. If nil, MD5
+	// and SHA-256 are verified.
+	DigestAlgorithms []DigestAlgorithm
+
+	// SyntheticRoot, if set, makes the handler report the root as an empty
+	// collection if the FileSystem fails to stat or list it, e.g. because
+	// it's a virtual mount root. This lets clients discover the server
+	// before any resource exists.
+	SyntheticRoot bool
+
+	// ResourceTypes, if set, returns extra resource types for a file. They
+	// are reported in the resourcetype property, alongside the collection
+	// type for directories. This can be used to mark collections served by
+	// this handler as e.g. CalDAV calendars.
+	ResourceTypes func(ctx context.Context, fi *FileInfo) []xml.Name
+
+	// CORS, if set, enables Cross-Origin Resource Sharing. Preflight requests
+	// from allowed origins are answered without reaching the FileSystem.
+	CORS *CORSOptions
+
+	// PropPatchDryRun, if set, reports whether a PROPPATCH request should
+	// only be validated. Dry-run requests report the status each property
+	// update would have, without persisting anything. Otherwise, property
+	// updates are atomic: if one of them fails, the others are reported with
+	// a 424 Failed Dependency status.
+	PropPatchDryRun func(r *http.Request) bool
+
+	// Debug, if set, captures the requests and responses of some clients.
+	Debug *DebugOptions
+
+	// MaxConcurrentRequests limits the number of requests processed
+	// concurrently. MaxConcurrentExpensiveRequests additionally limits the
+	// number of PROPFIND and REPORT requests, which can be slow on large
+	// collections. Excess requests are rejected with a 503 Service
+	// Unavailable error and a Retry-After header. Zero means no limit.
+	MaxConcurrentRequests          int
+	MaxConcurrentExpensiveRequests int
+	// RetryAfter is the delay suggested to rejected clients. If zero, one
+	// second is used.
+	RetryAfter time.Duration
+
+	// ReadTimeout and WriteTimeout, if set, limit the time spent reading the
+	// request body and writing the response, so that slow or stalled clients
+	// don't hold resources. They're applied per request, as deadlines set
+	// with http.ResponseController, and take precedence over the timeouts of
+	// the http.Server. Request headers are read before the handler is
+	// invoked: use http.Server.ReadHeaderTimeout to limit the time spent
+	// reading them.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// MaxPropFindResults limits the number of responses returned by a
+	// PROPFIND request. Truncated responses end with a 507 Insufficient
+	// Storage response for the request URI, with a
+	// DAV:number-of-matches-within-limits error. Zero means no limit.
+	MaxPropFindResults int
+
+	// ContentDisposition, if set, returns the disposition type ("inline" or
+	// "attachment") and file name of the Content-Disposition header sent in
+	// response to GET and HEAD requests on a file. This can be used to
+	// suggest a friendly name when the path isn't one. No header is sent if
+	// the disposition type is empty. Non-ASCII file names are encoded as
+	// defined in RFC 5987.
+	ContentDisposition func(fi *FileInfo) (disposition, filename string)
+
+	// NamespacePrefixes maps XML namespaces to the prefixes used in
+	// responses. It overrides the default prefixes: "D" for DAV:, "C" for
+	// CalDAV and "CARD" for CardDAV. An empty prefix makes elements of a
+	// namespace use a default namespace declaration instead. Some clients
+	// fail to parse responses using other prefixes.
+	NamespacePrefixes map[string]string
+
+	// HiddenFile, if set, reports whether a file should be omitted from
+	// collection listings, i.e. PROPFIND responses and HTML directory
+	// listings. It's called with the base name of each member, members of
+	// hidden directories are hidden as well. Hidden files can still be
+	// accessed directly, e.g. with GET requests. If nil, DefaultHiddenFile is
+	// used.
+	HiddenFile func(name string) bool
+
+	// CacheControl, if set, returns the Cache-Control header sent in
+	// response to GET and HEAD requests, e.g. "no-cache" for collections and
+	// "public, max-age=31536000, immutable" for files whose content never
+	// changes. The response also varies on Accept-Encoding, in case the
+	// handler is wrapped by a compression middleware. No header is sent if
+	// the result is empty.
+	CacheControl func(fi *FileInfo) string
+
+	// ResponseHeaders, if set, returns extra headers for responses to GET,
+	// HEAD and PROPFIND requests, e.g. security headers such as
+	// "X-Content-Type-Options: nosniff". It's called with the resource
+	// targeted by the request, once it's been resolved. The headers are added
+	// to the ones set by the handler.
+	ResponseHeaders func(r *http.Request, fi *FileInfo) http.Header
+
+	// Transcode, if set, converts files to media types supported by clients,
+	// e.g. HEIC images to JPEG for browsers.
+	Transcode *TranscodeOptions
+
+	// Authorizer, if set, authorizes requests before the FileSystem is
+	// invoked. It's called with the request URI, with the destination of
+	// COPY and MOVE requests, and with DELETE for each member of batch-delete
+	// REPORT requests. For instance, a collection can be made
+	// read-only for some principals by rejecting other methods than GET,
+	// HEAD, OPTIONS and PROPFIND, and rejecting it as a destination.
+	Authorizer Authorizer
+
+	limiter      requestLimiter
+	treeVersions treeVersions
 }
 
 // ServeHTTP implements http.Handler.
@@ -37,11 +165,89 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b := backend{h.FileSystem}
-	hh := internal.Handler{Backend: &b}
+	h.setDeadlines(w)
+
+	if h.Debug != nil {
+		w, r = h.Debug.wrap(w, r)
+	}
+
+	if h.CORS != nil && h.CORS.serve(w, r) {
+		return
+	}
+
+	if err := h.authorize(r); err != nil {
+		internal.ServeError(w, err)
+		return
+	}
+
+	done, ok := h.acquire(r)
+	if !ok {
+		h.serveTooManyRequests(w)
+		return
+	}
+	defer done()
+
+	r = r.WithContext(contextWithTreeVersions(r.Context(), &h.treeVersions))
+
+	b := backend{
+		FileSystem:         h.FileSystem,
+		DirListingTemplate: h.DirListingTemplate,
+		CopyMoveProgress:   h.CopyMoveProgress,
+		DigestAlgorithms:   h.DigestAlgorithms,
+		ResourceTypes:      h.ResourceTypes,
+		PropPatchDryRun:    h.PropPatchDryRun,
+		SyntheticRoot:      h.SyntheticRoot,
+		MaxPropFindResults: h.MaxPropFindResults,
+		ContentDisposition: h.ContentDisposition,
+		HiddenFile:         h.HiddenFile,
+		CacheControl:       h.CacheControl,
+		ResponseHeaders:    h.ResponseHeaders,
+		Transcode:          h.Transcode,
+		header:             w.Header(),
+	}
+	if b.HiddenFile == nil {
+		b.HiddenFile = DefaultHiddenFile
+	}
+	hh := internal.Handler{Backend: &b, NamespacePrefixes: h.NamespacePrefixes}
+	if h.Authorizer != nil {
+		hh.Authorize = h.authorizeMethod
+	}
 	hh.ServeHTTP(w, r)
 }
 
+// setDeadlines applies ReadTimeout and WriteTimeout to the connection of a
+// request. ResponseWriters which don't support deadlines are left untouched.
+func (h *Handler) setDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	now := time.Now()
+	if h.ReadTimeout > 0 {
+		rc.SetReadDeadline(now.Add(h.ReadTimeout))
+	}
+	if h.WriteTimeout > 0 {
+		rc.SetWriteDeadline(now.Add(h.WriteTimeout))
+	}
+}
+
+// HealthCheck checks that the FileSystem is reachable, by stat'ing its root.
+// It can be used to implement a liveness or readiness probe. It should be
+// served on a route separate from the WebDAV tree, e.g.:
+//
+//	mux.Handle("/dav/", webdav.StripPrefix("/dav", h))
+//	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+//		if err := h.HealthCheck(r.Context()); err != nil {
+//			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+//		}
+//	})
+func (h *Handler) HealthCheck(ctx context.Context) error {
+	if h.FileSystem == nil {
+		return errors.New("webdav: no filesystem available")
+	}
+	if _, err := h.FileSystem.Stat(ctx, "/"); err != nil {
+		return fmt.Errorf("webdav: filesystem unreachable: %w", err)
+	}
+	return nil
+}
+
 // NewHTTPError creates a new error that is associated with an HTTP status code
 // and optionally an error that lead to it. Backends can use this functions to
 // return errors that convey some semantics (e.g. 404 not found, 403 access
@@ -52,11 +258,77 @@ func NewHTTPError(statusCode int, cause error) error {
 }
 
 type backend struct {
-	FileSystem FileSystem
+	FileSystem         FileSystem
+	DirListingTemplate *template.Template
+	CopyMoveProgress   func(r *http.Request, name string, n int)
+	DigestAlgorithms   []DigestAlgorithm
+	ResourceTypes      func(ctx context.Context, fi *FileInfo) []xml.Name
+	PropPatchDryRun    func(r *http.Request) bool
+	SyntheticRoot      bool
+	MaxPropFindResults int
+	ContentDisposition func(fi *FileInfo) (disposition, filename string)
+	HiddenFile         func(name string) bool
+	CacheControl       func(fi *FileInfo) string
+	ResponseHeaders    func(r *http.Request, fi *FileInfo) http.Header
+	Transcode          *TranscodeOptions
+
+	header http.Header
+}
+
+// DefaultHiddenFile hides the metadata files created by the file managers of
+// macOS and Windows, ".DS_Store" and "Thumbs.db".
+func DefaultHiddenFile(name string) bool {
+	return name == ".DS_Store" || strings.EqualFold(name, "Thumbs.db")
+}
+
+// stat calls FileSystem.Stat, falling back to an empty collection for the
+// root if SyntheticRoot is set.
+func (b *backend) stat(ctx context.Context, name string) (*FileInfo, error) {
+	fi, err := b.FileSystem.Stat(ctx, name)
+	if err != nil && b.SyntheticRoot && path.Clean(name) == "/" {
+		return &FileInfo{Path: "/", IsDir: true}, nil
+	}
+	return fi, err
+}
+
+// readDir calls FileSystem.ReadDir, with the same fallback as stat. Hidden
+// files are omitted.
+func (b *backend) readDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	l, err := b.FileSystem.ReadDir(ctx, name, recursive)
+	if err != nil && len(l) == 0 && b.SyntheticRoot && path.Clean(name) == "/" {
+		return []FileInfo{{Path: "/", IsDir: true}}, nil
+	}
+	if b.HiddenFile == nil {
+		return l, err
+	}
+
+	dir := path.Clean(name)
+	visible := l[:0]
+	for _, fi := range l {
+		if !b.isHidden(dir, path.Clean(fi.Path)) {
+			visible = append(visible, fi)
+		}
+	}
+	return visible, err
+}
+
+// isHidden checks whether a member of dir, or one of its parents below dir,
+// is hidden.
+func (b *backend) isHidden(dir, name string) bool {
+	rel := strings.TrimPrefix(strings.TrimPrefix(name, dir), "/")
+	if rel == "" {
+		return false
+	}
+	for _, seg := range strings.Split(rel, "/") {
+		if b.HiddenFile(seg) {
+			return true
+		}
+	}
+	return false
 }
 
 func (b *backend) Options(r *http.Request) (caps []string, allow []string, err error) {
-	fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path)
+	fi, err := b.stat(r.Context(), r.URL.Path)
 	if internal.IsNotFound(err) {
 		return nil, []string{http.MethodOptions, http.MethodPut, "MKCOL"}, nil
 	} else if err != nil {
@@ -69,22 +341,70 @@ func (b *backend) Options(r *http.Request) (caps []string, allow []string, err e
 		"PROPFIND",
 		"COPY",
 		"MOVE",
+		http.MethodHead,
+		http.MethodGet,
 	}
 
 	if !fi.IsDir {
-		allow = append(allow, http.MethodHead, http.MethodGet, http.MethodPut)
+		allow = append(allow, http.MethodPut)
+	} else if _, ok := b.FileSystem.(MemberCreator); ok {
+		allow = append(allow, http.MethodPost)
 	}
 
 	return nil, allow, nil
 }
 
 func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
-	fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path)
+	fi, err := b.stat(r.Context(), r.URL.Path)
 	if err != nil {
 		return err
 	}
+	b.writeResponseHeaders(r, fi)
 	if fi.IsDir {
-		return &internal.HTTPError{Code: http.StatusMethodNotAllowed}
+		b.writeCacheHeaders(w, fi)
+		return b.serveDirListing(w, r, fi)
+	}
+	if err := b.applyProperties(r.Context(), fi); err != nil {
+		return err
+	}
+	b.writeCacheHeaders(w, fi)
+
+	if b.Transcode != nil {
+		if to := b.Transcode.target(r, fi); to != "" {
+			return b.serveTranscoded(w, r, fi, to)
+		}
+	}
+
+	if !fi.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", fi.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if fi.ETag != "" {
+		w.Header().Set("ETag", internal.ETag(fi.ETag).String())
+	}
+
+	if code, err := checkConditionalRead(r.Header, fi); err != nil {
+		return err
+	} else if code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return nil
+	} else if code != 0 {
+		return internal.HTTPErrorf(code, "webdav: precondition failed")
+	}
+
+	if b.ContentDisposition != nil {
+		if disposition, filename := b.ContentDisposition(fi); disposition != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		// Don't open the file, everything we need is in the FileInfo
+		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size, 10))
+		if fi.MIMEType != "" {
+			w.Header().Set("Content-Type", fi.MIMEType)
+		}
+		w.WriteHeader(http.StatusOK)
+		return nil
 	}
 
 	f, err := b.FileSystem.Open(r.Context(), r.URL.Path)
@@ -97,15 +417,10 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 	if fi.MIMEType != "" {
 		w.Header().Set("Content-Type", fi.MIMEType)
 	}
-	if !fi.ModTime.IsZero() {
-		w.Header().Set("Last-Modified", fi.ModTime.UTC().Format(http.TimeFormat))
-	}
-	if fi.ETag != "" {
-		w.Header().Set("ETag", internal.ETag(fi.ETag).String())
-	}
 
 	if rs, ok := f.(io.ReadSeeker); ok {
-		// If it's an io.Seeker, use http.ServeContent which supports ranges
+		// If it's an io.Seeker, use http.ServeContent which supports ranges,
+		// including multiple ranges sent as multipart/byteranges
 		http.ServeContent(w, r, r.URL.Path, fi.ModTime, rs)
 	} else {
 		if r.Method != http.MethodHead {
@@ -115,31 +430,74 @@ func (b *backend) HeadGet(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+func (b *backend) writeCacheHeaders(w http.ResponseWriter, fi *FileInfo) {
+	if b.CacheControl == nil {
+		return
+	}
+	if v := b.CacheControl(fi); v != "" {
+		w.Header().Set("Cache-Control", v)
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+}
+
+// writeResponseHeaders adds the headers returned by ResponseHeaders to the
+// response.
+func (b *backend) writeResponseHeaders(r *http.Request, fi *FileInfo) {
+	if b.ResponseHeaders == nil {
+		return
+	}
+	for k, values := range b.ResponseHeaders(r, fi) {
+		for _, v := range values {
+			b.header.Add(k, v)
+		}
+	}
+}
+
 func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth internal.Depth) (*internal.MultiStatus, error) {
 	// TODO: use partial error Response on error
 
-	fi, err := b.FileSystem.Stat(r.Context(), r.URL.Path)
+	if depth == internal.DepthInfinity {
+		snap, release, err := b.snapshot(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		b = snap
+	}
+
+	fi, err := b.stat(r.Context(), r.URL.Path)
 	if err != nil {
 		return nil, err
 	}
+	b.writeResponseHeaders(r, fi)
 
 	var resps []internal.Response
 	if depth != internal.DepthZero && fi.IsDir {
-		children, err := b.FileSystem.ReadDir(r.Context(), r.URL.Path, depth == internal.DepthInfinity)
-		if err != nil {
+		children, err := b.readDir(r.Context(), r.URL.Path, depth == internal.DepthInfinity)
+		if err != nil && (len(children) == 0 || internal.StatusFromError(err) != http.StatusInsufficientStorage) {
 			return nil, err
 		}
 
+		if b.MaxPropFindResults > 0 && len(children) > b.MaxPropFindResults {
+			children = children[:b.MaxPropFindResults]
+			err = internal.NewNumberOfMatchesError()
+		}
+
 		resps = make([]internal.Response, len(children))
 		for i, child := range children {
-			resp, err := b.propFindFile(propfind, &child)
+			resp, err := b.propFindFile(r.Context(), propfind, &child)
 			if err != nil {
 				return nil, err
 			}
 			resps[i] = *resp
 		}
+
+		if err != nil {
+			// The listing has been truncated
+			resps = append(resps, *internal.NewErrorResponse(fi.Path, err))
+		}
 	} else {
-		resp, err := b.propFindFile(propfind, fi)
+		resp, err := b.propFindFile(r.Context(), propfind, fi)
 		if err != nil {
 			return nil, err
 		}
@@ -150,7 +508,11 @@ func (b *backend) PropFind(r *http.Request, propfind *internal.PropFind, depth i
 	return internal.NewMultiStatus(resps...), nil
 }
 
-func (b *backend) propFindFile(propfind *internal.PropFind, fi *FileInfo) (*internal.Response, error) {
+func (b *backend) propFindFile(ctx context.Context, propfind *internal.PropFind, fi *FileInfo) (*internal.Response, error) {
+	// Failing to read stored properties only fails the properties they
+	// override, the other ones are still returned
+	storeErr := b.applyProperties(ctx, fi)
+
 	props := make(map[xml.Name]internal.PropFindFunc)
 
 	props[internal.ResourceTypeName] = func(*internal.RawXMLValue) (interface{}, error) {
@@ -158,9 +520,18 @@ func (b *backend) propFindFile(propfind *internal.PropFind, fi *FileInfo) (*inte
 		if fi.IsDir {
 			types = append(types, internal.CollectionName)
 		}
+		if b.ResourceTypes != nil {
+			types = append(types, b.ResourceTypes(ctx, fi)...)
+		}
 		return internal.NewResourceType(types...), nil
 	}
 
+	if _, ok := b.FileSystem.(MemberCreator); ok && fi.IsDir {
+		props[internal.AddMemberName] = internal.PropFindValue(&internal.AddMember{
+			Href: internal.Href{Path: fi.Path},
+		})
+	}
+
 	if !fi.IsDir {
 		props[internal.GetContentLengthName] = internal.PropFindValue(&internal.GetContentLength{
 			Length: fi.Size,
@@ -172,19 +543,32 @@ func (b *backend) propFindFile(propfind *internal.PropFind, fi *FileInfo) (*inte
 			})
 		}
 
-		if fi.MIMEType != "" {
+		if storeErr != nil {
+			props[internal.GetContentTypeName] = func(*internal.RawXMLValue) (interface{}, error) {
+				return nil, storeErr
+			}
+		} else if fi.MIMEType != "" {
 			props[internal.GetContentTypeName] = internal.PropFindValue(&internal.GetContentType{
 				Type: fi.MIMEType,
 			})
 		}
 
-		if fi.ETag != "" {
-			props[internal.GetETagName] = internal.PropFindValue(&internal.GetETag{
-				ETag: internal.ETag(fi.ETag),
+	}
+
+	if fi.ETag != "" {
+		props[internal.GetETagName] = internal.PropFindValue(&internal.GetETag{
+			ETag: internal.ETag(fi.ETag),
+		})
+		if fi.IsDir {
+			props[internal.GetCTagName] = internal.PropFindValue(&internal.GetCTag{
+				CTag: internal.NormalizeETag(fi.ETag),
 			})
 		}
 	}
 
+	b.ownershipProps(ctx, fi, props)
+	b.metadataProps(ctx, propfind, fi, props)
+
 	return internal.NewPropFindResponse(fi.Path, propfind, props)
 }
 
@@ -196,32 +580,46 @@ func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*
 
 	resp := &internal.Response{Hrefs: []internal.Href{internal.Href{Path: fi.Path}}}
 
-	for _, set := range update.Set {
-		for _, raw := range set.Prop.Raw {
+	set := make(map[xml.Name]string)
+	var remove []xml.Name
+	for _, s := range update.Set {
+		for _, raw := range s.Prop.Raw {
 			xmlName, ok := raw.XMLName()
 			if !ok {
 				continue
 			}
 
+			code, value, err := b.propPatchSet(fi, &raw)
+			if err != nil {
+				return nil, err
+			} else if code == http.StatusOK {
+				set[xmlName] = value
+			}
+
 			emptyVal := internal.NewRawXMLElement(xmlName, nil, nil)
 
-			if err := resp.EncodeProp(http.StatusForbidden, emptyVal); err != nil {
+			if err := resp.EncodeProp(code, emptyVal); err != nil {
 				return nil, err
 			}
 		}
 
 	}
 
-	for _, remove := range update.Remove {
-		for _, raw := range remove.Prop.Raw {
+	for _, rm := range update.Remove {
+		for _, raw := range rm.Prop.Raw {
 			xmlName, ok := raw.XMLName()
 			if !ok {
 				continue
 			}
 
+			code := b.propPatchRemove(fi, xmlName)
+			if code == http.StatusOK {
+				remove = append(remove, xmlName)
+			}
+
 			emptyVal := internal.NewRawXMLElement(xmlName, nil, nil)
 
-			if err := resp.EncodeProp(http.StatusForbidden, emptyVal); err != nil {
+			if err := resp.EncodeProp(code, emptyVal); err != nil {
 				return nil, err
 			}
 		}
@@ -233,22 +631,45 @@ func (b *backend) PropPatch(r *http.Request, update *internal.PropertyUpdate) (*
 			"webdav: request missing properties to update")
 	}
 
+	if b.PropPatchDryRun != nil && b.PropPatchDryRun(r) {
+		return resp, nil
+	}
+
+	if internal.FailPropPatchDependencies(resp) || (len(set) == 0 && len(remove) == 0) {
+		return resp, nil
+	}
+	store := b.FileSystem.(PropertyStore)
+	if err := store.PatchProperties(r.Context(), fi.Path, set, remove); err != nil {
+		return nil, err
+	}
 	return resp, nil
 }
 
-func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
-	ifNoneMatch := ConditionalMatch(r.Header.Get("If-None-Match"))
-	ifMatch := ConditionalMatch(r.Header.Get("If-Match"))
-
-	opts := CreateOptions{
-		IfNoneMatch: ifNoneMatch,
-		IfMatch:     ifMatch,
+// putBody checks the quota and the digests of a PUT or POST request, and
+// returns its body.
+func (b *backend) putBody(r *http.Request) (io.ReadCloser, error) {
+	algs := b.DigestAlgorithms
+	if algs == nil {
+		algs = defaultDigestAlgorithms
 	}
-	fi, created, err := b.FileSystem.Create(r.Context(), r.URL.Path, r.Body, &opts)
+	digests, err := parseRequestDigests(r.Header, algs)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	body, err := quotaBody(r, b.FileSystem)
+	if err != nil {
+		return nil, err
 	}
 
+	if len(digests) > 0 {
+		return &digestVerifier{r: body, digests: digests}, nil
+	}
+	return body, nil
+}
+
+// writeFileHeaders sets the headers describing a file created by a PUT or
+// POST request.
+func (b *backend) writeFileHeaders(w http.ResponseWriter, fi *FileInfo) {
 	if fi.MIMEType != "" {
 		w.Header().Set("Content-Type", fi.MIMEType)
 	}
@@ -258,6 +679,27 @@ func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
 	if fi.ETag != "" {
 		w.Header().Set("ETag", internal.ETag(fi.ETag).String())
 	}
+}
+
+func (b *backend) Put(w http.ResponseWriter, r *http.Request) error {
+	ifNoneMatch := ConditionalMatch(r.Header.Get("If-None-Match"))
+	ifMatch := ConditionalMatch(r.Header.Get("If-Match"))
+
+	body, err := b.putBody(r)
+	if err != nil {
+		return err
+	}
+
+	opts := CreateOptions{
+		IfNoneMatch: ifNoneMatch,
+		IfMatch:     ifMatch,
+	}
+	fi, created, err := b.FileSystem.Create(r.Context(), r.URL.Path, body, &opts)
+	if err != nil {
+		return errInsufficientStorage(err)
+	}
+
+	b.writeFileHeaders(w, fi)
 
 	if created {
 		w.WriteHeader(http.StatusCreated)
@@ -290,27 +732,81 @@ func (b *backend) Mkcol(r *http.Request) error {
 	return err
 }
 
-func (b *backend) Copy(r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
+func (b *backend) Copy(w http.ResponseWriter, r *http.Request, dest *internal.Href, recursive, overwrite bool) (created bool, err error) {
 	options := CopyOptions{
 		NoRecursive: !recursive,
 		NoOverwrite: !overwrite,
+		Progress:    b.progressFunc(r),
 	}
 	created, err = b.FileSystem.Copy(r.Context(), r.URL.Path, dest.Path, &options)
 	if os.IsExist(err) {
 		return false, &internal.HTTPError{http.StatusPreconditionFailed, err}
+	} else if err != nil {
+		return false, partialErrorToMultiStatus(r, err)
 	}
-	return created, err
+	b.setDestHeaders(w, r, dest)
+	return created, nil
 }
 
-func (b *backend) Move(r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
+func (b *backend) Move(w http.ResponseWriter, r *http.Request, dest *internal.Href, overwrite bool) (created bool, err error) {
 	options := MoveOptions{
 		NoOverwrite: !overwrite,
+		Progress:    b.progressFunc(r),
 	}
 	created, err = b.FileSystem.Move(r.Context(), r.URL.Path, dest.Path, &options)
 	if os.IsExist(err) {
 		return false, &internal.HTTPError{http.StatusPreconditionFailed, err}
+	} else if err != nil {
+		return false, partialErrorToMultiStatus(r, err)
+	}
+	b.setDestHeaders(w, r, dest)
+	return created, nil
+}
+
+// setDestHeaders sets the ETag and Last-Modified headers of the destination
+// of a COPY or MOVE request, so that clients don't need an extra request to
+// find out the new ETag. The operation already succeeded at this point, so
+// failing to stat the destination isn't an error.
+func (b *backend) setDestHeaders(w http.ResponseWriter, r *http.Request, dest *internal.Href) {
+	fi, err := b.FileSystem.Stat(r.Context(), dest.Path)
+	if err != nil || fi.IsDir {
+		return
+	}
+	if !fi.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", fi.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if fi.ETag != "" {
+		w.Header().Set("ETag", internal.ETag(fi.ETag).String())
+	}
+}
+
+func (b *backend) progressFunc(r *http.Request) ProgressFunc {
+	if b.CopyMoveProgress == nil {
+		return nil
+	}
+	return func(name string, n int) {
+		b.CopyMoveProgress(r, name, n)
+	}
+}
+
+// partialErrorToMultiStatus converts a PartialError into a multistatus
+// listing the completed members, followed by the error for the request URI.
+func partialErrorToMultiStatus(r *http.Request, err error) error {
+	var partialErr *PartialError
+	if !errors.As(err, &partialErr) {
+		return err
+	}
+
+	resps := make([]internal.Response, 0, len(partialErr.Completed)+1)
+	for _, p := range partialErr.Completed {
+		resps = append(resps, *internal.NewOKResponse(p))
+	}
+	resps = append(resps, *internal.NewErrorResponse(r.URL.Path, partialErr.Err))
+
+	return &internal.MultiStatusError{
+		MultiStatus: internal.NewMultiStatus(resps...),
+		Err:         err,
 	}
-	return created, err
 }
 
 // BackendSuppliedHomeSet represents either a CalDAV calendar-home-set or a
@@ -383,5 +879,5 @@ func servePrincipalPropfind(w http.ResponseWriter, r *http.Request, options *Ser
 	}
 
 	ms := internal.NewMultiStatus(*resp)
-	return internal.ServeMultiStatus(w, ms)
+	return internal.ServePropFindMultiStatus(w, r, ms)
 }
@@ -0,0 +1,1843 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-webdav/internal"
+	"github.com/emersion/go-webdav/internal/xmltest"
+)
+
+func newTestFileSystem(t *testing.T, files map[string]string) LocalFileSystem {
+	dir := t.TempDir()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return LocalFileSystem(dir)
+}
+
+func serveTestRequest(h http.Handler, req *http.Request) (*http.Response, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	res := w.Result()
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(data)
+}
+
+func TestDirListing(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"dir/hello.txt":                        "Hello world",
+		"dir/<img src=x onerror=alert(1)>.txt": "",
+		"dir/sub/file":                         "",
+	})
+	h := &Handler{FileSystem: fs}
+
+	res, body := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/dir/", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET: got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("GET: got Content-Type %q, want text/html", ct)
+	}
+	for _, s := range []string{`href="/dir/hello.txt"`, `href="/dir/sub/"`, `href="/"`, ">11<"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("GET: listing doesn't contain %q:\n%v", s, body)
+		}
+	}
+	if strings.Contains(body, "<img") {
+		t.Errorf("GET: file name not escaped:\n%v", body)
+	}
+	if !strings.Contains(body, "&lt;img src=x onerror=alert(1)&gt;.txt") {
+		t.Errorf("GET: escaped file name missing:\n%v", body)
+	}
+
+	res, body = serveTestRequest(h, httptest.NewRequest(http.MethodHead, "/dir/", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD: got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+	if body != "" {
+		t.Errorf("HEAD: got non-empty body %q", body)
+	}
+}
+
+func TestDirListingTemplate(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"a": "",
+		"b": "",
+	})
+	tpl := template.Must(template.New("").Parse(`{{range .Entries}}[{{.Name}}]{{end}}`))
+	h := &Handler{FileSystem: fs, DirListingTemplate: tpl}
+
+	_, body := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/", nil))
+	if want := "[a][b]"; body != want {
+		t.Errorf("got %q, want %q", body, want)
+	}
+}
+
+func TestPropFindPreferMinimal(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"file": "data",
+	})
+	h := &Handler{FileSystem: fs}
+
+	propfind := `<?xml version="1.0" encoding="UTF-8"?>
+<propfind xmlns="DAV:">
+  <prop>
+    <getcontentlength/>
+    <displayname/>
+  </prop>
+</propfind>`
+
+	for _, tc := range []struct {
+		header, value string
+		minimal       bool
+	}{
+		{"", "", false},
+		{"Prefer", "return=minimal", true},
+		{"Prefer", "respond-async, return=minimal; foo", true},
+		{"Prefer", "return=representation", false},
+		{"Brief", "t", true},
+		{"Brief", "f", false},
+	} {
+		req := httptest.NewRequest("PROPFIND", "/file", strings.NewReader(propfind))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "0")
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		res, body := serveTestRequest(h, req)
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("%v %q: got status %v, want %v", tc.header, tc.value, res.StatusCode, http.StatusMultiStatus)
+		}
+
+		applied := tc.minimal && tc.header == "Prefer"
+		if got := res.Header.Get("Preference-Applied"); (got != "") != applied {
+			t.Errorf("%v %q: got Preference-Applied %q", tc.header, tc.value, got)
+		}
+		if !strings.Contains(body, "getcontentlength") {
+			t.Errorf("%v %q: getcontentlength missing:\n%v", tc.header, tc.value, body)
+		}
+		if strings.Contains(body, "404 Not Found") == tc.minimal {
+			t.Errorf("%v %q: unexpected 404 propstat presence:\n%v", tc.header, tc.value, body)
+		}
+	}
+}
+
+func TestCopyCancel(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"src/a": "a",
+		"src/b": "b",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var n int
+	h := &Handler{
+		FileSystem: fs,
+		CopyMoveProgress: func(r *http.Request, name string, i int) {
+			n = i
+			cancel()
+		},
+	}
+
+	req := httptest.NewRequest("COPY", "/src", nil).WithContext(ctx)
+	req.Header.Set("Destination", "/dst")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	if n != 1 {
+		t.Errorf("progress: got %v members, want 1", n)
+	}
+	xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/dst</href>`)
+	xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/src</href>`)
+}
+
+func TestPropFindContentLength(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"empty":    "",
+		"dir/file": "data",
+	})
+	h := &Handler{FileSystem: fs}
+
+	req := httptest.NewRequest("PROPFIND", "/empty", nil)
+	req.Header.Set("Depth", "0")
+	_, body := serveTestRequest(h, req)
+	xmltest.AssertContains(t, []byte(body), `<getcontentlength xmlns="DAV:">0</getcontentlength>`)
+
+	req = httptest.NewRequest("PROPFIND", "/dir/", nil)
+	req.Header.Set("Depth", "0")
+	_, body = serveTestRequest(h, req)
+	if strings.Contains(body, "getcontentlength") {
+		t.Errorf("directory: unexpected getcontentlength:\n%v", body)
+	}
+}
+
+func TestPutDigest(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"file": "old",
+	})
+	h := &Handler{FileSystem: fs}
+
+	for _, tc := range []struct {
+		header, value string
+		status        int
+	}{
+		// MD5 and SHA-256 of "new"
+		{"Content-MD5", "Iq9kXRhZy1ym2gxITx836g==", http.StatusNoContent},
+		{"Digest", "SHA-256=EVB6Di9eadXfpApiob17buV+a82FxnybhDGzb/8hxDc=", http.StatusNoContent},
+		{"Digest", "unknown=foo, md5=Iq9kXRhZy1ym2gxITx836g==", http.StatusNoContent},
+		{"Content-MD5", "AAAAAAAAAAAAAAAAAAAAAA==", http.StatusBadRequest},
+		{"Digest", "SHA-256=AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", http.StatusBadRequest},
+		{"Digest", "SHA-256=!", http.StatusBadRequest},
+	} {
+		if err := os.WriteFile(filepath.Join(string(fs), "file"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodPut, "/file", strings.NewReader("new"))
+		req.Header.Set(tc.header, tc.value)
+		res, body := serveTestRequest(h, req)
+		if res.StatusCode != tc.status {
+			t.Errorf("%v %q: got status %v, want %v: %v", tc.header, tc.value, res.StatusCode, tc.status, body)
+		}
+
+		want := "new"
+		if tc.status == http.StatusBadRequest {
+			want = "old"
+		}
+		if data, _ := os.ReadFile(filepath.Join(string(fs), "file")); string(data) != want {
+			t.Errorf("%v %q: got file contents %q, want %q", tc.header, tc.value, data, want)
+		}
+	}
+}
+
+func TestPutDigestUnsupportedAlgorithm(t *testing.T) {
+	fs := newTestFileSystem(t, nil)
+	h := &Handler{FileSystem: fs, DigestAlgorithms: []DigestAlgorithm{"SHA-512", DigestMD5}}
+
+	req := httptest.NewRequest(http.MethodPut, "/file", strings.NewReader("new"))
+	req.Header.Set("Digest", "SHA-512=AAAA, MD5=Iq9kXRhZy1ym2gxITx836g==")
+	if res, body := serveTestRequest(h, req); res.StatusCode != http.StatusCreated {
+		t.Errorf("got status %v, want %v: %v", res.StatusCode, http.StatusCreated, body)
+	}
+}
+
+func TestClientUpload(t *testing.T) {
+	fs := newTestFileSystem(t, nil)
+	var digest string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		digest = r.Header.Get("Digest")
+		(&Handler{FileSystem: fs}).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := UploadOptions{DigestAlgorithms: []DigestAlgorithm{DigestMD5, DigestSHA256}}
+	fi, err := c.Upload(context.Background(), "/file", strings.NewReader("new"), &opts)
+	if err != nil {
+		t.Fatalf("Upload() = %v", err)
+	}
+	if want := "MD5=Iq9kXRhZy1ym2gxITx836g==,SHA-256=EVB6Di9eadXfpApiob17buV+a82FxnybhDGzb/8hxDc="; digest != want {
+		t.Errorf("got Digest %q, want %q", digest, want)
+	}
+	if fi.ETag == "" || fi.Size != 3 {
+		t.Errorf("Upload() = %+v", fi)
+	}
+	if data, _ := os.ReadFile(filepath.Join(string(fs), "file")); string(data) != "new" {
+		t.Errorf("got file contents %q, want %q", data, "new")
+	}
+
+	opts = UploadOptions{DigestAlgorithms: []DigestAlgorithm{"SHA-512"}}
+	if _, err := c.Upload(context.Background(), "/file", strings.NewReader("new"), &opts); err == nil {
+		t.Errorf("Upload() with an unsupported digest algorithm succeeded")
+	}
+}
+
+func TestPropFindResourceType(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"cal/event.ics": "",
+		"dir/file":      "",
+	})
+	calendarName := xml.Name{Space: "urn:ietf:params:xml:ns:caldav", Local: "calendar"}
+	h := &Handler{
+		FileSystem: fs,
+		ResourceTypes: func(ctx context.Context, fi *FileInfo) []xml.Name {
+			if fi.IsDir && strings.TrimSuffix(fi.Path, "/") == "/cal" {
+				return []xml.Name{calendarName}
+			}
+			return nil
+		},
+	}
+
+	for path, want := range map[string]string{
+		"/cal/":          `<resourcetype xmlns="DAV:"><collection/><calendar xmlns="urn:ietf:params:xml:ns:caldav"/></resourcetype>`,
+		"/dir/":          `<resourcetype xmlns="DAV:"><collection/></resourcetype>`,
+		"/cal/event.ics": `<resourcetype xmlns="DAV:"></resourcetype>`,
+	} {
+		req := httptest.NewRequest("PROPFIND", path, nil)
+		req.Header.Set("Depth", "0")
+		_, body := serveTestRequest(h, req)
+		xmltest.AssertContains(t, []byte(body), want)
+	}
+}
+
+func TestPutETag(t *testing.T) {
+	fs := newTestFileSystem(t, nil)
+	h := &Handler{FileSystem: fs}
+
+	res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("data")))
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("PUT: missing ETag header")
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/file.txt", strings.NewReader(`<propfind xmlns="DAV:"><prop><getetag/></prop></propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	_, body := serveTestRequest(h, req)
+
+	var ms internal.MultiStatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("PROPFIND: failed to decode response: %v", err)
+	} else if len(ms.Responses) != 1 {
+		t.Fatalf("PROPFIND: got %v responses, want 1", len(ms.Responses))
+	}
+	var getETag internal.GetETag
+	if err := ms.Responses[0].DecodeProp(&getETag); err != nil {
+		t.Fatalf("PROPFIND: failed to decode getetag: %v", err)
+	}
+	if got := getETag.ETag.String(); got != etag {
+		t.Errorf("PROPFIND: got getetag %v, want %v", got, etag)
+	}
+}
+
+func TestETagRoundTrip(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"file.txt": "data"})
+	h := &Handler{FileSystem: fs}
+
+	req := httptest.NewRequest("PROPFIND", "/file.txt", strings.NewReader(`<propfind xmlns="DAV:"><prop><getetag/></prop></propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	_, body := serveTestRequest(h, req)
+
+	var ms internal.MultiStatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("PROPFIND: failed to decode response: %v", err)
+	} else if len(ms.Responses) != 1 {
+		t.Fatalf("PROPFIND: got %v responses, want 1", len(ms.Responses))
+	}
+	var getETag struct {
+		XMLName xml.Name `xml:"DAV: getetag"`
+		Value   string   `xml:",chardata"`
+	}
+	if err := ms.Responses[0].DecodeProp(&getETag); err != nil {
+		t.Fatalf("PROPFIND: failed to decode getetag: %v", err)
+	}
+	etag := getETag.Value
+
+	res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodHead, "/file.txt", nil))
+	if got := res.Header.Get("ETag"); got != etag {
+		t.Errorf("HEAD: got ETag %q, want getetag %q", got, etag)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("other"))
+	req.Header.Set("If-Match", `"mismatch"`)
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with mismatched If-Match: got status %v, want %v", res.StatusCode, http.StatusPreconditionFailed)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/file.txt", strings.NewReader("new data"))
+	req.Header.Set("If-Match", etag)
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusNoContent {
+		t.Errorf("PUT with If-Match from getetag: got status %v, want %v", res.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestPropFindCollectionETag(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"dir/sub/file": "data"})
+	h := &Handler{FileSystem: fs}
+
+	fi, err := fs.Stat(context.Background(), "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/dir/", strings.NewReader(`<propfind xmlns="DAV:" xmlns:cs="http://calendarserver.org/ns/"><prop><getetag/><cs:getctag/></prop></propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	_, body := serveTestRequest(h, req)
+
+	xmltest.AssertContains(t, []byte(body), `<getetag xmlns="DAV:">"`+fi.ETag+`"</getetag>`)
+	xmltest.AssertContains(t, []byte(body), `<getctag xmlns="http://calendarserver.org/ns/">`+fi.ETag+`</getctag>`)
+
+	// The Handler keeps track of the updates of descendants across requests
+	if res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodPut, "/dir/sub/file", strings.NewReader("new"))); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT: got status %v, want %v", res.StatusCode, http.StatusNoContent)
+	}
+	req = httptest.NewRequest("PROPFIND", "/", strings.NewReader(`<propfind xmlns="DAV:" xmlns:cs="http://calendarserver.org/ns/"><prop><cs:getctag/></prop></propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+	_, body = serveTestRequest(h, req)
+	if strings.Contains(body, fi.ETag) {
+		t.Errorf("PROPFIND: getctag of %q unchanged after PUT:\n%v", "/dir/", body)
+	}
+}
+
+func TestDeleteDepthZero(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"file": "data"})
+	h := &Handler{FileSystem: fs}
+
+	req := httptest.NewRequest(http.MethodDelete, "/file", nil)
+	req.Header.Set("Depth", "0")
+	if res, body := serveTestRequest(h, req); res.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %v, want %v: %v", res.StatusCode, http.StatusNoContent, body)
+	}
+	if _, err := os.Stat(filepath.Join(string(fs), "file")); !os.IsNotExist(err) {
+		t.Errorf("Stat() = %v, want not found", err)
+	}
+}
+
+func TestCopyMoveOverwrite(t *testing.T) {
+	for _, tc := range []struct {
+		overwrite string
+		status    int
+		dst       string
+	}{
+		{"", http.StatusNoContent, "src"},
+		{"T", http.StatusNoContent, "src"},
+		{"F", http.StatusPreconditionFailed, "dst"},
+		{"yes", http.StatusBadRequest, "dst"},
+	} {
+		for _, method := range []string{"COPY", "MOVE"} {
+			fs := newTestFileSystem(t, map[string]string{"src": "src", "dst": "dst"})
+			h := &Handler{FileSystem: fs}
+
+			req := httptest.NewRequest(method, "/src", nil)
+			req.Header.Set("Destination", "/dst")
+			if tc.overwrite != "" {
+				req.Header.Set("Overwrite", tc.overwrite)
+			}
+			res, _ := serveTestRequest(h, req)
+			if res.StatusCode != tc.status {
+				t.Errorf("%v with Overwrite %q: got status %v, want %v", method, tc.overwrite, res.StatusCode, tc.status)
+			}
+			if _, body := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/dst", nil)); body != tc.dst {
+				t.Errorf("%v with Overwrite %q: got destination %q, want %q", method, tc.overwrite, body, tc.dst)
+			}
+		}
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"dir/file": "data",
+	})
+	h := StripPrefix("/dav/", &Handler{FileSystem: fs})
+
+	req := httptest.NewRequest("PROPFIND", "/dav/dir/", nil)
+	req.Header.Set("Depth", "1")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/dav/dir</href>`)
+	xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/dav/dir/file</href>`)
+
+	req = httptest.NewRequest("COPY", "/dav/dir/file", nil)
+	req.Header.Set("Destination", "http://example.com/dav/copy")
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusCreated {
+		t.Errorf("COPY: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if _, err := os.Stat(filepath.Join(string(fs), "copy")); err != nil {
+		t.Errorf("COPY: %v", err)
+	}
+
+	req = httptest.NewRequest("COPY", "/dav/dir/file", nil)
+	req.Header.Set("Destination", "http://example.com/other/copy")
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("COPY outside of prefix: got status %v, want %v", res.StatusCode, http.StatusBadGateway)
+	}
+
+	if res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/dir/file", nil)); res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET outside of prefix: got status %v, want %v", res.StatusCode, http.StatusNotFound)
+	}
+
+	_, body = serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/dav/dir/", nil))
+	for _, s := range []string{`href="/dav/dir/file"`, `href="/dav/"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("GET: listing doesn't contain %q:\n%v", s, body)
+		}
+	}
+}
+
+func TestStripPrefixEscaped(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"dir/file": "data",
+	})
+	h := StripPrefix("/my dav&co", &Handler{FileSystem: fs})
+
+	req := httptest.NewRequest("PROPFIND", "/my%20dav&co/dir/", nil)
+	req.Header.Set("Depth", "1")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/my%20dav&amp;co/dir/file</href>`)
+
+	_, body = serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/my%20dav&co/dir/", nil))
+	for _, s := range []string{`href="/my%20dav&amp;co/dir/file"`, `href="/my%20dav&amp;co/"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("GET: listing doesn't contain %q:\n%v", s, body)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"file": "data"})
+	h := &Handler{
+		FileSystem: fs,
+		CORS:       &CORSOptions{AllowedOrigins: []string{"https://example.org"}},
+	}
+
+	req := httptest.NewRequest(http.MethodOptions, "/file", nil)
+	req.Header.Set("Origin", "https://example.org")
+	req.Header.Set("Access-Control-Request-Method", "PROPFIND")
+	res, _ := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("preflight: got status %v, want %v", res.StatusCode, http.StatusNoContent)
+	}
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "https://example.org" {
+		t.Errorf("preflight: got Access-Control-Allow-Origin %q", got)
+	}
+	if got := res.Header.Get("Access-Control-Allow-Methods"); !strings.Contains(got, "PROPFIND") || !strings.Contains(got, "REPORT") {
+		t.Errorf("preflight: got Access-Control-Allow-Methods %q", got)
+	}
+	if got := res.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Depth") {
+		t.Errorf("preflight: got Access-Control-Allow-Headers %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set("Origin", "https://example.org")
+	res, _ = serveTestRequest(h, req)
+	if got := res.Header.Get("Access-Control-Expose-Headers"); !strings.Contains(got, "ETag") || !strings.Contains(got, "DAV") {
+		t.Errorf("GET: got Access-Control-Expose-Headers %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/file", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	res, _ = serveTestRequest(h, req)
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("GET from disallowed origin: got Access-Control-Allow-Origin %q", got)
+	}
+	if got := res.Header.Get("Vary"); got != "Origin" {
+		t.Errorf("GET: got Vary %q, want %q", got, "Origin")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	h := &Handler{FileSystem: newTestFileSystem(t, nil)}
+	if err := h.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck() = %v", err)
+	}
+
+	h = &Handler{FileSystem: LocalFileSystem(filepath.Join(t.TempDir(), "missing"))}
+	if err := h.HealthCheck(context.Background()); err == nil {
+		t.Errorf("HealthCheck() on missing root succeeded")
+	}
+}
+
+func TestEncodedPaths(t *testing.T) {
+	names := []string{"with space.txt", "a+b.txt", "ünïcødé.txt", "100%.txt"}
+	files := make(map[string]string)
+	for _, name := range names {
+		files[name] = name
+	}
+	h := &Handler{FileSystem: newTestFileSystem(t, files)}
+
+	for _, name := range names {
+		href := (&url.URL{Path: "/" + name}).String()
+		res, body := serveTestRequest(h, httptest.NewRequest(http.MethodGet, href, nil))
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("GET %v: got status %v, want %v", href, res.StatusCode, http.StatusOK)
+		} else if body != name {
+			t.Errorf("GET %v: got body %q, want %q", href, body, name)
+		}
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.Header.Set("Depth", "1")
+	_, body := serveTestRequest(h, req)
+	for _, href := range []string{"/with%20space.txt", "/a+b.txt", "/%C3%BCn%C3%AFc%C3%B8d%C3%A9.txt", "/100%25.txt"} {
+		xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">`+href+`</href>`)
+	}
+
+	req = httptest.NewRequest("COPY", "/with%20space.txt", nil)
+	req.Header.Set("Destination", "/copy%20%C3%BC+.txt")
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusCreated {
+		t.Errorf("COPY: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if res, body := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/copy%20%C3%BC+.txt", nil)); res.StatusCode != http.StatusOK || body != "with space.txt" {
+		t.Errorf("GET copy: got status %v, body %q", res.StatusCode, body)
+	}
+}
+
+func TestPropPatchFailedDependency(t *testing.T) {
+	resp := internal.NewOKResponse("/file")
+	resp.EncodeProp(http.StatusOK, internal.NewRawXMLElement(xml.Name{Space: "DAV:", Local: "displayname"}, nil, nil))
+	resp.EncodeProp(http.StatusForbidden, internal.NewRawXMLElement(xml.Name{Space: "DAV:", Local: "owner"}, nil, nil))
+
+	internal.FailPropPatchDependencies(resp)
+
+	got := make(map[int]bool)
+	for _, propstat := range resp.PropStats {
+		got[propstat.Status.Code] = true
+	}
+	if len(got) != 2 || !got[http.StatusForbidden] || !got[http.StatusFailedDependency] {
+		t.Errorf("got statuses %v, want 403 and 424", got)
+	}
+}
+
+type diskFullFileSystem struct {
+	LocalFileSystem
+	quota *Quota
+}
+
+func (fs diskFullFileSystem) Create(ctx context.Context, name string, body io.ReadCloser, opts *CreateOptions) (*FileInfo, bool, error) {
+	return nil, false, &os.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+}
+
+func (fs diskFullFileSystem) Quota(ctx context.Context, name string) (*Quota, error) {
+	return fs.quota, nil
+}
+
+func TestPutInsufficientStorage(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		quota        Quota
+		precondition string
+	}{
+		{"disk full", Quota{Available: -1}, `<sufficient-disk-space xmlns="DAV:"/>`},
+		{"quota exceeded", Quota{Available: 2, Used: 10}, `<quota-not-exceeded xmlns="DAV:"/>`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := diskFullFileSystem{newTestFileSystem(t, nil), &tc.quota}
+			h := &Handler{FileSystem: fs}
+
+			res, body := serveTestRequest(h, httptest.NewRequest(http.MethodPut, "/file", strings.NewReader("data")))
+			if res.StatusCode != http.StatusInsufficientStorage {
+				t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusInsufficientStorage)
+			}
+			xmltest.AssertContains(t, []byte(body), tc.precondition)
+		})
+	}
+}
+
+func TestPropFindTruncated(t *testing.T) {
+	dir := string(newTestFileSystem(t, map[string]string{"a": "", "b": "", "c": ""}))
+	h := &Handler{FileSystem: NewLocalFileSystem(dir, &LocalFileSystemOptions{MaxReadDirEntries: 2})}
+
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.Header.Set("Depth", "infinity")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	xmltest.AssertContains(t, []byte(body), `<status xmlns="DAV:">HTTP/1.1 507 Insufficient Storage</status>`)
+}
+
+func TestDebug(t *testing.T) {
+	var buf strings.Builder
+	h := &Handler{
+		FileSystem: newTestFileSystem(t, map[string]string{"file": "file contents"}),
+		Debug: &DebugOptions{
+			Match: func(r *http.Request) bool {
+				return r.Header.Get("User-Agent") == "buggy-client"
+			},
+			Writer: &buf,
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/new", strings.NewReader("request body"))
+	req.Header.Set("User-Agent", "buggy-client")
+	req.Header.Set("Authorization", "Basic c2VjcmV0")
+	serveTestRequest(h, req)
+
+	req = httptest.NewRequest(http.MethodGet, "/file", nil)
+	serveTestRequest(h, req)
+
+	got := buf.String()
+	for _, s := range []string{"PUT /new HTTP/1.1", "Authorization: [redacted]", "request body", "HTTP/1.1 201 Created"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("capture doesn't contain %q:\n%v", s, got)
+		}
+	}
+	for _, s := range []string{"c2VjcmV0", "file contents"} {
+		if strings.Contains(got, s) {
+			t.Errorf("capture contains %q:\n%v", s, got)
+		}
+	}
+}
+
+func TestSyntheticRoot(t *testing.T) {
+	fs := LocalFileSystem(filepath.Join(t.TempDir(), "missing"))
+
+	for _, synthetic := range []bool{false, true} {
+		h := &Handler{FileSystem: fs, SyntheticRoot: synthetic}
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.Header.Set("Depth", "1")
+		res, body := serveTestRequest(h, req)
+		if !synthetic {
+			if res.StatusCode != http.StatusNotFound {
+				t.Errorf("PROPFIND without synthetic root: got status %v, want %v", res.StatusCode, http.StatusNotFound)
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("PROPFIND: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+		}
+		xmltest.AssertContains(t, []byte(body), `<href xmlns="DAV:">/</href>`)
+		xmltest.AssertContains(t, []byte(body), `<resourcetype xmlns="DAV:"><collection/></resourcetype>`)
+	}
+}
+
+func TestGetConditional(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"file": "data"})
+	fi, err := fs.Stat(context.Background(), "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := internal.ETag(fi.ETag).String()
+	h := &Handler{FileSystem: fs}
+
+	for _, tc := range []struct {
+		header, value string
+		want          int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"other"`, http.StatusOK},
+		{"If-None-Match", "*", http.StatusNotModified},
+		{"If-Match", etag, http.StatusOK},
+		{"If-Match", `"other"`, http.StatusPreconditionFailed},
+		{"If-Modified-Since", fi.ModTime.Add(time.Hour).UTC().Format(http.TimeFormat), http.StatusNotModified},
+		{"If-Modified-Since", fi.ModTime.Add(-time.Hour).UTC().Format(http.TimeFormat), http.StatusOK},
+		{"If-Unmodified-Since", fi.ModTime.Add(-time.Hour).UTC().Format(http.TimeFormat), http.StatusPreconditionFailed},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/file", nil)
+		req.Header.Set(tc.header, tc.value)
+		res, _ := serveTestRequest(h, req)
+		if res.StatusCode != tc.want {
+			t.Errorf("%v: %v: got status %v, want %v", tc.header, tc.value, res.StatusCode, tc.want)
+		}
+		if res.StatusCode == http.StatusNotModified && res.Header.Get("ETag") != etag {
+			t.Errorf("%v: %v: got ETag %q, want %q", tc.header, tc.value, res.Header.Get("ETag"), etag)
+		}
+	}
+}
+
+type openCountingFileSystem struct {
+	LocalFileSystem
+	opens int
+}
+
+func (fs *openCountingFileSystem) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	fs.opens++
+	return fs.LocalFileSystem.Open(ctx, name)
+}
+
+func TestHead(t *testing.T) {
+	fs := &openCountingFileSystem{LocalFileSystem: newTestFileSystem(t, map[string]string{"file.txt": "data"})}
+	h := &Handler{FileSystem: fs}
+
+	res, body := serveTestRequest(h, httptest.NewRequest(http.MethodHead, "/file.txt", nil))
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD: got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+	if body != "" {
+		t.Errorf("HEAD: got body %q", body)
+	}
+	for k, want := range map[string]string{"Content-Length": "4", "Content-Type": "text/plain; charset=utf-8"} {
+		if got := res.Header.Get(k); got != want {
+			t.Errorf("HEAD: got %v %q, want %q", k, got, want)
+		}
+	}
+	for _, k := range []string{"ETag", "Last-Modified"} {
+		if res.Header.Get(k) == "" {
+			t.Errorf("HEAD: missing %v header", k)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodHead, "/file.txt", nil)
+	req.Header.Set("If-None-Match", res.Header.Get("ETag"))
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional HEAD: got status %v, want %v", res.StatusCode, http.StatusNotModified)
+	}
+
+	if fs.opens != 0 {
+		t.Errorf("HEAD opened the file %v times", fs.opens)
+	}
+}
+
+type blockingFileSystem struct {
+	LocalFileSystem
+	entered chan struct{}
+	unblock chan struct{}
+}
+
+func (fs *blockingFileSystem) ReadDir(ctx context.Context, name string, recursive bool) ([]FileInfo, error) {
+	fs.entered <- struct{}{}
+	<-fs.unblock
+	return fs.LocalFileSystem.ReadDir(ctx, name, recursive)
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	fs := &blockingFileSystem{
+		LocalFileSystem: newTestFileSystem(t, map[string]string{"file": "data"}),
+		entered:         make(chan struct{}),
+		unblock:         make(chan struct{}),
+	}
+	h := &Handler{
+		FileSystem:                     fs,
+		MaxConcurrentRequests:          2,
+		MaxConcurrentExpensiveRequests: 1,
+		RetryAfter:                     5 * time.Second,
+	}
+	newPropFind := func() *http.Request {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.Header.Set("Depth", "1")
+		return req
+	}
+
+	done := make(chan int)
+	go func() {
+		res, _ := serveTestRequest(h, newPropFind())
+		done <- res.StatusCode
+	}()
+	<-fs.entered
+
+	res, _ := serveTestRequest(h, newPropFind())
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second PROPFIND: got status %v, want %v", res.StatusCode, http.StatusServiceUnavailable)
+	}
+	if got := res.Header.Get("Retry-After"); got != "5" {
+		t.Errorf("second PROPFIND: got Retry-After %q, want %q", got, "5")
+	}
+
+	if res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/file", nil)); res.StatusCode != http.StatusOK {
+		t.Errorf("GET: got status %v, want %v", res.StatusCode, http.StatusOK)
+	}
+
+	close(fs.unblock)
+	if code := <-done; code != http.StatusMultiStatus {
+		t.Errorf("first PROPFIND: got status %v, want %v", code, http.StatusMultiStatus)
+	}
+	go func() { <-fs.entered }()
+	if res, _ := serveTestRequest(h, newPropFind()); res.StatusCode != http.StatusMultiStatus {
+		t.Errorf("PROPFIND after release: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+}
+
+func TestClientConnectionReuse(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("dir/file%v", i)] = ""
+	}
+	ts := httptest.NewUnstartedServer(&Handler{FileSystem: newTestFileSystem(t, files)})
+	var conns int32
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client, err := NewClient(NewHTTPClient(&HTTPClientOptions{MaxIdleConnsPerHost: 4}), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if _, err := client.ReadDir(ctx, "/dir", false); err != nil {
+			t.Fatalf("ReadDir() = %v", err)
+		}
+		if _, err := client.Stat(ctx, "/missing"); err == nil {
+			t.Fatalf("Stat(/missing) succeeded")
+		}
+	}
+	if err := client.Mkdir(ctx, "/new"); err != nil {
+		t.Fatalf("Mkdir() = %v", err)
+	}
+
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("client opened %v connections, want 1", n)
+	}
+}
+
+func TestMoveETag(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"a/file.txt": "data",
+		"b/other":    "",
+	})
+	h := &Handler{FileSystem: fs}
+
+	for _, tc := range []struct{ name, src, dest string }{
+		{"rename", "/a/file.txt", "/a/renamed.txt"},
+		{"move across collections", "/a/renamed.txt", "/b/file.txt"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fi, err := fs.Stat(context.Background(), tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("MOVE", tc.src, nil)
+			req.Header.Set("Destination", tc.dest)
+			res, _ := serveTestRequest(h, req)
+			if res.StatusCode != http.StatusCreated {
+				t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusCreated)
+			}
+			if got, want := res.Header.Get("ETag"), internal.ETag(fi.ETag).String(); got != want {
+				t.Errorf("got ETag %v, want %v", got, want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("COPY", "/b/file.txt", nil)
+	req.Header.Set("Destination", "/b/copy.txt")
+	res, _ := serveTestRequest(h, req)
+	fi, err := fs.Stat(context.Background(), "/b/copy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res.Header.Get("ETag"), internal.ETag(fi.ETag).String(); got != want {
+		t.Errorf("COPY: got ETag %v, want %v", got, want)
+	}
+}
+
+func TestMaxPropFindResults(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"a": "", "b": "", "c": ""})
+	h := &Handler{FileSystem: fs, MaxPropFindResults: 2}
+
+	req := httptest.NewRequest("PROPFIND", "/", nil)
+	req.Header.Set("Depth", "1")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+
+	var ms internal.MultiStatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatal(err)
+	}
+	if len(ms.Responses) != 3 {
+		t.Fatalf("got %v responses, want 2 results and a truncation error", len(ms.Responses))
+	}
+	last := ms.Responses[2]
+	if last.Status == nil || last.Status.Code != http.StatusInsufficientStorage {
+		t.Errorf("last response has status %v, want %v", last.Status, http.StatusInsufficientStorage)
+	}
+	xmltest.AssertContains(t, []byte(body), `<error xmlns="DAV:"><number-of-matches-within-limits/></error>`)
+}
+
+type propertyFileSystem struct {
+	LocalFileSystem
+	props map[string]map[xml.Name]string
+	err   error
+}
+
+func (fs *propertyFileSystem) Properties(ctx context.Context, name string) (map[xml.Name]string, error) {
+	return fs.props[name], fs.err
+}
+
+func (fs *propertyFileSystem) PatchProperties(ctx context.Context, name string, set map[xml.Name]string, remove []xml.Name) error {
+	if fs.props[name] == nil {
+		fs.props[name] = make(map[xml.Name]string)
+	}
+	for k, v := range set {
+		fs.props[name][k] = v
+	}
+	for _, k := range remove {
+		delete(fs.props[name], k)
+	}
+	return nil
+}
+
+func TestPropPatchContentType(t *testing.T) {
+	fs := &propertyFileSystem{
+		LocalFileSystem: newTestFileSystem(t, map[string]string{"photo.mov": "data"}),
+		props:           make(map[string]map[xml.Name]string),
+	}
+	dryRun := false
+	h := &Handler{
+		FileSystem:      fs,
+		PropPatchDryRun: func(r *http.Request) bool { return dryRun },
+	}
+
+	propPatch := func(body string) string {
+		req := httptest.NewRequest("PROPPATCH", "/photo.mov", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		res, respBody := serveTestRequest(h, req)
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("PROPPATCH: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+		}
+		return respBody
+	}
+	contentType := func() string {
+		res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/photo.mov", nil))
+		return res.Header.Get("Content-Type")
+	}
+	const setHEIC = `<propertyupdate xmlns="DAV:"><set><prop><getcontenttype>image/heic</getcontenttype></prop></set></propertyupdate>`
+
+	detected := contentType()
+
+	dryRun = true
+	body := propPatch(setHEIC)
+	xmltest.AssertContains(t, []byte(body), `<status xmlns="DAV:">HTTP/1.1 200 OK</status>`)
+	if got := contentType(); got != detected {
+		t.Errorf("dry-run PROPPATCH changed the content type to %q", got)
+	}
+	dryRun = false
+
+	body = propPatch(`<propertyupdate xmlns="DAV:"><set><prop><getcontenttype>image/heic</getcontenttype><displayname>x</displayname></prop></set></propertyupdate>`)
+	xmltest.AssertContains(t, []byte(body), `<status xmlns="DAV:">HTTP/1.1 424 Failed Dependency</status>`)
+	if got := contentType(); got != detected {
+		t.Errorf("failed PROPPATCH changed the content type to %q", got)
+	}
+
+	propPatch(setHEIC)
+	if got := contentType(); got != "image/heic" {
+		t.Errorf("GET: got Content-Type %q, want %q", got, "image/heic")
+	}
+	req := httptest.NewRequest("PROPFIND", "/photo.mov", nil)
+	req.Header.Set("Depth", "0")
+	_, body = serveTestRequest(h, req)
+	xmltest.AssertContains(t, []byte(body), `<getcontenttype xmlns="DAV:">image/heic</getcontenttype>`)
+
+	propPatch(`<propertyupdate xmlns="DAV:"><remove><prop><getcontenttype/></prop></remove></propertyupdate>`)
+	if got := contentType(); got != detected {
+		t.Errorf("GET after remove: got Content-Type %q, want %q", got, detected)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"/IMG_0001.heic": "x", "/inline.txt": "y"})
+	h := &Handler{
+		FileSystem: fs,
+		ContentDisposition: func(fi *FileInfo) (string, string) {
+			if path.Base(fi.Path) == "inline.txt" {
+				return "inline", "inline.txt"
+			}
+			return "attachment", "Café à Paris.heic"
+		},
+	}
+
+	for _, tc := range []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/IMG_0001.heic", `attachment; filename*=utf-8''Caf%C3%A9%20%C3%A0%20Paris.heic`},
+		{http.MethodHead, "/IMG_0001.heic", `attachment; filename*=utf-8''Caf%C3%A9%20%C3%A0%20Paris.heic`},
+		{http.MethodGet, "/inline.txt", `inline; filename=inline.txt`},
+	} {
+		res, _ := serveTestRequest(h, httptest.NewRequest(tc.method, tc.path, nil))
+		if got := res.Header.Get("Content-Disposition"); got != tc.want {
+			t.Errorf("%v %v: got Content-Disposition %q, want %q", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestGetMultipartRanges(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	h := &Handler{FileSystem: newTestFileSystem(t, map[string]string{"file.txt": data})}
+
+	req := httptest.NewRequest(http.MethodGet, "/file.txt", nil)
+	req.Header.Set("Range", "bytes=0-3,10-12,18-")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusPartialContent {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusPartialContent)
+	}
+	if got, want := res.Header.Get("Content-Length"), strconv.Itoa(len(body)); got != want {
+		t.Errorf("got Content-Length %v, want %v", got, want)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" || params["boundary"] == "" {
+		t.Fatalf("got Content-Type %q, want multipart/byteranges with a boundary", res.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		b, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+
+		var start, end, size int
+		if _, err := fmt.Sscanf(part.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+			t.Fatalf("malformed Content-Range %q: %v", part.Header.Get("Content-Range"), err)
+		}
+		if size != len(data) || string(b) != data[start:end+1] {
+			t.Errorf("part with Content-Range %q contains %q", part.Header.Get("Content-Range"), b)
+		}
+		if got := part.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+			t.Errorf("part with Content-Range %q has Content-Type %q", part.Header.Get("Content-Range"), got)
+		}
+		parts = append(parts, string(b))
+	}
+	if got, want := strings.Join(parts, ","), "0123,abc,ij"; got != want {
+		t.Errorf("got parts %q, want %q", got, want)
+	}
+}
+
+func TestConditionalMatchETag(t *testing.T) {
+	// See the examples in RFC 7232 section 2.3.2
+	for _, tc := range []struct {
+		header       string
+		etag         string
+		strong, weak bool
+	}{
+		{`W/"1"`, "1", false, true},
+		{`"1"`, "1", true, true},
+		{`W/"2"`, "1", false, false},
+		{`"2"`, "1", false, false},
+		{`"2", W/"1"`, "1", false, true},
+		{`"2","1"`, "1", true, true},
+		{`*`, "1", true, true},
+		{`"1"`, "", false, false},
+		// Unquoted entity-tags sent by some clients
+		{`1`, "1", true, true},
+		{`W/1`, "1", false, true},
+		{`2, 1`, "1", true, true},
+		// Entity-tag already quoted by the FileSystem
+		{`"1"`, `"1"`, true, true},
+	} {
+		val := ConditionalMatch(tc.header)
+		if got, err := val.MatchETag(tc.etag); err != nil || got != tc.strong {
+			t.Errorf("ConditionalMatch(%q).MatchETag(%q) = %v, %v, want %v", tc.header, tc.etag, got, err, tc.strong)
+		}
+		if got, err := val.MatchETagWeak(tc.etag); err != nil || got != tc.weak {
+			t.Errorf("ConditionalMatch(%q).MatchETagWeak(%q) = %v, %v, want %v", tc.header, tc.etag, got, err, tc.weak)
+		}
+	}
+
+	for _, header := range []string{`"1`, `"2" "3"`} {
+		if _, err := ConditionalMatch(header).MatchETag("1"); err == nil {
+			t.Errorf("ConditionalMatch(%q).MatchETag: expected an error", header)
+		}
+	}
+}
+
+func TestRemoveAllBatch(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"dir/a":     "",
+		"dir/b":     "",
+		"dir/sub/c": "",
+		"other":     "",
+	})
+	srv := httptest.NewServer(StripPrefix("/dav", &Handler{FileSystem: fs}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.Client(), srv.URL+"/dav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := c.RemoveAllBatch(context.Background(), "dir/", []string{"dir/a", "dir/sub", "other"})
+	if err != nil {
+		t.Fatalf("RemoveAllBatch() = %v", err)
+	}
+	if len(errs) != 1 || errs["other"] == nil {
+		t.Errorf("RemoveAllBatch() = %v, want an error for other only", errs)
+	}
+
+	for name, exists := range map[string]bool{"dir/a": false, "dir/sub": false, "dir/b": true, "other": true} {
+		_, err := os.Stat(filepath.Join(string(fs), name))
+		if got := err == nil; got != exists {
+			t.Errorf("%v: got exists = %v, want %v", name, got, exists)
+		}
+	}
+}
+
+type ownershipFileSystem struct {
+	LocalFileSystem
+}
+
+func (fs ownershipFileSystem) Ownership(ctx context.Context, name string) (owner, group string, err error) {
+	return "/principals/alice/", "", nil
+}
+
+func TestPropFindOwnership(t *testing.T) {
+	local := newTestFileSystem(t, map[string]string{"file": ""})
+	const propfind = `<propfind xmlns="DAV:"><prop><owner/><group/></prop></propfind>`
+
+	for _, tc := range []struct {
+		name   string
+		fs     FileSystem
+		owner  string
+		group  string
+		status string
+	}{
+		{"provider", ownershipFileSystem{local}, `<owner xmlns="DAV:"><href>/principals/alice/</href></owner>`, `<group xmlns="DAV:"></group>`, "HTTP/1.1 200 OK"},
+		{"no provider", local, `<owner xmlns="DAV:"></owner>`, `<group xmlns="DAV:"></group>`, "HTTP/1.1 404 Not Found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("PROPFIND", "/file", strings.NewReader(propfind))
+			req.Header.Set("Depth", "0")
+			req.Header.Set("Content-Type", "application/xml")
+			res, body := serveTestRequest(&Handler{FileSystem: tc.fs}, req)
+			if res.StatusCode != http.StatusMultiStatus {
+				t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+			}
+			xmltest.AssertContains(t, []byte(body), tc.owner)
+			xmltest.AssertContains(t, []byte(body), tc.group)
+			xmltest.AssertContains(t, []byte(body), `<status xmlns="DAV:">`+tc.status+`</status>`)
+		})
+	}
+
+	// Ownership isn't part of allprop responses
+	req := httptest.NewRequest("PROPFIND", "/file", nil)
+	req.Header.Set("Depth", "0")
+	_, body := serveTestRequest(&Handler{FileSystem: ownershipFileSystem{local}}, req)
+	if strings.Contains(body, "owner") {
+		t.Errorf("allprop response contains the owner property:\n%v", body)
+	}
+}
+
+type memberFileSystem struct {
+	LocalFileSystem
+}
+
+func (fs memberFileSystem) CreateMember(ctx context.Context, collection string, body io.ReadCloser) (*FileInfo, error) {
+	fi, _, err := fs.Create(ctx, path.Join(collection, "new.txt"), body, &CreateOptions{IfNoneMatch: "*"})
+	return fi, err
+}
+
+func TestPostAddMember(t *testing.T) {
+	fs := memberFileSystem{newTestFileSystem(t, map[string]string{"dir/file": ""})}
+	h := StripPrefix("/dav", &Handler{FileSystem: fs})
+
+	res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodPost, "/dav/dir/", strings.NewReader("hello")))
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if loc := res.Header.Get("Location"); loc != "/dav/dir/new.txt" {
+		t.Errorf("POST: got Location %q, want %q", loc, "/dav/dir/new.txt")
+	}
+	if res.Header.Get("ETag") == "" {
+		t.Errorf("POST: missing ETag")
+	}
+	if data, _ := os.ReadFile(filepath.Join(string(fs.LocalFileSystem), "dir", "new.txt")); string(data) != "hello" {
+		t.Errorf("got file contents %q, want %q", data, "hello")
+	}
+
+	res, _ = serveTestRequest(h, httptest.NewRequest(http.MethodPost, "/dav/dir/file", strings.NewReader("hello")))
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST to a file: got status %v, want %v", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/dav/dir/", strings.NewReader(`<propfind xmlns="DAV:"><prop><add-member/></prop></propfind>`))
+	req.Header.Set("Depth", "0")
+	req.Header.Set("Content-Type", "application/xml")
+	_, body := serveTestRequest(h, req)
+	xmltest.AssertContains(t, []byte(body), `<add-member xmlns="DAV:"><href>/dav/dir/</href></add-member>`)
+
+	res, _ = serveTestRequest(h, httptest.NewRequest(http.MethodOptions, "/dav/dir/", nil))
+	if allow := res.Header.Get("Allow"); !strings.Contains(allow, http.MethodPost) {
+		t.Errorf("OPTIONS: got Allow %q, want POST", allow)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	opts := &AuthOptions{
+		Realm: "photos",
+		Basic: func(ctx context.Context, username, password string) (string, error) {
+			if username == "alice" && password == "secret" {
+				return "alice", nil
+			}
+			return "", nil
+		},
+		Bearer: func(ctx context.Context, token string) (string, error) {
+			if token == "broken" {
+				return "", errors.New("token store unavailable")
+			} else if token == "bob-token" {
+				return "bob", nil
+			}
+			return "", nil
+		},
+	}
+	h := Authenticate(opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		io.WriteString(w, principal)
+	}))
+
+	for _, tc := range []struct {
+		auth      string
+		status    int
+		principal string
+	}{
+		{"", http.StatusUnauthorized, ""},
+		{"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")), http.StatusOK, "alice"},
+		{"Basic " + base64.StdEncoding.EncodeToString([]byte("alice:wrong")), http.StatusUnauthorized, ""},
+		{"Bearer bob-token", http.StatusOK, "bob"},
+		{"bearer bob-token", http.StatusOK, "bob"},
+		{"Bearer unknown", http.StatusUnauthorized, ""},
+		{"Bearer broken", http.StatusInternalServerError, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		res, body := serveTestRequest(h, req)
+		if res.StatusCode != tc.status {
+			t.Errorf("%q: got status %v, want %v", tc.auth, res.StatusCode, tc.status)
+		} else if tc.status == http.StatusOK && body != tc.principal {
+			t.Errorf("%q: got principal %q, want %q", tc.auth, body, tc.principal)
+		}
+		if tc.status == http.StatusUnauthorized && len(res.Header.Values("WWW-Authenticate")) != 2 {
+			t.Errorf("%q: got WWW-Authenticate %q, want Basic and Bearer challenges", tc.auth, res.Header.Values("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"archive/old.txt": "old", "inbox/new.txt": "new"})
+	h := &Handler{
+		FileSystem: fs,
+		Authorizer: AuthorizerFunc(func(r *http.Request, method, p string) error {
+			principal, _ := PrincipalFromContext(r.Context())
+			if principal == "" {
+				return errors.New("anonymous access denied")
+			}
+			readOnly := method == http.MethodGet || method == http.MethodHead || method == "PROPFIND"
+			if principal != "admin" && strings.HasPrefix(p, "/archive/") && !readOnly {
+				return fmt.Errorf("%q is read-only", "/archive/")
+			}
+			return nil
+		}),
+	}
+
+	for _, tc := range []struct {
+		principal, method, path, dest string
+		status                        int
+	}{
+		{"", http.MethodGet, "/archive/old.txt", "", http.StatusUnauthorized},
+		{"alice", http.MethodGet, "/archive/old.txt", "", http.StatusOK},
+		{"alice", http.MethodPut, "/archive/old.txt", "", http.StatusForbidden},
+		{"alice", http.MethodDelete, "/archive/old.txt", "", http.StatusForbidden},
+		{"alice", "MOVE", "/inbox/new.txt", "/archive/new.txt", http.StatusForbidden},
+		{"alice", http.MethodPut, "/inbox/new.txt", "", http.StatusNoContent},
+		{"admin", "MOVE", "/inbox/new.txt", "/archive/new.txt", http.StatusCreated},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader("data"))
+		if tc.dest != "" {
+			req.Header.Set("Destination", tc.dest)
+		}
+		if tc.principal != "" {
+			req = req.WithContext(ContextWithPrincipal(req.Context(), tc.principal))
+		}
+		if res, _ := serveTestRequest(h, req); res.StatusCode != tc.status {
+			t.Errorf("%v %v as %q: got status %v, want %v", tc.method, tc.path, tc.principal, res.StatusCode, tc.status)
+		}
+	}
+
+	if _, err := fs.Stat(context.Background(), "/archive/old.txt"); err != nil {
+		t.Errorf("Stat() = %v", err)
+	}
+}
+
+func TestAuthorizerBatchDelete(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"dir/a.txt": "a", "dir/keep.txt": "keep"})
+	h := &Handler{
+		FileSystem: fs,
+		Authorizer: AuthorizerFunc(func(r *http.Request, method, p string) error {
+			if method == http.MethodDelete && p == "/dir/keep.txt" {
+				return fmt.Errorf("%q can't be deleted", p)
+			}
+			return nil
+		}),
+	}
+
+	req := httptest.NewRequest("REPORT", "/dir/", strings.NewReader(`<batch-delete xmlns="https://github.com/emersion/go-webdav" xmlns:d="DAV:"><d:href>/dir/a.txt</d:href><d:href>/dir/keep.txt</d:href></batch-delete>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req = req.WithContext(ContextWithPrincipal(req.Context(), "alice"))
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("REPORT: got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+
+	var ms internal.MultiStatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("REPORT: failed to decode response: %v", err)
+	}
+	want := map[string]int{"/dir/a.txt": http.StatusNoContent, "/dir/keep.txt": http.StatusForbidden}
+	if len(ms.Responses) != len(want) {
+		t.Fatalf("REPORT: got %v responses, want %v", len(ms.Responses), len(want))
+	}
+	for _, resp := range ms.Responses {
+		p := resp.Hrefs[0].Path
+		if resp.Status == nil || resp.Status.Code != want[p] {
+			t.Errorf("REPORT: got status %v for %q, want %v", resp.Status, p, want[p])
+		}
+	}
+
+	if _, err := fs.Stat(context.Background(), "/dir/a.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(a.txt) = %v, want not found", err)
+	}
+	if _, err := fs.Stat(context.Background(), "/dir/keep.txt"); err != nil {
+		t.Errorf("Stat(keep.txt) = %v", err)
+	}
+}
+
+type metadataFileSystem struct {
+	LocalFileSystem
+	calls int
+}
+
+var (
+	widthName  = xml.Name{Space: "http://example.com/ns/", Local: "width"}
+	cameraName = xml.Name{Space: "http://example.com/ns/", Local: "camera"}
+)
+
+func (fs *metadataFileSystem) MetadataNames(fi *FileInfo) []xml.Name {
+	if fi.IsDir {
+		return nil
+	}
+	return []xml.Name{widthName, cameraName}
+}
+
+func (fs *metadataFileSystem) Metadata(ctx context.Context, fi *FileInfo) (map[xml.Name]string, error) {
+	fs.calls++
+	return map[xml.Name]string{widthName: "4032"}, nil
+}
+
+func TestPropFindMetadata(t *testing.T) {
+	fs := &metadataFileSystem{LocalFileSystem: newTestFileSystem(t, map[string]string{"IMG_0001.jpg": "jpeg"})}
+	h := &Handler{FileSystem: fs}
+
+	propFind := func(propfind string) string {
+		req := httptest.NewRequest("PROPFIND", "/IMG_0001.jpg", strings.NewReader(propfind))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "0")
+		_, body := serveTestRequest(h, req)
+		return body
+	}
+
+	propFind(`<propfind xmlns="DAV:"><prop><getcontentlength/></prop></propfind>`)
+	body := propFind(`<propfind xmlns="DAV:"><allprop/></propfind>`)
+	if fs.calls != 0 {
+		t.Errorf("Metadata() called %v times without metadata properties being requested", fs.calls)
+	}
+	if strings.Contains(body, "http://example.com/ns/") {
+		t.Errorf("allprop response contains metadata properties:\n%s", body)
+	}
+
+	body = propFind(`<propfind xmlns="DAV:" xmlns:e="http://example.com/ns/"><prop><e:width/><e:camera/></prop></propfind>`)
+	if fs.calls != 1 {
+		t.Errorf("Metadata() called %v times, want 1", fs.calls)
+	}
+	xmltest.AssertContains(t, []byte(body), `<width xmlns="http://example.com/ns/">4032</width>`)
+
+	var ms internal.MultiStatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatal(err)
+	}
+	var missing struct {
+		XMLName xml.Name `xml:"http://example.com/ns/ camera"`
+	}
+	if err := ms.Responses[0].DecodeProp(&missing); !internal.IsNotFound(err) {
+		t.Errorf("camera property: got %v, want not found", err)
+	}
+}
+
+func TestPropFindPropertyError(t *testing.T) {
+	fs := &propertyFileSystem{
+		LocalFileSystem: newTestFileSystem(t, map[string]string{"a.txt": "a", "b.txt": "b"}),
+		err:             errors.New("failed to read xattr"),
+	}
+	h := &Handler{FileSystem: fs}
+
+	req := httptest.NewRequest("PROPFIND", "/", strings.NewReader(`<propfind xmlns="DAV:"><prop><getcontentlength/><getcontenttype/></prop></propfind>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+	res, body := serveTestRequest(h, req)
+	if res.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want %v", res.StatusCode, http.StatusMultiStatus)
+	}
+	xmltest.AssertContains(t, []byte(body), `<propstat xmlns="DAV:"><prop><getcontentlength>1</getcontentlength></prop><status>HTTP/1.1 200 OK</status></propstat>`)
+	xmltest.AssertContains(t, []byte(body), `<propstat xmlns="DAV:"><prop><getcontenttype></getcontenttype></prop><status>HTTP/1.1 500 Internal Server Error</status></propstat>`)
+}
+
+func TestHiddenFile(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{
+		"a.txt":           "a",
+		".DS_Store":       "x",
+		".git/config":     "x",
+		"dir/Thumbs.db":   "x",
+		"dir/b.txt":       "b",
+		"dir/.hidden.txt": "x",
+	})
+
+	propfind := func(h *Handler, p string) string {
+		req := httptest.NewRequest("PROPFIND", p, nil)
+		req.Header.Set("Depth", "infinity")
+		res, body := serveTestRequest(h, req)
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("PROPFIND %v: got status %v, want %v", p, res.StatusCode, http.StatusMultiStatus)
+		}
+		return body
+	}
+
+	h := &Handler{FileSystem: fs}
+	body := propfind(h, "/")
+	for _, name := range []string{"/a.txt", "/dir/b.txt", "/.git/config", "/dir/.hidden.txt"} {
+		if !strings.Contains(body, ">"+name+"<") {
+			t.Errorf("default filter: missing %v in listing", name)
+		}
+	}
+	for _, name := range []string{"/.DS_Store", "/dir/Thumbs.db"} {
+		if strings.Contains(body, ">"+name+"<") {
+			t.Errorf("default filter: %v not hidden", name)
+		}
+	}
+
+	h = &Handler{FileSystem: fs, HiddenFile: func(name string) bool {
+		return strings.HasPrefix(name, ".")
+	}}
+	body = propfind(h, "/")
+	for _, name := range []string{"/.DS_Store", "/.git/", "/.git/config", "/dir/.hidden.txt"} {
+		if strings.Contains(body, ">"+name+"<") {
+			t.Errorf("custom filter: %v not hidden", name)
+		}
+	}
+	if !strings.Contains(body, ">/dir/Thumbs.db<") {
+		t.Errorf("custom filter: missing /dir/Thumbs.db in listing")
+	}
+	// Listing a hidden collection itself still works
+	if body := propfind(h, "/.git/"); !strings.Contains(body, ">/.git/config<") {
+		t.Errorf("custom filter: missing /.git/config in listing of /.git/")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/.DS_Store", nil)
+	if res, body := serveTestRequest(&Handler{FileSystem: fs}, req); res.StatusCode != http.StatusOK || body != "x" {
+		t.Errorf("GET /.DS_Store: got status %v and body %q, want 200 and %q", res.StatusCode, body, "x")
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"a.txt": "a"})
+	h := &Handler{FileSystem: fs, CacheControl: func(fi *FileInfo) string {
+		if fi.IsDir {
+			return "no-cache"
+		}
+		return "max-age=3600"
+	}}
+
+	for p, want := range map[string]string{"/": "no-cache", "/a.txt": "max-age=3600"} {
+		res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodGet, p, nil))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("GET %v: got status %v, want %v", p, res.StatusCode, http.StatusOK)
+		}
+		if got := res.Header.Get("Cache-Control"); got != want {
+			t.Errorf("GET %v: got Cache-Control %q, want %q", p, got, want)
+		}
+		if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("GET %v: got Vary %q, want %q", p, got, "Accept-Encoding")
+		}
+	}
+
+	res, _ := serveTestRequest(&Handler{FileSystem: fs}, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	if got := res.Header.Get("Cache-Control"); got != "" {
+		t.Errorf("GET without policy: got Cache-Control %q, want none", got)
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"a.txt": "a"})
+	h := &Handler{FileSystem: fs, ResponseHeaders: func(r *http.Request, fi *FileInfo) http.Header {
+		header := make(http.Header)
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Resource", fi.Path)
+		return header
+	}}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, "PROPFIND"} {
+		req := httptest.NewRequest(method, "/a.txt", nil)
+		req.Header.Set("Depth", "0")
+		res, _ := serveTestRequest(h, req)
+		if got := res.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%v: got X-Content-Type-Options %q, want %q", method, got, "nosniff")
+		}
+		if got := res.Header.Get("X-Resource"); got != "/a.txt" {
+			t.Errorf("%v: got X-Resource %q, want %q", method, got, "/a.txt")
+		}
+	}
+
+	res, _ := serveTestRequest(h, httptest.NewRequest(http.MethodGet, "/missing.txt", nil))
+	if got := res.Header.Get("X-Resource"); got != "" {
+		t.Errorf("GET missing resource: got X-Resource %q, want none", got)
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	fs := memberFileSystem{newTestFileSystem(t, map[string]string{"dir/file": "", "other/file": ""})}
+	h := Idempotent(&IdempotencyOptions{}, &Handler{FileSystem: fs})
+
+	post := func(p, key string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, p, strings.NewReader("hello"))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		res, _ := serveTestRequest(h, req)
+		return res
+	}
+
+	res := post("/dir/", "abc")
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("POST: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	etag := res.Header.Get("ETag")
+
+	// The member already exists, but the retry gets the original response
+	res = post("/dir/", "abc")
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("retried POST: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+	if got := res.Header.Get("Location"); got != "/dir/new.txt" {
+		t.Errorf("retried POST: got Location %q, want %q", got, "/dir/new.txt")
+	}
+	if got := res.Header.Get("ETag"); got != etag {
+		t.Errorf("retried POST: got ETag %q, want %q", got, etag)
+	}
+
+	if res := post("/dir/", ""); res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("POST without key: got status %v, want %v", res.StatusCode, http.StatusPreconditionFailed)
+	}
+	if res := post("/other/", "abc"); res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("POST reusing key: got status %v, want %v", res.StatusCode, http.StatusUnprocessableEntity)
+	}
+	if res := post("/other/", "def"); res.StatusCode != http.StatusCreated {
+		t.Errorf("POST with new key: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	}
+}
+
+type upperTranscoder struct {
+	calls int
+}
+
+func (tr *upperTranscoder) Transcode(ctx context.Context, dst io.Writer, src io.Reader, from, to string) error {
+	tr.calls++
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(bytes.ToUpper(data))
+	return err
+}
+
+func TestTranscode(t *testing.T) {
+	fs := newTestFileSystem(t, map[string]string{"a.png": "pixels"})
+	tr := &upperTranscoder{}
+	h := &Handler{FileSystem: fs, Transcode: &TranscodeOptions{
+		Types:      map[string]string{"image/png": "image/jpeg"},
+		Transcoder: tr,
+	}}
+
+	get := func(accept string) (*http.Response, string) {
+		req := httptest.NewRequest(http.MethodGet, "/a.png", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		return serveTestRequest(h, req)
+	}
+
+	res, body := get("image/avif,image/webp,*/*")
+	if body != "PIXELS" {
+		t.Errorf("GET: got body %q, want %q", body, "PIXELS")
+	}
+	if got := res.Header.Get("Content-Type"); got != "image/jpeg" {
+		t.Errorf("GET: got Content-Type %q, want %q", got, "image/jpeg")
+	}
+	etag := res.Header.Get("ETag")
+	if !strings.HasSuffix(etag, `-jpeg"`) {
+		t.Errorf("GET: got ETag %q, want a -jpeg suffix", etag)
+	}
+
+	if _, body := get(""); body != "PIXELS" || tr.calls != 1 {
+		t.Errorf("cached GET: got body %q after %v conversions, want %q after 1", body, tr.calls, "PIXELS")
+	}
+
+	res, body = get("image/png")
+	if body != "pixels" || res.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("GET accepting PNG: got body %q and Content-Type %q, want the original", body, res.Header.Get("Content-Type"))
+	}
+	if res.Header.Get("ETag") == etag {
+		t.Errorf("GET accepting PNG: got the ETag of the converted file")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/a.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	if res, _ := serveTestRequest(h, req); res.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET: got status %v, want %v", res.StatusCode, http.StatusNotModified)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	fs := newTestFileSystem(t, nil)
+	srv := httptest.NewServer(&Handler{FileSystem: fs, ReadTimeout: 100 * time.Millisecond})
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Announce a body, but only send part of it
+	io.WriteString(conn, "PUT /a.txt HTTP/1.1\r\nHost: example.org\r\nContent-Length: 10\r\n\r\nabc")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't cut off the stalled client")
+	}
+}
+
+type snapshotFileSystem struct {
+	LocalFileSystem
+	snapshot LocalFileSystem
+	released bool
+}
+
+func (fs *snapshotFileSystem) Snapshot(ctx context.Context) (FileSystem, func(), error) {
+	return fs.snapshot, func() { fs.released = true }, nil
+}
+
+func TestPropFindSnapshot(t *testing.T) {
+	fs := &snapshotFileSystem{
+		LocalFileSystem: newTestFileSystem(t, map[string]string{"dir/a.txt": "a"}),
+		snapshot:        newTestFileSystem(t, map[string]string{"dir/b.txt": "b"}),
+	}
+	h := &Handler{FileSystem: fs}
+
+	propfind := func(depth string) string {
+		req := httptest.NewRequest("PROPFIND", "/dir/", nil)
+		req.Header.Set("Depth", depth)
+		res, body := serveTestRequest(h, req)
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("PROPFIND with Depth %v: got status %v, want %v", depth, res.StatusCode, http.StatusMultiStatus)
+		}
+		return body
+	}
+
+	if body := propfind("infinity"); !strings.Contains(body, ">/dir/b.txt<") || strings.Contains(body, ">/dir/a.txt<") {
+		t.Errorf("PROPFIND with Depth infinity: listing not served from the snapshot:\n%v", body)
+	}
+	if !fs.released {
+		t.Errorf("snapshot not released")
+	}
+
+	if body := propfind("1"); !strings.Contains(body, ">/dir/a.txt<") {
+		t.Errorf("PROPFIND with Depth 1: listing not served from the FileSystem:\n%v", body)
+	}
+}
+
+type quotaFileSystem struct {
+	LocalFileSystem
+	quota *Quota
+}
+
+func (fs quotaFileSystem) Quota(ctx context.Context, name string) (*Quota, error) {
+	return fs.quota, nil
+}
+
+func TestPutChunked(t *testing.T) {
+	fs := quotaFileSystem{newTestFileSystem(t, nil), &Quota{Available: 5}}
+	srv := httptest.NewServer(&Handler{FileSystem: fs})
+	defer srv.Close()
+
+	put := func(name, data string) *http.Response {
+		// Hide the length of the body, so that it's sent in chunks
+		body := struct{ io.Reader }{strings.NewReader(data)}
+		req, err := http.NewRequest(http.MethodPut, srv.URL+name, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	if res := put("/small", "hello"); res.StatusCode != http.StatusCreated {
+		t.Errorf("PUT within quota: got status %v, want %v", res.StatusCode, http.StatusCreated)
+	} else if data, _ := os.ReadFile(filepath.Join(string(fs.LocalFileSystem), "small")); string(data) != "hello" {
+		t.Errorf("PUT within quota: got contents %q, want %q", data, "hello")
+	}
+
+	if res := put("/large", "hello world"); res.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("PUT exceeding quota: got status %v, want %v", res.StatusCode, http.StatusInsufficientStorage)
+	}
+	if _, err := os.Stat(filepath.Join(string(fs.LocalFileSystem), "large")); err == nil {
+		t.Errorf("PUT exceeding quota: file created")
+	}
+}
+
+func TestPutNilQuota(t *testing.T) {
+	fs := quotaFileSystem{newTestFileSystem(t, nil), nil}
+	h := &Handler{FileSystem: fs}
+
+	res, body := serveTestRequest(h, httptest.NewRequest(http.MethodPut, "/file", strings.NewReader("data")))
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("got status %v, want %v: %v", res.StatusCode, http.StatusCreated, body)
+	}
+}
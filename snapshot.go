@@ -0,0 +1,33 @@
+package webdav
+
+import (
+	"context"
+)
+
+// Snapshotter is an optional interface a FileSystem can implement to serve
+// Depth: infinity PROPFIND requests from a consistent point-in-time view,
+// e.g. with a read transaction. Otherwise, the tree can change while it's
+// being listed. The recursive ReadDir of LocalFileSystem is a best-effort
+// single pass over the tree.
+type Snapshotter interface {
+	// Snapshot returns a read-only view of the FileSystem. It should
+	// implement the same optional interfaces as the FileSystem, e.g.
+	// PropertyStore. release is called once the request has been served.
+	Snapshot(ctx context.Context) (snapshot FileSystem, release func(), err error)
+}
+
+// snapshot returns a copy of the backend serving requests from a snapshot of
+// the FileSystem, if it implements Snapshotter.
+func (b *backend) snapshot(ctx context.Context) (*backend, func(), error) {
+	s, ok := b.FileSystem.(Snapshotter)
+	if !ok {
+		return b, func() {}, nil
+	}
+	fs, release, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	snap := *b
+	snap.FileSystem = fs
+	return &snap, release, nil
+}
@@ -0,0 +1,163 @@
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-webdav/internal"
+)
+
+// Transcoder converts file contents from a media type to another, e.g. HEIC
+// images to JPEG.
+type Transcoder interface {
+	Transcode(ctx context.Context, dst io.Writer, src io.Reader, from, to string) error
+}
+
+// TranscodeOptions configures the conversion of files to a media type
+// supported by clients, in response to GET and HEAD requests.
+//
+// A file is converted if its media type is listed in Types, and if the
+// client doesn't explicitly accept it in the Accept header: wildcards such as
+// "*/*" aren't considered, because browsers send them even for media types
+// they can't display. Converted files have a distinct ETag, derived from the
+// ETag of the original file.
+type TranscodeOptions struct {
+	// Types maps the media types of files to the media types they're
+	// converted to, e.g. "image/heic" to "image/jpeg".
+	Types map[string]string
+	// Transcoder converts files.
+	Transcoder Transcoder
+	// CacheSize is the maximum total size of the converted files kept in
+	// memory, to avoid converting them again. If zero, 32 MiB are used. If
+	// negative, nothing is cached.
+	CacheSize int64
+
+	mu        sync.Mutex
+	cache     map[transcodeCacheKey][]byte
+	cacheSize int64
+}
+
+type transcodeCacheKey struct {
+	path, etag, to string
+}
+
+// target returns the media type a file needs to be converted to, if any.
+func (opts *TranscodeOptions) target(r *http.Request, fi *FileInfo) string {
+	to, ok := opts.Types[fi.MIMEType]
+	if !ok || opts.Transcoder == nil || acceptsMediaType(r.Header.Get("Accept"), fi.MIMEType) {
+		return ""
+	}
+	return to
+}
+
+// acceptsMediaType checks whether an Accept header explicitly lists a media
+// type with a non-zero quality.
+func acceptsMediaType(accept, t string) bool {
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil || mediaType != t {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (opts *TranscodeOptions) maxCacheSize() int64 {
+	if opts.CacheSize == 0 {
+		return 32 << 20
+	}
+	return opts.CacheSize
+}
+
+func (opts *TranscodeOptions) load(k transcodeCacheKey) ([]byte, bool) {
+	opts.mu.Lock()
+	defer opts.mu.Unlock()
+	data, ok := opts.cache[k]
+	return data, ok
+}
+
+func (opts *TranscodeOptions) store(k transcodeCacheKey, data []byte) {
+	maxSize := opts.maxCacheSize()
+	if k.etag == "" || int64(len(data)) > maxSize {
+		return
+	}
+
+	opts.mu.Lock()
+	defer opts.mu.Unlock()
+
+	if opts.cache == nil {
+		opts.cache = make(map[transcodeCacheKey][]byte)
+	}
+	for evicted, v := range opts.cache {
+		if opts.cacheSize+int64(len(data)) <= maxSize {
+			break
+		}
+		delete(opts.cache, evicted)
+		opts.cacheSize -= int64(len(v))
+	}
+	if old, ok := opts.cache[k]; ok {
+		opts.cacheSize -= int64(len(old))
+	}
+	opts.cache[k] = data
+	opts.cacheSize += int64(len(data))
+}
+
+// serveTranscoded serves a file converted to another media type.
+func (b *backend) serveTranscoded(w http.ResponseWriter, r *http.Request, fi *FileInfo, to string) error {
+	out := *fi
+	out.MIMEType = to
+	if fi.ETag != "" {
+		out.ETag = fi.ETag + "-" + path.Base(to)
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if !out.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", out.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if out.ETag != "" {
+		w.Header().Set("ETag", internal.ETag(out.ETag).String())
+	}
+
+	if code, err := checkConditionalRead(r.Header, &out); err != nil {
+		return err
+	} else if code == http.StatusNotModified {
+		w.WriteHeader(code)
+		return nil
+	} else if code != 0 {
+		return internal.HTTPErrorf(code, "webdav: precondition failed")
+	}
+
+	k := transcodeCacheKey{path: fi.Path, etag: fi.ETag, to: to}
+	data, ok := b.Transcode.load(k)
+	if !ok {
+		f, err := b.FileSystem.Open(r.Context(), r.URL.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var buf bytes.Buffer
+		if err := b.Transcode.Transcoder.Transcode(r.Context(), &buf, f, fi.MIMEType, to); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		if b.Transcode.maxCacheSize() > 0 {
+			b.Transcode.store(k, data)
+		}
+	}
+
+	w.Header().Set("Content-Type", to)
+	http.ServeContent(w, r, r.URL.Path, out.ModTime, bytes.NewReader(data))
+	return nil
+}
@@ -0,0 +1,139 @@
+package webdav
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// treeVersions counts the mutations made under each collection of a
+// LocalFileSystem, so that collections get an ETag changing whenever one of
+// their descendants changes, without walking the tree.
+//
+// Counters live in memory. Each Handler keeps its own, and passes them to
+// the FileSystem in the request context. Only collections containing
+// modified files have a counter, counters of deleted collections are
+// dropped and counters of moved collections follow them. The ETags include
+// a random prefix chosen at startup, so that counters reset by a restart
+// don't produce stale ETags.
+type treeVersions struct {
+	mu       sync.Mutex
+	versions map[treeVersionKey]uint64
+}
+
+type treeVersionKey struct {
+	root, name string
+}
+
+var treeVersionPrefix = newTreeVersionPrefix()
+
+func newTreeVersionPrefix() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Errorf("webdav: failed to generate tree version prefix: %v", err))
+	}
+	return hex.EncodeToString(b[:])
+}
+
+type treeVersionsContextKey struct{}
+
+func contextWithTreeVersions(ctx context.Context, tv *treeVersions) context.Context {
+	return context.WithValue(ctx, treeVersionsContextKey{}, tv)
+}
+
+// treeVersionsFromContext returns the counters of the Handler serving a
+// request. Without a Handler, it returns nil: collection ETags are then only
+// derived from modification times.
+func treeVersionsFromContext(ctx context.Context) *treeVersions {
+	tv, _ := ctx.Value(treeVersionsContextKey{}).(*treeVersions)
+	return tv
+}
+
+func (fs LocalFileSystem) treeVersionKey(name string) treeVersionKey {
+	return treeVersionKey{filepath.Clean(string(fs)), path.Clean("/" + name)}
+}
+
+// bump records a mutation of a file, incrementing the counters of all
+// collections containing it.
+func (tv *treeVersions) bump(fs LocalFileSystem, name string) {
+	if tv == nil {
+		return
+	}
+
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+
+	if tv.versions == nil {
+		tv.versions = make(map[treeVersionKey]uint64)
+	}
+	k := fs.treeVersionKey(name)
+	for k.name != "/" {
+		k.name = path.Dir(k.name)
+		tv.versions[k]++
+	}
+}
+
+// drop removes the counters of a collection which no longer exists, and of
+// its descendants.
+func (tv *treeVersions) drop(fs LocalFileSystem, name string) {
+	tv.rename(fs, name, "")
+}
+
+// rename moves the counters of a collection, and of its descendants, to a
+// new name. The counters previously kept for the new name are dropped. If
+// the new name is empty, the counters are dropped.
+func (tv *treeVersions) rename(fs LocalFileSystem, src, dst string) {
+	if tv == nil {
+		return
+	}
+
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+
+	from := fs.treeVersionKey(src)
+	to := fs.treeVersionKey(dst)
+	moved := make(map[treeVersionKey]uint64)
+	for k, v := range tv.versions {
+		if rel, ok := treeVersionRel(from, k); ok {
+			delete(tv.versions, k)
+			if dst != "" {
+				moved[treeVersionKey{to.root, path.Join(to.name, rel)}] = v
+			}
+		} else if _, ok := treeVersionRel(to, k); ok && dst != "" {
+			delete(tv.versions, k)
+		}
+	}
+	for k, v := range moved {
+		tv.versions[k] = v
+	}
+}
+
+// treeVersionRel returns the path of k relative to dir, if k is dir or one of
+// its descendants.
+func treeVersionRel(dir, k treeVersionKey) (string, bool) {
+	if k.root != dir.root {
+		return "", false
+	} else if k.name == dir.name {
+		return "", true
+	}
+	rel := strings.TrimPrefix(k.name, strings.TrimSuffix(dir.name, "/")+"/")
+	return rel, rel != k.name
+}
+
+// etag returns the ETag of a collection. The modification time of the
+// directory is included, so that changes made by other processes to its
+// direct members are noticed too.
+func (tv *treeVersions) etag(fs LocalFileSystem, name string, fi *FileInfo) string {
+	var v uint64
+	if tv != nil {
+		tv.mu.Lock()
+		v = tv.versions[fs.treeVersionKey(name)]
+		tv.mu.Unlock()
+	}
+	return fmt.Sprintf("%v-%x-%x", treeVersionPrefix, v, fi.ModTime.UnixNano())
+}
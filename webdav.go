@@ -4,6 +4,8 @@
 package webdav
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-webdav/internal"
@@ -32,15 +34,54 @@ type RemoveAllOptions struct {
 type CopyOptions struct {
 	NoRecursive bool
 	NoOverwrite bool
+	// Progress, if set, is called after each member has been copied with
+	// the destination path of the member and the number of members copied
+	// so far.
+	Progress ProgressFunc
 }
 
+// MoveOptions holds options for FileSystem.Move. FileSystems should preserve
+// the ETag of files whose contents are unchanged by a move, so that sync
+// clients don't need to download them again.
 type MoveOptions struct {
 	NoOverwrite bool
+	// Progress, if set, is called after each member has been moved. See
+	// CopyOptions.Progress.
+	Progress ProgressFunc
 }
 
+// ProgressFunc reports the progress of a COPY or MOVE operation. name is the
+// destination path of the member which has just been processed and n is the
+// number of members processed so far.
+type ProgressFunc func(name string, n int)
+
+// PartialError is returned by FileSystem.Copy and FileSystem.Move when an
+// operation on a collection has been interrupted before completion, e.g.
+// because the request context has been cancelled.
+type PartialError struct {
+	// Completed contains the destination paths of the members which have
+	// been processed before the interruption.
+	Completed []string
+	Err       error
+}
+
+func (err *PartialError) Error() string {
+	return fmt.Sprintf("webdav: operation interrupted after %v members: %v", len(err.Completed), err.Err)
+}
+
+func (err *PartialError) Unwrap() error {
+	return err.Err
+}
+
+// ErrPreconditionFailed is matched by the errors returned by clients when the
+// server replies with 412 Precondition Failed, e.g. because a conditional
+// request targets a resource which has been modified in the meantime. It can
+// be returned by FileSystems and backends to reply with this status.
+var ErrPreconditionFailed = internal.ErrPreconditionFailed
+
 // ConditionalMatch represents the value of a conditional header
 // according to RFC 2068 section 14.25 and RFC 2068 section 14.26
-// The (optional) value can either be a wildcard or an ETag.
+// The (optional) value can either be a wildcard or a list of ETags.
 type ConditionalMatch string
 
 func (val ConditionalMatch) IsSet() bool {
@@ -59,13 +100,64 @@ func (val ConditionalMatch) ETag() (string, error) {
 	return string(e), nil
 }
 
+// MatchETag reports whether the header matches an ETag, using the strong
+// comparison function defined in RFC 7232 section 2.3.2: weak entity-tags in
+// the header never match. This is the comparison required for If-Match.
 func (val ConditionalMatch) MatchETag(etag string) (bool, error) {
+	return val.matchETag(etag, false)
+}
+
+// MatchETagWeak is like MatchETag, but uses the weak comparison function:
+// weak entity-tags in the header match if their opaque tag is equal. This is
+// the comparison required for If-None-Match.
+func (val ConditionalMatch) MatchETagWeak(etag string) (bool, error) {
+	return val.matchETag(etag, true)
+}
+
+func (val ConditionalMatch) matchETag(etag string, weak bool) (bool, error) {
 	if etag == "" {
 		return false, nil
 	}
 	if val.IsWildcard() {
 		return true, nil
 	}
-	t, err := val.ETag()
-	return t == etag, err
+	etag = internal.NormalizeETag(etag)
+
+	// The header contains a list of entity-tags, see RFC 7232 section 3.1.
+	// Some clients send unquoted entity-tags, they're accepted as well.
+	s := strings.TrimSpace(string(val))
+	for s != "" {
+		isWeak := strings.HasPrefix(s, "W/")
+		if isWeak {
+			s = s[2:]
+		}
+		var opaque string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return false, fmt.Errorf("webdav: malformed entity-tag list %q", string(val))
+			}
+			opaque = s[1 : end+1]
+			s = s[end+2:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			opaque = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		if opaque == etag && (weak || !isWeak) {
+			return true, nil
+		}
+
+		s = strings.TrimSpace(s)
+		if s != "" {
+			if s[0] != ',' {
+				return false, fmt.Errorf("webdav: malformed entity-tag list %q", string(val))
+			}
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+	return false, nil
 }